@@ -2,13 +2,13 @@ package agent
 
 import (
 	"context"
-	"time"
+	"fmt"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/core"
 	"github.com/firebase/genkit/go/genkit"
-	"github.com/thomas-marquis/genkit-mistral/mistral"
 	"github.com/thomas-marquis/goLLMan/agent/loader"
+	"github.com/thomas-marquis/goLLMan/agent/provider"
 	"github.com/thomas-marquis/goLLMan/agent/session"
 	"github.com/thomas-marquis/goLLMan/internal/domain"
 	"github.com/thomas-marquis/goLLMan/pkg"
@@ -17,20 +17,64 @@ import (
 type ChatbotInput struct {
 	Question string `json:"question"`
 	Session  string `json:"session,omitempty"`
+	// BookIDs scopes the session to the given books when not nil.
+	// Otherwise, the books previously attached to the session are used.
+	BookIDs []string `json:"bookIds,omitempty"`
+	// Filters restricts the retrieval to the books whose metadata match, such as {"language": "en"}.
+	Filters map[string]string `json:"filters,omitempty"`
+}
+
+type ChatbotOutput struct {
+	Answer    string            `json:"answer"`
+	Citations []domain.Citation `json:"citations,omitempty"`
+	// SearchQuery is the standalone query the documents were retrieved with.
+	SearchQuery string `json:"searchQuery,omitempty"`
 }
 
 type Agent struct {
-	g               *genkit.Genkit
-	indexerFlow     *core.Flow[domain.Book, any, struct{}]
-	chatbotFlow     *core.Flow[ChatbotInput, string, struct{}]
-	docLoader       loader.BookLoader
-	bookVectorStore domain.BookVectorStore
-	sessionStore    session.Store
-	cfg             Config
-	bookRepository  domain.BookRepository
-	fileRepository  domain.FileRepository
-	retriever       ai.Retriever
-	embedder        ai.Embedder
+	g           *genkit.Genkit
+	indexerFlow *core.Flow[domain.Book, any, struct{}]
+	chatbotFlow *core.Flow[ChatbotInput, ChatbotOutput, string]
+	// summarizationFlow is nil unless the summary memory strategy is configured.
+	summarizationFlow *core.Flow[SummarizationInput, string, struct{}]
+	evaluationFlow    *core.Flow[evalCaseInput, EvalCaseResult, struct{}]
+	docLoader         loader.BookLoader
+	bookVectorStore   domain.BookVectorStore
+	sessionStore      session.Store
+	cfg               Config
+	bookRepository    domain.BookRepository
+	fileRepository    domain.FileRepository
+	retriever         ai.Retriever
+	embedder          ai.Embedder
+	reranker          Reranker
+	embeddingCache    domain.EmbeddingCache
+	chunkContextCache domain.ChunkContextCache
+	tools             []ai.ToolRef
+	prompts           promptSet
+}
+
+type Option func(a *Agent)
+
+// WithReranker sets the reranker applied to the retrieved documents.
+// It takes precedence over the LLM reranker configured with Config.RerankerModel.
+func WithReranker(reranker Reranker) Option {
+	return func(a *Agent) {
+		a.reranker = reranker
+	}
+}
+
+// WithEmbeddingCache makes the indexing reuse the vectors of the chunks already embedded with the same model.
+func WithEmbeddingCache(cache domain.EmbeddingCache) Option {
+	return func(a *Agent) {
+		a.embeddingCache = cache
+	}
+}
+
+// WithChunkContextCache makes the indexing reuse the sentences already generated to situate the chunks.
+func WithChunkContextCache(cache domain.ChunkContextCache) Option {
+	return func(a *Agent) {
+		a.chunkContextCache = cache
+	}
 }
 
 func New(
@@ -40,23 +84,30 @@ func New(
 	bookRepository domain.BookRepository,
 	bookVectorStore domain.BookVectorStore,
 	fileRepository domain.FileRepository,
+	opts ...Option,
 ) *Agent {
 	ctx := context.Background()
 
-	rateLimit := cfg.MistralMaxRequestsPerSecond
+	plugins, err := provider.NewPlugins(cfg.Providers)
+	if err != nil {
+		pkg.Logger.Fatalf("failed to create model providers: %s", err)
+	}
+	promptDir := cfg.PromptDir
+	if promptDir == "" {
+		promptDir = DefaultPromptDir
+	}
 	g, err := genkit.Init(ctx,
-		genkit.WithPlugins(
-			mistral.NewPlugin(cfg.MistralApiKey,
-				mistral.WithRateLimiter(mistral.NewBucketCallsRateLimiter(rateLimit, rateLimit, time.Second)),
-				mistral.WithVerbose(cfg.Verbose),
-				mistral.WithClientTimeout(cfg.MistralTimeout),
-			),
-		),
+		genkit.WithPlugins(plugins...),
+		genkit.WithPromptDir(promptDir),
 		//genkit.WithDefaultModel(cfg.CompletionModel),
 	)
 	if err != nil {
 		pkg.Logger.Fatalf("failed to init genkit: %s", err)
 	}
+	prompts, err := loadPrompts(g, promptDir)
+	if err != nil {
+		pkg.Logger.Fatalf("failed to load prompts: %s", err)
+	}
 
 	a := &Agent{
 		g:               g,
@@ -66,6 +117,14 @@ func New(
 		docLoader:       docLoader,
 		bookVectorStore: bookVectorStore,
 		fileRepository:  fileRepository,
+		prompts:         prompts,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.reranker == nil && cfg.RerankerModel != "" {
+		a.reranker = newLLMReranker(g, cfg.RerankerModel, prompts)
 	}
 
 	a.indexerFlow = genkit.DefineFlow(g, "indexerFlow", a.indexerFlowHandler)
@@ -76,14 +135,32 @@ func New(
 		pkg.Logger.Fatalf("failed to parse embedding model: %s", err)
 	}
 	a.embedder = genkit.LookupEmbedder(g, embProvider, embModel)
+	if err := a.checkEmbeddingVectorSize(ctx); err != nil {
+		pkg.Logger.Fatalf("invalid embedding model: %s", err)
+	}
 
-	a.chatbotFlow = genkit.DefineFlow(g, "chatbotAIFlow", a.chatbotAiFlowHandler)
+	if cfg.MemoryStrategy == MemoryStrategySummary {
+		if cfg.SessionMessageLimit <= 0 {
+			pkg.Logger.Fatalf("the %s memory strategy requires a session message limit", MemoryStrategySummary)
+		}
+		a.summarizationFlow = genkit.DefineFlow(g, "summarizationFlow", a.summarizationFlowHandler)
+	}
+
+	a.evaluationFlow = genkit.DefineFlow(g, "evaluationFlow", a.evaluationFlowHandler)
+
+	if cfg.ChatMode == ChatModeAgent {
+		a.tools = a.defineTools()
+		a.chatbotFlow = genkit.DefineStreamingFlow(g, "chatbotAgentFlow", a.chatbotAgentFlowHandler)
+	} else {
+		a.chatbotFlow = genkit.DefineStreamingFlow(g, "chatbotAIFlow", a.chatbotAiFlowHandler)
+	}
 
 	return a
 }
 
 // Flow returns the chatbot flow used by the agent.
-func (a *Agent) Flow() *core.Flow[ChatbotInput, string, struct{}] {
+// The flow streams the answer text chunk by chunk when run with Stream.
+func (a *Agent) Flow() *core.Flow[ChatbotInput, ChatbotOutput, string] {
 	return a.chatbotFlow
 }
 
@@ -123,3 +200,25 @@ func (a *Agent) Index() error {
 	//pkg.Logger.Println("Indexing flow complete")
 	return nil
 }
+
+// checkEmbeddingVectorSize embeds a probe text to make sure the embedding model returns vectors
+// the book vector store can hold. The check is skipped when the model can't be reached.
+func (a *Agent) checkEmbeddingVectorSize(ctx context.Context) error {
+	if a.cfg.EmbeddingVectorSize == 0 || a.embedder == nil {
+		return nil
+	}
+
+	res, err := ai.Embed(ctx, a.embedder, ai.WithDocs(ai.DocumentFromText("embedding size probe", nil)))
+	if err != nil {
+		pkg.Logger.Printf("Unable to check the size of the %s embeddings: %s", a.cfg.EmbeddingModel, err)
+		return nil
+	}
+	if len(res.Embeddings) == 0 {
+		return fmt.Errorf("embedding model %s returned no vector", a.cfg.EmbeddingModel)
+	}
+	if size := len(res.Embeddings[0].Embedding); size != a.cfg.EmbeddingVectorSize {
+		return fmt.Errorf("embedding model %s returns vectors of size %d, but the book vector store holds vectors of size %d",
+			a.cfg.EmbeddingModel, size, a.cfg.EmbeddingVectorSize)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSizedEmbedderAgent(t *testing.T, size, vectorSize int) *Agent {
+	t.Helper()
+	g, err := genkit.Init(context.Background())
+	require.NoError(t, err)
+	embedder := genkit.DefineEmbedder(g, "test", "embed", func(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		resp := &ai.EmbedResponse{}
+		for range req.Input {
+			resp.Embeddings = append(resp.Embeddings, &ai.Embedding{Embedding: make([]float32, size)})
+		}
+		return resp, nil
+	})
+	return &Agent{
+		g:        g,
+		embedder: embedder,
+		cfg:      Config{EmbeddingModel: "test/embed", EmbeddingVectorSize: vectorSize},
+	}
+}
+
+func Test_checkEmbeddingVectorSize_ShouldAcceptMatchingSize(t *testing.T) {
+	// Given
+	a := newSizedEmbedderAgent(t, 8, 8)
+
+	// When
+	err := a.checkEmbeddingVectorSize(context.Background())
+
+	// Then
+	assert.NoError(t, err)
+}
+
+func Test_checkEmbeddingVectorSize_ShouldFailOnSizeMismatch(t *testing.T) {
+	// Given
+	a := newSizedEmbedderAgent(t, 768, 1024)
+
+	// When
+	err := a.checkEmbeddingVectorSize(context.Background())
+
+	// Then
+	assert.EqualError(t, err,
+		"embedding model test/embed returns vectors of size 768, but the book vector store holds vectors of size 1024")
+}
@@ -0,0 +1,249 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+const (
+	defaultContextWindow        = 32000
+	defaultReservedOutputTokens = 1024
+	defaultHistoryBudgetShare   = 0.3
+	defaultCharsPerToken        = 4.0
+
+	// toolOutputBudgetShare is the share of the context window a single tool result may take.
+	toolOutputBudgetShare = 0.25
+
+	// messageOverheadTokens accounts for the role and the separators the model adds around each message.
+	messageOverheadTokens = 4
+	// minTruncatedChunkTokens is the smallest truncated chunk worth sending, smaller ones are dropped.
+	minTruncatedChunkTokens = 64
+)
+
+// knownContextWindows maps the model names to their context window size, in tokens.
+var knownContextWindows = map[string]int{
+	"mistral-small":        32000,
+	"mistral-small-latest": 128000,
+	"mistral-medium":       128000,
+	"mistral-large":        128000,
+	"mistral-large-latest": 128000,
+	"open-mistral-nemo":    128000,
+	"llama3.1":             128000,
+	"llama3.2":             128000,
+	"gpt-4o":               128000,
+	"gpt-4o-mini":          128000,
+}
+
+// TokenCounter counts the tokens of a text for a model.
+type TokenCounter interface {
+	CountTokens(text string) int
+}
+
+// CharsTokenCounter estimates the tokens count from the characters count.
+// It is tokenizer agnostic, thus works with any provider.
+type CharsTokenCounter struct {
+	CharsPerToken float64
+}
+
+var _ TokenCounter = CharsTokenCounter{}
+
+func (c CharsTokenCounter) CountTokens(text string) int {
+	charsPerToken := c.CharsPerToken
+	if charsPerToken <= 0 {
+		charsPerToken = defaultCharsPerToken
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / charsPerToken))
+}
+
+// tokenBudget shares the context window of the model between the parts of a request.
+// The system prompt and the question are always kept, the question being truncated if needed.
+// The most recent history messages get up to historyShare of what's left, the chunks get the rest
+// in rank order, then the older messages take the remaining space.
+type tokenBudget struct {
+	counter        TokenCounter
+	contextWindow  int
+	reservedOutput int
+	historyShare   float64
+}
+
+// budgetReport is the split of the context window between the request parts, in tokens.
+type budgetReport struct {
+	ContextWindow     int  `json:"contextWindow"`
+	ReservedOutput    int  `json:"reservedOutput"`
+	System            int  `json:"system"`
+	Question          int  `json:"question"`
+	History           int  `json:"history"`
+	Chunks            int  `json:"chunks"`
+	Free              int  `json:"free"`
+	DroppedMessages   int  `json:"droppedMessages,omitempty"`
+	DroppedChunks     int  `json:"droppedChunks,omitempty"`
+	TruncatedChunks   int  `json:"truncatedChunks,omitempty"`
+	QuestionTruncated bool `json:"questionTruncated,omitempty"`
+}
+
+// budgetAllocation holds what fits in the context window. Only the report is traced.
+type budgetAllocation struct {
+	Report  budgetReport `json:"report"`
+	prompt  string
+	history []*ai.Message
+	docs    []*ai.Document
+}
+
+// tokenBudget returns the budget of the completion model.
+func (a *Agent) tokenBudget() *tokenBudget {
+	b := &tokenBudget{
+		counter:        CharsTokenCounter{CharsPerToken: a.cfg.CharsPerToken},
+		contextWindow:  a.cfg.ContextWindow,
+		reservedOutput: a.cfg.ReservedOutputTokens,
+		historyShare:   a.cfg.HistoryBudgetShare,
+	}
+	if b.contextWindow <= 0 {
+		b.contextWindow = contextWindowOf(a.cfg.CompletionModel)
+	}
+	if b.reservedOutput <= 0 {
+		b.reservedOutput = defaultReservedOutputTokens
+	}
+	if b.historyShare <= 0 || b.historyShare > 1 {
+		b.historyShare = defaultHistoryBudgetShare
+	}
+	return b
+}
+
+func contextWindowOf(modelRef string) int {
+	_, model, err := pkg.ParseModelRef(modelRef)
+	if err != nil {
+		return defaultContextWindow
+	}
+	if size, ok := knownContextWindows[model]; ok {
+		return size
+	}
+	return defaultContextWindow
+}
+
+func (b *tokenBudget) allocate(
+	system, prompt string,
+	history []*ai.Message,
+	docs []*ai.Document,
+) (budgetAllocation, error) {
+	report := budgetReport{
+		ContextWindow:  b.contextWindow,
+		ReservedOutput: b.reservedOutput,
+	}
+	available := b.contextWindow - b.reservedOutput
+
+	report.System = b.textCost(system)
+	if report.System+messageOverheadTokens >= available {
+		return budgetAllocation{}, fmt.Errorf("the system prompt takes %d tokens, more than the %d available",
+			report.System, available)
+	}
+	available -= report.System
+
+	report.Question = b.textCost(prompt)
+	if report.Question > available {
+		prompt = b.truncate(prompt, available-messageOverheadTokens)
+		report.Question = b.textCost(prompt)
+		report.QuestionTruncated = true
+	}
+	available -= report.Question
+
+	// The most recent messages first, within their share.
+	historyCap := int(float64(available) * b.historyShare)
+	kept := len(history)
+	for kept > 0 {
+		cost := b.textCost(history[kept-1].Text())
+		if report.History+cost > historyCap {
+			break
+		}
+		report.History += cost
+		kept--
+	}
+	available -= report.History
+
+	keptDocs, chunksCost, truncated := b.fitDocuments(docs, available)
+	report.Chunks = chunksCost
+	available -= chunksCost
+	if truncated {
+		report.TruncatedChunks++
+	}
+	report.DroppedChunks = len(docs) - len(keptDocs)
+
+	// Then the older messages, with the space the chunks left.
+	for kept > 0 {
+		cost := b.textCost(history[kept-1].Text())
+		if cost > available {
+			break
+		}
+		report.History += cost
+		available -= cost
+		kept--
+	}
+	report.DroppedMessages = kept
+	report.Free = available
+
+	return budgetAllocation{
+		Report:  report,
+		prompt:  prompt,
+		history: history[kept:],
+		docs:    keptDocs,
+	}, nil
+}
+
+// fitDocuments keeps the documents fitting in the available tokens, in rank order.
+// The first one that does not fit is truncated when the remaining space is worth it, the next ones are dropped.
+// It returns the kept documents, their cost and whether the last one is truncated.
+func (b *tokenBudget) fitDocuments(docs []*ai.Document, available int) ([]*ai.Document, int, bool) {
+	kept := make([]*ai.Document, 0, len(docs))
+	total := 0
+	for _, doc := range docs {
+		text := pkg.ContentToText(doc.Content)
+		cost := b.textCost(text)
+		if cost <= available-total {
+			kept = append(kept, doc)
+			total += cost
+			continue
+		}
+		if available-total-messageOverheadTokens < minTruncatedChunkTokens {
+			break
+		}
+		truncated := b.truncate(text, available-total-messageOverheadTokens)
+		kept = append(kept, ai.DocumentFromText(truncated, doc.Metadata))
+		return kept, total + b.textCost(truncated), true
+	}
+	return kept, total, false
+}
+
+// toolOutputTokens is the most a tool result may take in the context window.
+func (b *tokenBudget) toolOutputTokens() int {
+	return int(float64(b.contextWindow-b.reservedOutput) * toolOutputBudgetShare)
+}
+
+func (b *tokenBudget) textCost(text string) int {
+	return b.counter.CountTokens(text) + messageOverheadTokens
+}
+
+// truncate returns the longest beginning of the text fitting in maxTokens, ended with an ellipsis.
+func (b *tokenBudget) truncate(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	if b.counter.CountTokens(text) <= maxTokens {
+		return text
+	}
+
+	runes := []rune(text)
+	low, high := 0, len(runes)
+	for low < high {
+		mid := (low + high + 1) / 2
+		if b.counter.CountTokens(string(runes[:mid])+"…") <= maxTokens {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:low]), func(r rune) bool { return r == ' ' || r == '\n' }) + "…"
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+func newTestBudget(contextWindow int) *tokenBudget {
+	return &tokenBudget{
+		counter:        CharsTokenCounter{CharsPerToken: 1},
+		contextWindow:  contextWindow,
+		reservedOutput: 10,
+		historyShare:   0.5,
+	}
+}
+
+func Test_tokenBudget_allocate_ShouldKeepEverythingWhenItFits(t *testing.T) {
+	// Given
+	budget := newTestBudget(1000)
+	history := []*ai.Message{ai.NewUserTextMessage("hello"), ai.NewModelTextMessage("hi")}
+	docs := []*ai.Document{ai.DocumentFromText("chunk", nil)}
+
+	// When
+	res, err := budget.allocate("system", "question", history, docs)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "question", res.prompt)
+	assert.Len(t, res.history, 2)
+	assert.Len(t, res.docs, 1)
+	assert.Equal(t, budgetReport{
+		ContextWindow:  1000,
+		ReservedOutput: 10,
+		System:         10,
+		Question:       12,
+		History:        15,
+		Chunks:         9,
+		Free:           944,
+	}, res.Report)
+}
+
+func Test_tokenBudget_allocate_ShouldDropOldestMessagesAndLowestRankedChunks(t *testing.T) {
+	// Given
+	budget := newTestBudget(150)
+	history := []*ai.Message{
+		ai.NewUserTextMessage(strings.Repeat("a", 30)),
+		ai.NewModelTextMessage(strings.Repeat("b", 30)),
+		ai.NewUserTextMessage(strings.Repeat("c", 30)),
+	}
+	docs := []*ai.Document{
+		ai.DocumentFromText(strings.Repeat("1", 30), nil),
+		ai.DocumentFromText(strings.Repeat("2", 30), nil),
+		ai.DocumentFromText(strings.Repeat("3", 30), nil),
+	}
+
+	// When
+	res, err := budget.allocate("system", "question", history, docs)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, res.history, 1)
+	assert.Equal(t, strings.Repeat("c", 30), res.history[0].Text())
+	require.Len(t, res.docs, 2)
+	assert.Equal(t, strings.Repeat("1", 30), pkg.ContentToText(res.docs[0].Content))
+	assert.Equal(t, 2, res.Report.DroppedMessages)
+	assert.Equal(t, 1, res.Report.DroppedChunks)
+	assert.LessOrEqual(t,
+		res.Report.System+res.Report.Question+res.Report.History+res.Report.Chunks+res.Report.Free,
+		150-10)
+}
+
+func Test_tokenBudget_allocate_ShouldTruncateChunkThatPartiallyFits(t *testing.T) {
+	// Given
+	budget := newTestBudget(200)
+	docs := []*ai.Document{
+		ai.DocumentFromText(strings.Repeat("word ", 100), map[string]any{"id": "1"}),
+	}
+
+	// When
+	res, err := budget.allocate("system", "question", nil, docs)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, res.docs, 1)
+	assert.Equal(t, 1, res.Report.TruncatedChunks)
+	assert.True(t, strings.HasSuffix(pkg.ContentToText(res.docs[0].Content), "…"))
+	assert.Equal(t, "1", res.docs[0].Metadata["id"])
+	assert.GreaterOrEqual(t, res.Report.Free, 0)
+}
+
+func Test_tokenBudget_allocate_ShouldTruncateQuestionTooLong(t *testing.T) {
+	// Given
+	budget := newTestBudget(100)
+
+	// When
+	res, err := budget.allocate("system", strings.Repeat("q", 200), nil, nil)
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, res.Report.QuestionTruncated)
+	assert.Less(t, len(res.prompt), 200)
+	assert.Equal(t, 0, res.Report.Free)
+}
+
+func Test_tokenBudget_allocate_ShouldFailWhenSystemPromptDoesNotFit(t *testing.T) {
+	// Given
+	budget := newTestBudget(50)
+
+	// When
+	_, err := budget.allocate(strings.Repeat("s", 50), "question", nil, nil)
+
+	// Then
+	assert.Error(t, err)
+}
@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+const (
+	ChunkContextOff       = "off"
+	ChunkContextHeaders   = "headers"
+	ChunkContextSituating = "headers+situating"
+
+	// chunkContextMetadataKey is the book metadata key recording how its chunks were contextualized.
+	chunkContextMetadataKey = domain.MetadataChunkContext
+	// situatingMetadataKey is the chunk metadata key holding its generated situating sentence.
+	situatingMetadataKey = "situating_context"
+
+	// maxSituatingChapterChars caps the chapter text sent along with each chunk to situate it.
+	maxSituatingChapterChars = 24000
+)
+
+// ChunkContextConfig prefixes the text embedded for each chunk with where it comes from,
+// so that a chunk like "It returns an error in that case." is still found by its subject.
+// The content of the chunks, displayed and cited, is left unchanged.
+type ChunkContextConfig struct {
+	// Enabled prefixes the book title, its author and the heading path of the chunk.
+	Enabled bool
+	// Situate also prefixes a sentence generated by the model to situate the chunk within its chapter.
+	// It costs one completion call per chunk, unless found in the chunk context cache.
+	Situate bool
+	// Model generates the situating sentences, the completion model when empty.
+	Model string
+}
+
+// Mode names the configuration, as recorded in the metadata of the indexed books and in the evaluation reports.
+func (c ChunkContextConfig) Mode() string {
+	switch {
+	case !c.Enabled:
+		return ChunkContextOff
+	case c.Situate:
+		return ChunkContextSituating
+	default:
+		return ChunkContextHeaders
+	}
+}
+
+// chunkHeader writes where the chunk comes from: the book, the sections it is under and, if any,
+// the situating sentence.
+func chunkHeader(book domain.Book, chunk *ai.Document, situating string) string {
+	var header strings.Builder
+
+	header.WriteString("Book: " + book.Title)
+	if book.Author != "" {
+		header.WriteString(" by " + book.Author)
+	}
+	header.WriteString("\n")
+
+	path := metadataToStrings(chunk.Metadata["heading_path"])
+	if len(path) == 0 {
+		if title := metadataToString(chunk.Metadata["chapter_title"]); title != "" {
+			path = []string{title}
+		}
+	}
+	if len(path) > 0 {
+		header.WriteString("Section: " + strings.Join(path, " › ") + "\n")
+	}
+
+	if situating != "" {
+		header.WriteString("Context: " + situating + "\n")
+	}
+	return header.String()
+}
+
+// chapterTexts returns the text of each loaded document by chapter index, the same as SplitDocuments sets.
+func chapterTexts(docs []*ai.Document) map[int]string {
+	chapters := make(map[int]string, len(docs))
+	for i, doc := range docs {
+		idx, ok := doc.Metadata["chapter_index"].(int)
+		if !ok {
+			idx = i
+		}
+		chapters[idx] = pkg.ContentToText(doc.Content)
+	}
+	return chapters
+}
+
+// embeddingInputs returns the documents to embed for the chunks of a batch: the chunks themselves
+// when the chunk context is disabled, otherwise copies of them prefixed by their header.
+// The generated situating sentences are also kept in the metadata of the chunks, to be stored with them.
+func (a *Agent) embeddingInputs(
+	ctx context.Context,
+	book domain.Book,
+	chapters map[int]string,
+	chunks []*ai.Document,
+) ([]*ai.Document, error) {
+	if !a.cfg.ChunkContext.Enabled {
+		return chunks, nil
+	}
+
+	situatings := make([]string, len(chunks))
+	if a.cfg.ChunkContext.Situate {
+		var err error
+		if situatings, err = a.situateChunks(ctx, book, chapters, chunks); err != nil {
+			return nil, err
+		}
+	}
+
+	inputs := make([]*ai.Document, len(chunks))
+	for i, chunk := range chunks {
+		if a.cfg.ChunkContext.Situate {
+			chunk.Metadata[situatingMetadataKey] = situatings[i]
+		}
+		content := pkg.ContentToText(chunk.Content)
+		inputs[i] = ai.DocumentFromText(chunkHeader(book, chunk, situatings[i])+"\n"+content, chunk.Metadata)
+	}
+	return inputs, nil
+}
+
+// situateChunks returns the situating sentence of each chunk, in the same order.
+// When a cache is given, the sentences already generated by the same model for the same chunk
+// of the same chapter are reused, the other ones are generated then cached.
+// A failing cache is logged and bypassed, it never fails the indexing.
+func (a *Agent) situateChunks(
+	ctx context.Context,
+	book domain.Book,
+	chapters map[int]string,
+	chunks []*ai.Document,
+) ([]string, error) {
+	model := a.situatingModel()
+
+	hashes := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		chapterIdx, _ := chunk.Metadata["chapter_index"].(int)
+		hashes[i] = situatingHash(book, chapters[chapterIdx], pkg.ContentToText(chunk.Content))
+	}
+
+	cached := map[string]string{}
+	if a.chunkContextCache != nil {
+		found, err := a.chunkContextCache.Get(ctx, model, hashes)
+		if err != nil {
+			pkg.Logger.Printf("Failed to read the chunk context cache, situating all the chunks: %s\n", err)
+		} else {
+			cached = found
+		}
+	}
+
+	situatings := make([]string, len(chunks))
+	generated := make(map[string]string)
+	for i, chunk := range chunks {
+		if situating, ok := cached[hashes[i]]; ok {
+			situatings[i] = situating
+			continue
+		}
+		if situating, ok := generated[hashes[i]]; ok {
+			situatings[i] = situating
+			continue
+		}
+
+		chapterIdx, _ := chunk.Metadata["chapter_index"].(int)
+		situating, err := a.situateChunk(ctx, book, chapters[chapterIdx], pkg.ContentToText(chunk.Content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to situate chunk %d of chapter %d: %w",
+				chunk.Metadata["position"], chapterIdx, err)
+		}
+		situatings[i] = situating
+		generated[hashes[i]] = situating
+	}
+
+	if a.chunkContextCache != nil {
+		if err := a.chunkContextCache.Put(ctx, model, generated); err != nil {
+			pkg.Logger.Printf("Failed to write the chunk context cache: %s\n", err)
+		}
+	}
+	return situatings, nil
+}
+
+// situatingHash is the key of the chunk context cache: the situating prompt only depends on the book,
+// the chapter and the chunk.
+func situatingHash(book domain.Book, chapter, chunk string) string {
+	return contentHash(book.Title + "\n" + book.Author + "\n" + contentHash(chapter) + "\n" + contentHash(chunk))
+}
+
+// situatingModel returns the model generating the situating sentences.
+func (a *Agent) situatingModel() string {
+	if a.cfg.ChunkContext.Model != "" {
+		return a.cfg.ChunkContext.Model
+	}
+	return a.cfg.CompletionModel
+}
+
+// situateChunk asks the model for a short sentence situating the chunk within its chapter.
+func (a *Agent) situateChunk(ctx context.Context, book domain.Book, chapter, chunk string) (string, error) {
+	if len(chapter) > maxSituatingChapterChars {
+		end := maxSituatingChapterChars
+		for end > 0 && !utf8.RuneStart(chapter[end]) {
+			end--
+		}
+		chapter = chapter[:end]
+	}
+
+	prompt, err := a.renderPrompt(ctx,
+		promptCall{name: chunkContextSystemPromptName},
+		promptCall{name: chunkContextUserPromptName, input: map[string]any{
+			"title":   book.Title,
+			"author":  book.Author,
+			"chapter": chapter,
+			"chunk":   chunk,
+		}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	situating, err := genkit.GenerateText(ctx, a.g,
+		ai.WithSystem(prompt.System),
+		ai.WithPrompt(prompt.Prompt),
+		ai.WithModelName(a.situatingModel()),
+	)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(situating), " "), nil
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/agent/provider/fake"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+type memoryChunkContextCache struct {
+	entries map[string]string
+}
+
+func (c *memoryChunkContextCache) Get(ctx context.Context, model string, hashes []string) (map[string]string, error) {
+	found := make(map[string]string)
+	for _, hash := range hashes {
+		if s, ok := c.entries[model+hash]; ok {
+			found[hash] = s
+		}
+	}
+	return found, nil
+}
+
+func (c *memoryChunkContextCache) Put(ctx context.Context, model string, sentences map[string]string) error {
+	for hash, s := range sentences {
+		c.entries[model+hash] = s
+	}
+	return nil
+}
+
+func (c *memoryChunkContextCache) Prune(ctx context.Context, unusedSince time.Time) (int64, error) {
+	return 0, nil
+}
+
+func Test_embeddingInputs_ShouldPrefixBookAndHeadings(t *testing.T) {
+	// Given
+	a := &Agent{cfg: Config{ChunkContext: ChunkContextConfig{Enabled: true}}}
+	book := domain.Book{Title: "Concurrency in Go", Author: "Katherine Cox-Buday"}
+	chunks := []*ai.Document{
+		ai.DocumentFromText("It returns an error in that case.", map[string]any{
+			"chapter_title": "Channels",
+			"heading_path":  []string{"Channels", "Closing"},
+		}),
+		ai.DocumentFromText("A short preface.", map[string]any{"chapter_title": "Preface"}),
+	}
+
+	// When
+	inputs, err := a.embeddingInputs(context.Background(), book, nil, chunks)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Book: Concurrency in Go by Katherine Cox-Buday\nSection: Channels › Closing\n\nIt returns an error in that case.",
+		pkg.ContentToText(inputs[0].Content))
+	assert.Equal(t, "Book: Concurrency in Go by Katherine Cox-Buday\nSection: Preface\n\nA short preface.",
+		pkg.ContentToText(inputs[1].Content))
+	assert.Equal(t, "It returns an error in that case.", pkg.ContentToText(chunks[0].Content),
+		"the chunks content should not be modified")
+}
+
+func Test_embeddingInputs_ShouldSituateChunkInChapter(t *testing.T) {
+	// Given
+	a := newFakeAgent(t, Config{ChunkContext: ChunkContextConfig{Enabled: true, Situate: true}},
+		fake.Fixture{Match: "it returns an error", Answer: " Sending on a closed channel \n panics. "})
+	chapters := map[int]string{3: "# Channels\nClosing a channel... It returns an error in that case."}
+	chunks := []*ai.Document{
+		ai.DocumentFromText("It returns an error in that case.", map[string]any{"chapter_index": 3}),
+	}
+
+	// When
+	inputs, err := a.embeddingInputs(context.Background(), domain.Book{Title: "Concurrency in Go"}, chapters, chunks)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Book: Concurrency in Go\nContext: Sending on a closed channel panics.\n\nIt returns an error in that case.",
+		pkg.ContentToText(inputs[0].Content))
+	assert.Equal(t, "Sending on a closed channel panics.", chunks[0].Metadata[situatingMetadataKey])
+}
+
+func Test_embeddingInputs_ShouldReuseCachedSituatingSentences(t *testing.T) {
+	// Given
+	a := newFakeAgent(t, Config{ChunkContext: ChunkContextConfig{Enabled: true, Situate: true}},
+		fake.Fixture{Match: "it panics", Answer: "Sending on a closed channel panics."})
+	book := domain.Book{Title: "Concurrency in Go"}
+	chapters := map[int]string{3: "# Channels\nClosing a channel... It returns an error in that case. It panics."}
+	cache := &memoryChunkContextCache{entries: map[string]string{
+		"fake/completion" + situatingHash(book, chapters[3], "It returns an error in that case."): "Closing twice fails.",
+	}}
+	a.chunkContextCache = cache
+	chunks := []*ai.Document{
+		ai.DocumentFromText("It returns an error in that case.", map[string]any{"chapter_index": 3}),
+		ai.DocumentFromText("It panics.", map[string]any{"chapter_index": 3}),
+	}
+
+	// When
+	inputs, err := a.embeddingInputs(context.Background(), book, chapters, chunks)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Book: Concurrency in Go\nContext: Closing twice fails.\n\nIt returns an error in that case.",
+		pkg.ContentToText(inputs[0].Content))
+	assert.Equal(t, "Book: Concurrency in Go\nContext: Sending on a closed channel panics.\n\nIt panics.",
+		pkg.ContentToText(inputs[1].Content))
+	assert.Equal(t, "Sending on a closed channel panics.",
+		cache.entries["fake/completion"+situatingHash(book, chapters[3], "It panics.")])
+}
+
+func Test_indexDocuments_ShouldStoreChunksWithoutTheirContext(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	g, err := genkit.Init(ctx, genkit.WithPlugins(fake.NewPlugin()))
+	require.NoError(t, err)
+	store := &memoryVectorStore{}
+	a := &Agent{
+		cfg: Config{
+			EmbeddingModel: "fake/embed",
+			ChunkContext:   ChunkContextConfig{Enabled: true},
+		},
+		embedder:        genkit.LookupEmbedder(g, "fake", "embed"),
+		bookVectorStore: store,
+	}
+	docs := []*ai.Document{ai.DocumentFromText("It returns an error in that case.", nil)}
+
+	// When
+	_, err = a.indexDocuments(ctx, domain.Book{ID: "1", Title: "Concurrency in Go"}, docs)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []string{"It returns an error in that case."}, store.parts)
+}
+
+func Test_indexingFingerprint_ShouldChangeWithChunkContext(t *testing.T) {
+	// Given
+	batches := [][]*ai.Document{{ai.DocumentFromText("A chunk.", nil)}}
+
+	// When
+	off := indexingFingerprint("fake/embed", ChunkContextOff, batches)
+	headers := indexingFingerprint("fake/embed", ChunkContextHeaders, batches)
+
+	// Then
+	assert.NotEqual(t, off, headers)
+}
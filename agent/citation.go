@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+const (
+	excerptMaxLength = 200
+
+	// citationsMetadataKey is the assistant message metadata key holding its citations.
+	citationsMetadataKey = "citations"
+)
+
+// CitationsFromMessage returns the citations attached to an assistant message, if any.
+func CitationsFromMessage(msg *ai.Message) []domain.Citation {
+	citations, _ := msg.Metadata[citationsMetadataKey].([]domain.Citation)
+	return citations
+}
+
+// citationsFromDocuments builds one citation per retrieved document.
+func citationsFromDocuments(docs []*ai.Document) []domain.Citation {
+	citations := make([]domain.Citation, 0, len(docs))
+	for _, doc := range docs {
+		bookTitle, _ := doc.Metadata["book_title"].(string)
+		chapterTitle, _ := doc.Metadata["chapter_title"].(string)
+		citations = append(citations, domain.Citation{
+			BookID:       metadataToString(doc.Metadata["book_id"]),
+			BookTitle:    bookTitle,
+			ChapterTitle: chapterTitle,
+			HeadingPath:  metadataToStrings(doc.Metadata["heading_path"]),
+			ChunkID:      metadataToString(doc.Metadata["id"]),
+			Excerpt:      excerpt(citedText(doc), excerptMaxLength),
+		})
+	}
+	return citations
+}
+
+// citedText returns the text of the retrieved chunk, without the neighbors it may have been expanded with.
+func citedText(doc *ai.Document) string {
+	if content, ok := doc.Metadata[chunkContentMetadataKey].(string); ok {
+		return content
+	}
+	return pkg.ContentToText(doc.Content)
+}
+
+func metadataToString(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// metadataToInt reads an integer, which becomes a float64 once stored as JSON.
+func metadataToInt(v any) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	default:
+		return 0
+	}
+}
+
+// metadataToStrings reads a list of strings, which becomes a list of any once stored as JSON.
+func metadataToStrings(v any) []string {
+	switch values := v.(type) {
+	case []string:
+		return values
+	case []any:
+		strs := make([]string, 0, len(values))
+		for _, value := range values {
+			if str, ok := value.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+		return strs
+	default:
+		return nil
+	}
+}
+
+// excerpt returns the beginning of the text, cut on a word boundary when it exceeds maxLength runes.
+func excerpt(text string, maxLength int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	cut := string(runes[:maxLength])
+	if idx := strings.LastIndex(cut, " "); idx > 0 {
+		cut = cut[:idx]
+	}
+	return cut + "…"
+}
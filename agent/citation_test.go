@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+func Test_citationsFromDocuments_ShouldMapRetrievedMetadata(t *testing.T) {
+	// Given
+	docs := []*ai.Document{
+		ai.DocumentFromText("Channels are the pipes that connect concurrent goroutines.", map[string]any{
+			"id":            uint(42),
+			"book_id":       uint(3),
+			"book_title":    "Concurrency in Go",
+			"chapter_title": "Channels",
+			"heading_path":  []any{"Channels", "Buffered channels"},
+		}),
+	}
+
+	// When
+	res := citationsFromDocuments(docs)
+
+	// Then
+	assert.Equal(t, []domain.Citation{
+		{
+			BookID:       "3",
+			BookTitle:    "Concurrency in Go",
+			ChapterTitle: "Channels",
+			HeadingPath:  []string{"Channels", "Buffered channels"},
+			ChunkID:      "42",
+			Excerpt:      "Channels are the pipes that connect concurrent goroutines.",
+		},
+	}, res)
+}
+
+func Test_excerpt_ShouldCutLongTextOnWordBoundary(t *testing.T) {
+	// Given
+	text := strings.Repeat("word ", 100)
+
+	// When
+	res := excerpt(text, 22)
+
+	// Then
+	assert.Equal(t, "word word word word…", res)
+}
+
+func Test_metadataToInt_ShouldReadStoredAndJSONDecodedIndexes(t *testing.T) {
+	// Given
+	stored := map[string]any{"chapter_index": 4}
+	decoded := map[string]any{"chapter_index": float64(4)}
+
+	// When & Then
+	assert.Equal(t, 4, metadataToInt(stored["chapter_index"]))
+	assert.Equal(t, 4, metadataToInt(decoded["chapter_index"]))
+	assert.Equal(t, 0, metadataToInt(nil))
+}
@@ -1,20 +1,87 @@
 package agent
 
-import "time"
+import "github.com/thomas-marquis/goLLMan/agent/provider"
+
+const (
+	// ChatModeRAG retrieves the documents then generates the answer from them.
+	ChatModeRAG = "rag"
+	// ChatModeAgent lets the model call the library tools in a loop before answering.
+	ChatModeAgent = "agent"
+
+	// MemoryStrategyTrim discards the messages going over the session limit.
+	MemoryStrategyTrim = "trim"
+	// MemoryStrategySummary folds the messages going over the session limit into a running summary.
+	MemoryStrategySummary = "summary"
+)
 
 type Config struct {
-	SessionID           string
-	Verbose             bool
+	SessionID string
+	Verbose   bool
+	// SessionMessageLimit caps the number of messages kept in a session, 0 keeps them all.
+	// The history actually sent to the model is bounded by the token budget.
 	SessionMessageLimit int
+	// MemoryStrategy is either MemoryStrategyTrim (default) or MemoryStrategySummary.
+	// MemoryStrategySummary requires a SessionMessageLimit, as only the messages going over it are summarized.
+	MemoryStrategy string
+	// SummaryModel writes the conversation summary, CompletionModel when empty.
+	SummaryModel string
+
+	// ContextWindow is the size of the completion model context window, in tokens.
+	// When 0, it is guessed from the model name.
+	ContextWindow int
+	// ReservedOutputTokens is the part of the context window kept for the answer.
+	ReservedOutputTokens int
+	// HistoryBudgetShare is the share of the context window, once the system prompt and the question
+	// are counted, given to the most recent messages before the retrieved chunks.
+	HistoryBudgetShare float64
+	// CharsPerToken is used to estimate the tokens count of a text.
+	CharsPerToken float64
+
+	// ChatMode is either ChatModeRAG (default) or ChatModeAgent.
+	ChatMode string
+	// AgentMaxSteps caps the number of tool calling turns in the agent chat mode.
+	AgentMaxSteps int
 
+	// EmbeddingVectorSize is the size of the vectors the book vector store holds.
+	// The embedding model is checked to return vectors of this size at startup, unless it is 0.
 	EmbeddingVectorSize int
+	// IndexingWorkers is the number of batches embedded concurrently while indexing a book.
+	// Their requests, and the situating ones, are spaced out by the MaxRequestsPerSecond of their provider.
+	IndexingWorkers int
+	// Splitter tells how the books are split into chunks. It is recorded in the metadata of each indexed book.
+	Splitter SplitterConfig
+	// ChunkContext prefixes the text embedded for each chunk with its book, its headings and optionally
+	// a generated situating sentence. It is recorded in the metadata of each indexed book.
+	ChunkContext ChunkContextConfig
 
 	RetrievalLimit int
+	// NeighborChunks is the number of chunks before and after each retrieved chunk joined to it,
+	// so that the model reads it in its context. 0 disables the expansion.
+	NeighborChunks int
 
-	MistralApiKey               string
-	MistralMaxRequestsPerSecond int
-	MistralTimeout              time.Duration
+	// QueryRewriteHistory is the number of last session messages used to rewrite a follow-up question
+	// into a standalone search query. 0 disables the rewriting.
+	QueryRewriteHistory int
+
+	// RetrievalMode is either "vector" (default) or "hybrid".
+	RetrievalMode string
+	// HybridVectorWeight and HybridLexicalWeight weight each ranking fused in the hybrid retrieval mode.
+	HybridVectorWeight  float64
+	HybridLexicalWeight float64
+
+	// RerankerModel enables the LLM based reranking of retrieved documents when not empty.
+	RerankerModel string
+	// RerankCandidates is the number of documents fetched before reranking, only RetrievalLimit of them are kept.
+	RerankCandidates int
+
+	// Providers serve the models referenced as "<provider name>/<model name>".
+	// The completion and embedding models may come from different providers.
+	Providers []provider.Config
 
 	CompletionModel string
 	EmbeddingModel  string
+
+	// PromptDir is the directory of the .prompt files, DefaultPromptDir when empty.
+	// Point it to a copy of the prompts directory to customize them per deployment.
+	PromptDir string
 }
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+// EmbeddingCacheStats counts the chunks found in the embedding cache and the ones embedded.
+type EmbeddingCacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+func (s EmbeddingCacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func (s *EmbeddingCacheStats) add(other EmbeddingCacheStats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+}
+
+// contentHash returns the hex encoded SHA-256 hash of the text, the key of the embedding cache.
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// embedDocuments returns the vectors of the documents, in the same order.
+// When a cache is given, only the texts missing from it are embedded, once each, then cached.
+// A failing cache is logged and bypassed, it never fails the embedding.
+func embedDocuments(
+	ctx context.Context,
+	embedder ai.Embedder,
+	cache domain.EmbeddingCache,
+	model string,
+	docs []*ai.Document,
+) ([][]float32, EmbeddingCacheStats, error) {
+	var stats EmbeddingCacheStats
+	vectors := make([][]float32, len(docs))
+
+	hashes := make([]string, len(docs))
+	for i, doc := range docs {
+		hashes[i] = contentHash(pkg.ContentToText(doc.Content))
+	}
+
+	cached := map[string][]float32{}
+	if cache != nil {
+		found, err := cache.Get(ctx, model, hashes)
+		if err != nil {
+			pkg.Logger.Printf("Failed to read the embedding cache, embedding all the documents: %s\n", err)
+		} else {
+			cached = found
+		}
+	}
+
+	// Each missing text is embedded once, even when it appears several times
+	missing := make([]*ai.Document, 0, len(docs))
+	missingIdx := make(map[string]int)
+	for i, doc := range docs {
+		if vector, ok := cached[hashes[i]]; ok {
+			vectors[i] = vector
+			stats.Hits++
+			continue
+		}
+		stats.Misses++
+		if _, ok := missingIdx[hashes[i]]; !ok {
+			missingIdx[hashes[i]] = len(missing)
+			missing = append(missing, doc)
+		}
+	}
+	if len(missing) == 0 {
+		return vectors, stats, nil
+	}
+
+	embedRes, err := ai.Embed(ctx, embedder, ai.WithDocs(missing...))
+	if err != nil {
+		return nil, stats, fmt.Errorf("failed to embed documents: %w", err)
+	}
+	if len(embedRes.Embeddings) != len(missing) {
+		return nil, stats, fmt.Errorf("the embedder returned %d vectors for %d documents",
+			len(embedRes.Embeddings), len(missing))
+	}
+
+	embedded := make(map[string][]float32, len(missing))
+	for hash, idx := range missingIdx {
+		embedded[hash] = embedRes.Embeddings[idx].Embedding
+	}
+	for i := range docs {
+		if vectors[i] == nil {
+			vectors[i] = embedded[hashes[i]]
+		}
+	}
+
+	if cache != nil {
+		if err := cache.Put(ctx, model, embedded); err != nil {
+			pkg.Logger.Printf("Failed to write the embedding cache: %s\n", err)
+		}
+	}
+	return vectors, stats, nil
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryEmbeddingCache struct {
+	entries map[string][]float32
+}
+
+func (c *memoryEmbeddingCache) Get(ctx context.Context, model string, hashes []string) (map[string][]float32, error) {
+	found := make(map[string][]float32)
+	for _, hash := range hashes {
+		if v, ok := c.entries[model+hash]; ok {
+			found[hash] = v
+		}
+	}
+	return found, nil
+}
+
+func (c *memoryEmbeddingCache) Put(ctx context.Context, model string, vectors map[string][]float32) error {
+	for hash, v := range vectors {
+		c.entries[model+hash] = v
+	}
+	return nil
+}
+
+func (c *memoryEmbeddingCache) Prune(ctx context.Context, unusedSince time.Time) (int64, error) {
+	return 0, nil
+}
+
+func Test_embedDocuments_ShouldEmbedOnlyCacheMisses(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	g, err := genkit.Init(ctx)
+	require.NoError(t, err)
+	var embedded []string
+	embedder := genkit.DefineEmbedder(g, "test", "embed", func(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		resp := &ai.EmbedResponse{}
+		for _, doc := range req.Input {
+			embedded = append(embedded, doc.Content[0].Text)
+			resp.Embeddings = append(resp.Embeddings, &ai.Embedding{Embedding: []float32{float32(len(doc.Content[0].Text))}})
+		}
+		return resp, nil
+	})
+	cache := &memoryEmbeddingCache{entries: map[string][]float32{
+		"test/embed" + contentHash("cached"): {42},
+	}}
+	docs := []*ai.Document{
+		ai.DocumentFromText("cached", nil),
+		ai.DocumentFromText("new", nil),
+		ai.DocumentFromText("new", nil),
+	}
+
+	// When
+	vectors, stats, err := embedDocuments(ctx, embedder, cache, "test/embed", docs)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{42}, {3}, {3}}, vectors)
+	assert.Equal(t, []string{"new"}, embedded)
+	assert.Equal(t, EmbeddingCacheStats{Hits: 1, Misses: 2}, stats)
+	assert.InDelta(t, 1.0/3, stats.HitRatio(), 1e-9)
+
+	// When indexing the same chunks again
+	embedded = nil
+	_, stats, err = embedDocuments(ctx, embedder, cache, "test/embed", docs)
+
+	// Then
+	require.NoError(t, err)
+	assert.Empty(t, embedded)
+	assert.Equal(t, EmbeddingCacheStats{Hits: 3}, stats)
+}
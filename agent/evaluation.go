@@ -0,0 +1,418 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// passageMatchThreshold is the share of the words of the expected passage a chunk must contain,
+	// or of the chunk words the passage must contain, to be counted as the expected passage.
+	passageMatchThreshold = 0.8
+
+	evalSessionPrefix = "eval-"
+)
+
+// EvalCase is a question of an evaluation dataset along with what it is expected to retrieve and answer.
+type EvalCase struct {
+	ID       string `json:"id,omitempty" yaml:"id"`
+	Question string `json:"question" yaml:"question"`
+	// Book is the ID or the title of the book holding the answer.
+	Book string `json:"book" yaml:"book"`
+	// Passage is an excerpt of the book the retrieved chunks must contain, optional.
+	Passage string `json:"passage,omitempty" yaml:"passage"`
+	// Answer is the reference answer given to the judge, optional.
+	Answer string `json:"answer,omitempty" yaml:"answer"`
+}
+
+type evalDatasetFile struct {
+	Cases []EvalCase `yaml:"cases"`
+}
+
+// LoadEvalDataset reads the cases of a JSONL file, one case per line, or of a YAML file like:
+//
+//	cases:
+//	  - id: fantine
+//	    question: Who is Cosette's mother?
+//	    book: Les Misérables
+//	    passage: Fantine was one of those beings who blossom
+//	    answer: Fantine.
+//
+// Cases without ID are numbered in the dataset order.
+func LoadEvalDataset(path string) ([]EvalCase, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dataset %s: %w", path, err)
+	}
+
+	var cases []EvalCase
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl":
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var c EvalCase
+			if err := json.Unmarshal([]byte(text), &c); err != nil {
+				return nil, fmt.Errorf("failed to parse dataset %s line %d: %w", path, line, err)
+			}
+			cases = append(cases, c)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read dataset %s: %w", path, err)
+		}
+	case ".yaml", ".yml":
+		var f evalDatasetFile
+		if err := yaml.Unmarshal(content, &f); err != nil {
+			return nil, fmt.Errorf("failed to parse dataset %s: %w", path, err)
+		}
+		cases = f.Cases
+	default:
+		return nil, fmt.Errorf("unsupported dataset format %s, expected .jsonl, .yaml or .yml", path)
+	}
+
+	for i := range cases {
+		if strings.TrimSpace(cases[i].Question) == "" {
+			return nil, fmt.Errorf("case %d of dataset %s has no question", i+1, path)
+		}
+		if cases[i].ID == "" {
+			cases[i].ID = fmt.Sprintf("%03d", i+1)
+		}
+	}
+	return cases, nil
+}
+
+// EvalOptions tunes an evaluation run.
+type EvalOptions struct {
+	// K is the number of retrieved chunks hit@k and MRR are computed on, RetrievalLimit when 0.
+	K int
+	// BookIDs scopes the retrieval, all the indexed books when empty.
+	BookIDs []string
+	// JudgeModel grades the answers, CompletionModel when empty.
+	JudgeModel string
+	// RetrievalOnly skips the answer generation and its grading.
+	RetrievalOnly bool
+}
+
+// EvalChunk is a retrieved chunk, in rank order.
+type EvalChunk struct {
+	ID        string `json:"id"`
+	BookTitle string `json:"bookTitle"`
+	Chapter   string `json:"chapter,omitempty"`
+	Relevant  bool   `json:"relevant"`
+}
+
+// EvalCaseResult is the outcome of a case. Rank is the 1-based rank of the first relevant chunk, 0 if none.
+// The judge grades range from 1 to 5, 0 meaning the answer was not graded.
+type EvalCaseResult struct {
+	ID             string      `json:"id"`
+	Question       string      `json:"question"`
+	Book           string      `json:"book"`
+	Rank           int         `json:"rank"`
+	Hit            bool        `json:"hit"`
+	ReciprocalRank float64     `json:"reciprocalRank"`
+	Retrieved      []EvalChunk `json:"retrieved"`
+	Answer         string      `json:"answer,omitempty"`
+	Faithfulness   int         `json:"faithfulness,omitempty"`
+	Relevance      int         `json:"relevance,omitempty"`
+	JudgeReason    string      `json:"judgeReason,omitempty"`
+	Error          string      `json:"error,omitempty"`
+}
+
+// EvalSettings records what was evaluated, to tell runs apart.
+type EvalSettings struct {
+	CompletionModel string   `json:"completionModel"`
+	EmbeddingModel  string   `json:"embeddingModel"`
+	RetrievalMode   string   `json:"retrievalMode"`
+	ChunkContext    string   `json:"chunkContext"`
+	RerankerModel   string   `json:"rerankerModel,omitempty"`
+	JudgeModel      string   `json:"judgeModel,omitempty"`
+	K               int      `json:"k"`
+	BookIDs         []string `json:"bookIds"`
+}
+
+// EvalSummary averages the case results. The grades are averaged over the graded cases only.
+type EvalSummary struct {
+	Cases        int     `json:"cases"`
+	Errors       int     `json:"errors"`
+	HitAtK       float64 `json:"hitAtK"`
+	MRR          float64 `json:"mrr"`
+	Graded       int     `json:"graded"`
+	Faithfulness float64 `json:"faithfulness"`
+	Relevance    float64 `json:"relevance"`
+}
+
+type EvalReport struct {
+	Settings EvalSettings     `json:"settings"`
+	Summary  EvalSummary      `json:"summary"`
+	Cases    []EvalCaseResult `json:"cases"`
+}
+
+// evalCaseInput is the input of the evaluation flow, one run per case.
+type evalCaseInput struct {
+	Case       EvalCase `json:"case"`
+	K          int      `json:"k"`
+	BookIDs    []string `json:"bookIds"`
+	JudgeModel string   `json:"judgeModel,omitempty"`
+	// RetrievalOnly skips the answer generation and its grading.
+	RetrievalOnly bool `json:"retrievalOnly,omitempty"`
+}
+
+type evalJudgement struct {
+	Faithfulness int    `json:"faithfulness"`
+	Relevance    int    `json:"relevance"`
+	Reason       string `json:"reason"`
+}
+
+// Evaluate runs the cases one after the other. A failing case is reported with its error
+// and doesn't stop the run.
+func (a *Agent) Evaluate(ctx context.Context, cases []EvalCase, opts EvalOptions) (EvalReport, error) {
+	k := opts.K
+	if k <= 0 {
+		k = a.cfg.RetrievalLimit
+	}
+	judgeModel := opts.JudgeModel
+	if judgeModel == "" {
+		judgeModel = a.cfg.CompletionModel
+	}
+	if opts.RetrievalOnly {
+		judgeModel = ""
+	}
+
+	bookIDs := opts.BookIDs
+	if len(bookIDs) == 0 {
+		books, err := a.bookRepository.List(ctx)
+		if err != nil {
+			return EvalReport{}, fmt.Errorf("failed to list books: %w", err)
+		}
+		for _, book := range books {
+			if book.Status == domain.StatusIndexed {
+				bookIDs = append(bookIDs, book.ID)
+			}
+		}
+	}
+	if len(bookIDs) == 0 {
+		return EvalReport{}, fmt.Errorf("no indexed book to evaluate the retrieval on")
+	}
+
+	report := EvalReport{
+		Settings: EvalSettings{
+			CompletionModel: a.cfg.CompletionModel,
+			EmbeddingModel:  a.cfg.EmbeddingModel,
+			RetrievalMode:   a.cfg.RetrievalMode,
+			ChunkContext:    a.cfg.ChunkContext.Mode(),
+			RerankerModel:   a.cfg.RerankerModel,
+			JudgeModel:      judgeModel,
+			K:               k,
+			BookIDs:         bookIDs,
+		},
+		Cases: make([]EvalCaseResult, 0, len(cases)),
+	}
+
+	for _, c := range cases {
+		res, err := a.evaluationFlow.Run(ctx, evalCaseInput{
+			Case:          c,
+			K:             k,
+			BookIDs:       bookIDs,
+			JudgeModel:    judgeModel,
+			RetrievalOnly: opts.RetrievalOnly,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return EvalReport{}, ctx.Err()
+			}
+			pkg.Logger.Printf("Evaluation case %s failed: %s\n", c.ID, err)
+			res = EvalCaseResult{ID: c.ID, Question: c.Question, Book: c.Book, Error: err.Error()}
+		}
+		report.Cases = append(report.Cases, res)
+	}
+
+	report.Summary = summarizeEval(report.Cases)
+	return report, nil
+}
+
+func (a *Agent) evaluationFlowHandler(ctx context.Context, input evalCaseInput) (EvalCaseResult, error) {
+	c := input.Case
+	res := EvalCaseResult{ID: c.ID, Question: c.Question, Book: c.Book}
+
+	docs, err := genkit.Run(ctx, "retrieveDocuments", func() ([]*ai.Document, error) {
+		return a.retrieveDocuments(ctx, c.Question, input.BookIDs, nil, input.K)
+	})
+	if err != nil {
+		return res, err
+	}
+
+	res.Retrieved = make([]EvalChunk, 0, len(docs))
+	for i, doc := range docs {
+		bookTitle, _ := doc.Metadata["book_title"].(string)
+		chapterTitle, _ := doc.Metadata["chapter_title"].(string)
+		chunk := EvalChunk{
+			ID:        metadataToString(doc.Metadata["id"]),
+			BookTitle: bookTitle,
+			Chapter:   chapterTitle,
+			Relevant:  isRelevantChunk(c, doc),
+		}
+		if chunk.Relevant && res.Rank == 0 {
+			res.Rank = i + 1
+		}
+		res.Retrieved = append(res.Retrieved, chunk)
+	}
+	if res.Rank > 0 {
+		res.Hit = true
+		res.ReciprocalRank = 1 / float64(res.Rank)
+	}
+
+	if input.RetrievalOnly {
+		return res, nil
+	}
+
+	out, err := a.chatbotFlow.Run(ctx, ChatbotInput{
+		Question: c.Question,
+		Session:  evalSessionPrefix + c.ID,
+		BookIDs:  input.BookIDs,
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed to answer the question: %w", err)
+	}
+	res.Answer = out.Answer
+
+	judgement, err := genkit.Run(ctx, "judgeAnswer", func() (evalJudgement, error) {
+		return a.judgeAnswer(ctx, input.JudgeModel, c, docs, out.Answer)
+	})
+	if err != nil {
+		return res, err
+	}
+	res.Faithfulness = clampGrade(judgement.Faithfulness)
+	res.Relevance = clampGrade(judgement.Relevance)
+	res.JudgeReason = judgement.Reason
+
+	return res, nil
+}
+
+func (a *Agent) judgeAnswer(
+	ctx context.Context,
+	model string,
+	c EvalCase,
+	docs []*ai.Document,
+	answer string,
+) (evalJudgement, error) {
+	var passages strings.Builder
+	for i, doc := range docs {
+		fmt.Fprintf(&passages, "## Passage %d\n%s\n\n", i+1, pkg.ContentToText(doc.Content))
+	}
+
+	prompt, err := a.renderPrompt(ctx,
+		promptCall{name: evalJudgeSystemPromptName},
+		promptCall{name: evalJudgeUserPromptName, input: map[string]any{
+			"question":  c.Question,
+			"context":   strings.TrimSpace(passages.String()),
+			"answer":    answer,
+			"reference": c.Answer,
+		}},
+	)
+	if err != nil {
+		return evalJudgement{}, err
+	}
+
+	out, _, err := genkit.GenerateData[evalJudgement](ctx, a.g,
+		ai.WithSystem(prompt.System),
+		ai.WithPrompt(prompt.Prompt),
+		ai.WithModelName(model),
+	)
+	if err != nil {
+		return evalJudgement{}, fmt.Errorf("failed to grade the answer: %w", err)
+	}
+	return *out, nil
+}
+
+// isRelevantChunk tells whether the chunk comes from the expected book and, when given,
+// holds the expected passage or is part of it.
+func isRelevantChunk(c EvalCase, doc *ai.Document) bool {
+	bookID := metadataToString(doc.Metadata["book_id"])
+	bookTitle, _ := doc.Metadata["book_title"].(string)
+	if c.Book != "" && c.Book != bookID && !strings.EqualFold(strings.TrimSpace(c.Book), bookTitle) {
+		return false
+	}
+	if c.Passage == "" {
+		return true
+	}
+
+	chunk := evalWords(pkg.ContentToText(doc.Content))
+	passage := evalWords(c.Passage)
+	return wordsCoverage(passage, chunk) >= passageMatchThreshold ||
+		wordsCoverage(chunk, passage) >= passageMatchThreshold
+}
+
+// wordsCoverage returns the share of the words found in the other text.
+func wordsCoverage(words []string, other []string) float64 {
+	if len(words) == 0 {
+		return 0
+	}
+	set := make(map[string]struct{}, len(other))
+	for _, w := range other {
+		set[w] = struct{}{}
+	}
+	found := 0
+	for _, w := range words {
+		if _, ok := set[w]; ok {
+			found++
+		}
+	}
+	return float64(found) / float64(len(words))
+}
+
+func evalWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func clampGrade(grade int) int {
+	return max(0, min(5, grade))
+}
+
+func summarizeEval(results []EvalCaseResult) EvalSummary {
+	s := EvalSummary{Cases: len(results)}
+	if len(results) == 0 {
+		return s
+	}
+
+	var hits, rr, faithfulness, relevance float64
+	for _, r := range results {
+		if r.Error != "" {
+			s.Errors++
+		}
+		if r.Hit {
+			hits++
+		}
+		rr += r.ReciprocalRank
+		if r.Faithfulness > 0 || r.Relevance > 0 {
+			s.Graded++
+			faithfulness += float64(r.Faithfulness)
+			relevance += float64(r.Relevance)
+		}
+	}
+	s.HitAtK = hits / float64(len(results))
+	s.MRR = rr / float64(len(results))
+	if s.Graded > 0 {
+		s.Faithfulness = faithfulness / float64(s.Graded)
+		s.Relevance = relevance / float64(s.Graded)
+	}
+	return s
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	EvalReportJSONFile     = "report.json"
+	EvalReportMarkdownFile = "report.md"
+)
+
+// WriteEvalReport writes the report in the directory, as JSON and as markdown.
+// Both are free of timestamps so that two runs can be compared with a plain diff.
+func WriteEvalReport(dir string, report EvalReport) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create report directory %s: %w", dir, err)
+	}
+
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, EvalReportJSONFile), append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, EvalReportMarkdownFile), []byte(report.Markdown()), 0o644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// Markdown renders the settings, the summary and one row per case.
+func (r EvalReport) Markdown() string {
+	var sb strings.Builder
+
+	sb.WriteString("# Evaluation report\n\n")
+	sb.WriteString("## Settings\n\n")
+	sb.WriteString("| Setting | Value |\n|---|---|\n")
+	fmt.Fprintf(&sb, "| Completion model | %s |\n", markdownCell(r.Settings.CompletionModel))
+	fmt.Fprintf(&sb, "| Embedding model | %s |\n", markdownCell(r.Settings.EmbeddingModel))
+	fmt.Fprintf(&sb, "| Retrieval mode | %s |\n", markdownCell(r.Settings.RetrievalMode))
+	fmt.Fprintf(&sb, "| Chunk context | %s |\n", markdownCell(r.Settings.ChunkContext))
+	fmt.Fprintf(&sb, "| Reranker model | %s |\n", markdownCell(r.Settings.RerankerModel))
+	fmt.Fprintf(&sb, "| Judge model | %s |\n", markdownCell(r.Settings.JudgeModel))
+	fmt.Fprintf(&sb, "| k | %d |\n", r.Settings.K)
+	fmt.Fprintf(&sb, "| Books | %s |\n", markdownCell(strings.Join(r.Settings.BookIDs, ", ")))
+
+	s := r.Summary
+	sb.WriteString("\n## Summary\n\n")
+	sb.WriteString("| Metric | Value |\n|---|---|\n")
+	fmt.Fprintf(&sb, "| Cases | %d |\n", s.Cases)
+	fmt.Fprintf(&sb, "| Errors | %d |\n", s.Errors)
+	fmt.Fprintf(&sb, "| Hit@%d | %.3f |\n", r.Settings.K, s.HitAtK)
+	fmt.Fprintf(&sb, "| MRR | %.3f |\n", s.MRR)
+	if s.Graded > 0 {
+		fmt.Fprintf(&sb, "| Graded answers | %d |\n", s.Graded)
+		fmt.Fprintf(&sb, "| Faithfulness (1-5) | %.2f |\n", s.Faithfulness)
+		fmt.Fprintf(&sb, "| Answer relevance (1-5) | %.2f |\n", s.Relevance)
+	}
+
+	sb.WriteString("\n## Cases\n\n")
+	sb.WriteString("| ID | Question | Book | Rank | Faithfulness | Relevance | Error |\n")
+	sb.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, c := range r.Cases {
+		fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s | %s | %s |\n",
+			markdownCell(c.ID),
+			markdownCell(c.Question),
+			markdownCell(c.Book),
+			gradeCell(c.Rank),
+			gradeCell(c.Faithfulness),
+			gradeCell(c.Relevance),
+			markdownCell(c.Error),
+		)
+	}
+	return sb.String()
+}
+
+// gradeCell renders a rank or a grade, 0 meaning none.
+func gradeCell(v int) string {
+	if v == 0 {
+		return "-"
+	}
+	return fmt.Sprint(v)
+}
+
+// markdownCell keeps the text on a single table cell.
+func markdownCell(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return strings.ReplaceAll(text, "|", `\|`)
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_LoadEvalDataset_ShouldReadJSONLines(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "dataset.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(
+		`{"id":"q1","question":"Who is Fantine?","book":"Les Misérables","passage":"Fantine"}`+"\n\n"+
+			`{"question":"Who is Javert?","book":"12","answer":"A police inspector."}`+"\n",
+	), 0o644))
+
+	// When
+	cases, err := LoadEvalDataset(path)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []EvalCase{
+		{ID: "q1", Question: "Who is Fantine?", Book: "Les Misérables", Passage: "Fantine"},
+		{ID: "002", Question: "Who is Javert?", Book: "12", Answer: "A police inspector."},
+	}, cases)
+}
+
+func Test_LoadEvalDataset_ShouldReadYAMLSample(t *testing.T) {
+	// When
+	cases, err := LoadEvalDataset(filepath.Join("..", "config", "eval-dataset-sample.yaml"))
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, cases, 2)
+	assert.Equal(t, "cosette-mother", cases[0].ID)
+	assert.Equal(t, "Les Misérables", cases[0].Book)
+}
+
+func Test_isRelevantChunk_ShouldMatchBookAndPassage(t *testing.T) {
+	// Given
+	c := EvalCase{Book: "les misérables", Passage: "Fantine was one of those beings who blossom"}
+	doc := func(bookID int, title, text string) *ai.Document {
+		return ai.DocumentFromText(text, map[string]any{"book_id": bookID, "book_title": title})
+	}
+
+	// Then
+	assert.True(t, isRelevantChunk(c, doc(1, "Les Misérables",
+		"In Paris, Fantine was one of those beings who blossom, so to speak, from the dregs of the people.")))
+	assert.True(t, isRelevantChunk(c, doc(1, "Les Misérables", "Fantine was one of those beings")))
+	assert.False(t, isRelevantChunk(c, doc(1, "Les Misérables", "Javert was a police inspector.")))
+	assert.False(t, isRelevantChunk(c, doc(2, "Notre-Dame de Paris", "Fantine was one of those beings who blossom")))
+	assert.True(t, isRelevantChunk(EvalCase{Book: "2"}, doc(2, "Notre-Dame de Paris", "anything")))
+}
+
+func Test_summarizeEval_ShouldAverageMetrics(t *testing.T) {
+	// Given
+	results := []EvalCaseResult{
+		{Rank: 1, Hit: true, ReciprocalRank: 1, Faithfulness: 5, Relevance: 4},
+		{Rank: 4, Hit: true, ReciprocalRank: 0.25, Faithfulness: 3, Relevance: 2},
+		{Error: "boom"},
+		{},
+	}
+
+	// When
+	s := summarizeEval(results)
+
+	// Then
+	assert.Equal(t, EvalSummary{
+		Cases:        4,
+		Errors:       1,
+		HitAtK:       0.5,
+		MRR:          0.3125,
+		Graded:       2,
+		Faithfulness: 4,
+		Relevance:    3,
+	}, s)
+}
+
+func Test_EvalReport_Markdown_ShouldEscapeCells(t *testing.T) {
+	// Given
+	report := EvalReport{
+		Settings: EvalSettings{CompletionModel: "fake/completion", K: 3},
+		Summary:  EvalSummary{Cases: 1, HitAtK: 1, MRR: 0.5},
+		Cases:    []EvalCaseResult{{ID: "q1", Question: "A | B\nor C?", Book: "1", Rank: 2}},
+	}
+
+	// When
+	md := report.Markdown()
+
+	// Then
+	assert.Contains(t, md, "| Hit@3 | 1.000 |\n| MRR | 0.500 |\n")
+	assert.Contains(t, md, "| q1 | A \\| B or C? | 1 | 2 | - | - |  |\n")
+	assert.NotContains(t, md, "Faithfulness (1-5)")
+}
@@ -12,17 +12,6 @@ import (
 	"github.com/thomas-marquis/goLLMan/pkg"
 )
 
-const (
-	systemPrompt = `You are a helpful assistant. A user will ask you a question or send you a message with all the documents necessary to answer and you have to answer him/her appropriately.
-Follow ALL those rules:
-* Don't make up answers. If you don't know the answer or you're not sure', just say "I don't know".
-* Use pieces of information provided along the user's question to answer, NOTHING ELSE.
-* Be concise and accurate.
-* Answer in the same language as the user.
-* If you're not sure, ask the user for clarification.
-* Format your response in Markdown.`
-)
-
 func (a *Agent) indexerFlowHandler(ctx context.Context, book domain.Book) (any, error) {
 	if book.Metadata == nil {
 		book.Metadata = make(map[string]any)
@@ -49,7 +38,7 @@ func (a *Agent) indexerFlowHandler(ctx context.Context, book domain.Book) (any,
 	})
 	if err != nil {
 		book.Status = domain.StatusError
-		book.Metadata["error"] = err.Error()
+		book.Metadata[domain.MetadataError] = err.Error()
 
 		if err := a.bookRepository.Update(ctx, book); err != nil {
 			pkg.Logger.Printf("Error updating book status: %s\n", err)
@@ -58,19 +47,24 @@ func (a *Agent) indexerFlowHandler(ctx context.Context, book domain.Book) (any,
 			book.Title, book.Author, err)
 	}
 
-	if _, err := genkit.Run(ctx, "indexDocuments", func() (any, error) {
-		if err := indexDocuments(a.embedder, a.bookVectorStore, ctx, book, parts); err != nil {
-			return nil, err
+	stats, err := genkit.Run(ctx, "indexDocuments", func() (EmbeddingCacheStats, error) {
+		stats, err := a.indexDocuments(ctx, book, parts)
+		if err != nil {
+			return stats, err
 		}
 
 		book.Status = domain.StatusIndexed
+		delete(book.Metadata, domain.MetadataError)
+		book.Metadata[splitterMetadataKey] = a.cfg.Splitter.Metadata()
+		book.Metadata[chunkContextMetadataKey] = a.cfg.ChunkContext.Mode()
 		if err := a.bookRepository.Update(ctx, book); err != nil {
 			pkg.Logger.Printf("Error updating book status: %s\n", err)
 		}
-		return nil, nil
-	}); err != nil {
+		return stats, nil
+	})
+	if err != nil {
 		book.Status = domain.StatusError
-		book.Metadata["error"] = err.Error()
+		book.Metadata[domain.MetadataError] = err.Error()
 
 		if err := a.bookRepository.Update(ctx, book); err != nil {
 			pkg.Logger.Printf("Error updating book status: %s\n", err)
@@ -78,88 +72,285 @@ func (a *Agent) indexerFlowHandler(ctx context.Context, book domain.Book) (any,
 		return nil, fmt.Errorf("failed to index documents: %w", err)
 	}
 
-	return genkit.Run(ctx, "updateBookStatus", func() (any, error) {
+	if _, err := genkit.Run(ctx, "updateBookStatus", func() (any, error) {
 		book.Status = domain.StatusIndexed
 		return nil, a.bookRepository.Update(ctx, book)
-	})
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
 }
 
-func (a *Agent) chatbotAiFlowHandler(ctx context.Context, input ChatbotInput) (string, error) {
+func (a *Agent) chatbotAiFlowHandler(
+	ctx context.Context,
+	input ChatbotInput,
+	stream func(context.Context, string) error,
+) (ChatbotOutput, error) {
+	sess, err := genkit.Run(ctx, "getSession", func() (*session.Session, error) {
+		return a.getSession(ctx, input.Session, input.BookIDs)
+	})
+	if err != nil {
+		return ChatbotOutput{}, err
+	}
+
+	query, err := genkit.Run(ctx, "rewriteQuery", func() (string, error) {
+		return a.rewriteQuery(ctx, input.Question, sess.GetMessages())
+	})
+	if err != nil {
+		return ChatbotOutput{}, fmt.Errorf("failed to rewrite the question: %w", err)
+	}
+
 	docs, err := genkit.Run(ctx, "retrieveDocuments", func() ([]*ai.Document, error) {
-		resp, err := a.retriever.Retrieve(ctx, &ai.RetrieverRequest{
-			Query: ai.DocumentFromText(input.Question, map[string]any{
-				"limit": a.cfg.RetrievalLimit,
-			}),
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve documents: %w", err)
+		return a.retrieveDocuments(ctx, query, sess.BookIDs(), input.Filters, a.cfg.RetrievalLimit)
+	})
+	if err != nil {
+		return ChatbotOutput{}, fmt.Errorf("failed to retrieve documents: %w", err)
+	}
+
+	prevMsg, err := genkit.Run(ctx, "updateSessionBefore", func() ([]*ai.Message, error) {
+		return addUserMessage(sess, input.Question)
+	})
+	if err != nil {
+		return ChatbotOutput{}, err
+	}
+
+	a.summarizeHistory(ctx, sess)
+
+	prompt, err := genkit.Run(ctx, "renderPrompt", func() (renderedPrompt, error) {
+		return a.renderPrompt(ctx,
+			promptCall{name: chatbotSystemPromptName, input: map[string]any{"summary": sess.Summary()}},
+			promptCall{name: chatbotUserPromptName, input: map[string]any{"question": input.Question}},
+		)
+	})
+	if err != nil {
+		return ChatbotOutput{}, err
+	}
+
+	budget, err := genkit.Run(ctx, "allocateTokenBudget", func() (budgetAllocation, error) {
+		return a.tokenBudget().allocate(prompt.System, prompt.Prompt, prevMsg, docs)
+	})
+	if err != nil {
+		return ChatbotOutput{}, fmt.Errorf("failed to fit the request in the context window: %w", err)
+	}
+
+	resp, err := genkit.Run(ctx, "generateResponse", func() (*ai.ModelResponse, error) {
+		opts := []ai.GenerateOption{
+			ai.WithSystem(prompt.System),
+			ai.WithMessages(budget.history...),
+			ai.WithPrompt(budget.prompt),
+			ai.WithDocs(budget.docs...),
+			ai.WithModelName(a.cfg.CompletionModel),
+		}
+		if stream != nil {
+			opts = append(opts, streamingOption(stream))
 		}
-		return resp.Documents, nil
+		return genkit.Generate(ctx, a.g, opts...)
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve documents: %w", err)
+		return ChatbotOutput{}, fmt.Errorf("failed to generate response: %w", err)
 	}
 
+	return genkit.Run(ctx, "updateSessionAfter", func() (ChatbotOutput, error) {
+		return addAssistantMessage(sess, resp, citationsFromDocuments(budget.docs), query)
+	})
+}
+
+// chatbotAgentFlowHandler lets the model decide which library tools to call before answering.
+func (a *Agent) chatbotAgentFlowHandler(
+	ctx context.Context,
+	input ChatbotInput,
+	stream func(context.Context, string) error,
+) (ChatbotOutput, error) {
 	sess, err := genkit.Run(ctx, "getSession", func() (*session.Session, error) {
-		sess, err := a.sessionStore.GetByID(ctx, input.Session)
-		if err != nil {
-			if errors.Is(err, session.ErrSessionNotFound) {
-				sess, err = a.initSession(ctx, input.Session)
-				if err != nil {
-					return nil, fmt.Errorf("failed to initialize session: %w", err)
-				}
-			} else {
-				return nil, fmt.Errorf("failed to get session: %w", err)
-			}
-		}
-		return sess, nil
+		return a.getSession(ctx, input.Session, input.BookIDs)
 	})
 	if err != nil {
-		return "", err
+		return ChatbotOutput{}, err
 	}
 
 	prevMsg, err := genkit.Run(ctx, "updateSessionBefore", func() ([]*ai.Message, error) {
-		prevMsg := sess.GetMessages()
-		pkg.ClearMessageContext(prevMsg)
-		userMsg := ai.NewUserMessage(pkg.ContentFromText(input.Question)...)
-		if err := sess.AddMessage(userMsg); err != nil {
-			return nil, fmt.Errorf("failed to add user message to session: %w", err)
-		}
+		return addUserMessage(sess, input.Question)
+	})
+	if err != nil {
+		return ChatbotOutput{}, err
+	}
+
+	a.summarizeHistory(ctx, sess)
 
-		return prevMsg, nil
+	prompt, err := genkit.Run(ctx, "renderPrompt", func() (renderedPrompt, error) {
+		return a.renderPrompt(ctx,
+			promptCall{name: agentSystemPromptName, input: map[string]any{"summary": sess.Summary()}},
+			promptCall{},
+		)
 	})
 	if err != nil {
-		return "", err
+		return ChatbotOutput{}, err
 	}
 
+	budget, err := genkit.Run(ctx, "allocateTokenBudget", func() (budgetAllocation, error) {
+		return a.tokenBudget().allocate(prompt.System, input.Question, prevMsg, nil)
+	})
+	if err != nil {
+		return ChatbotOutput{}, fmt.Errorf("failed to fit the request in the context window: %w", err)
+	}
+
+	sources := newSourcesCollector()
 	resp, err := genkit.Run(ctx, "generateResponse", func() (*ai.ModelResponse, error) {
-		question := "# User's message:\n" + input.Question + "\n\n"
-		return genkit.Generate(ctx, a.g,
-			ai.WithSystem(systemPrompt),
-			ai.WithMessages(prevMsg...),
-			ai.WithPrompt(question),
-			ai.WithDocs(docs...),
+		opts := []ai.GenerateOption{
+			ai.WithSystem(prompt.System),
+			ai.WithMessages(budget.history...),
+			ai.WithPrompt(budget.prompt),
+			ai.WithTools(a.tools...),
 			ai.WithModelName(a.cfg.CompletionModel),
-		)
+		}
+		if a.cfg.AgentMaxSteps > 0 {
+			opts = append(opts, ai.WithMaxTurns(a.cfg.AgentMaxSteps))
+		}
+		if stream != nil {
+			opts = append(opts, streamingOption(stream))
+		}
+		toolsCtx := withBookFilters(withBookScope(withSourcesCollector(ctx, sources), sess.BookIDs()), input.Filters)
+		return genkit.Generate(toolsCtx, a.g, opts...)
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to generate response: %w", err)
+		return ChatbotOutput{}, fmt.Errorf("failed to generate response: %w", err)
 	}
 
-	return genkit.Run(ctx, "updateSessionAfter", func() (string, error) {
-		assistantMsg := ai.NewMessage(resp.Message.Role, resp.Message.Metadata, resp.Message.Content...)
+	return genkit.Run(ctx, "updateSessionAfter", func() (ChatbotOutput, error) {
+		return addAssistantMessage(sess, resp, citationsFromDocuments(sources.documents()), "")
+	})
+}
 
-		if err := sess.AddMessage(assistantMsg); err != nil {
-			return "", fmt.Errorf("failed to add assitant message to session: %w", err)
-		}
-		return resp.Text(), nil
+func streamingOption(stream func(context.Context, string) error) ai.GenerateOption {
+	return ai.WithStreaming(func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+		return stream(ctx, chunk.Text())
 	})
 }
 
+// addUserMessage adds the question to the session and returns the messages preceding it.
+func addUserMessage(sess *session.Session, question string) ([]*ai.Message, error) {
+	prevMsg := sess.GetMessages()
+	pkg.ClearMessageContext(prevMsg)
+	userMsg := ai.NewUserMessage(pkg.ContentFromText(question)...)
+	if err := sess.AddMessage(userMsg); err != nil {
+		return nil, fmt.Errorf("failed to add user message to session: %w", err)
+	}
+
+	return prevMsg, nil
+}
+
+// addAssistantMessage adds the model answer to the session along with its sources.
+func addAssistantMessage(
+	sess *session.Session,
+	resp *ai.ModelResponse,
+	citations []domain.Citation,
+	query string,
+) (ChatbotOutput, error) {
+	metadata := make(map[string]any, len(resp.Message.Metadata)+2)
+	for k, v := range resp.Message.Metadata {
+		metadata[k] = v
+	}
+	metadata[citationsMetadataKey] = citations
+	if query != "" {
+		metadata[searchQueryMetadataKey] = query
+	}
+	assistantMsg := ai.NewMessage(resp.Message.Role, metadata, resp.Message.Content...)
+
+	if err := sess.AddMessage(assistantMsg); err != nil {
+		return ChatbotOutput{}, fmt.Errorf("failed to add assitant message to session: %w", err)
+	}
+	return ChatbotOutput{
+		Answer:      resp.Text(),
+		Citations:   citations,
+		SearchQuery: query,
+	}, nil
+}
+
+// rerankCandidates returns the number of documents to retrieve before reranking.
+func (a *Agent) rerankCandidates() int {
+	if a.cfg.RerankCandidates > a.cfg.RetrievalLimit {
+		return a.cfg.RerankCandidates
+	}
+	return a.cfg.RetrievalLimit * defaultRerankCandidatesFactor
+}
+
+// getSession returns the session, created if needed, and scopes it to the books when bookIDs is not nil.
+func (a *Agent) getSession(ctx context.Context, sessionID string, bookIDs []string) (*session.Session, error) {
+	sess, err := a.sessionStore.GetByID(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			sess, err = a.initSession(ctx, sessionID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to initialize session: %w", err)
+			}
+		} else {
+			return nil, fmt.Errorf("failed to get session: %w", err)
+		}
+	}
+
+	if bookIDs != nil {
+		sess.SetBookIDs(bookIDs)
+	}
+	return sess, nil
+}
+
 func (a *Agent) initSession(ctx context.Context, sessionID string) (*session.Session, error) {
-	sess, err := a.sessionStore.NewSession(ctx, session.WithLimit(a.cfg.SessionMessageLimit))
+	opts := []session.Option{
+		session.WithID(sessionID),
+		session.WithLimit(a.cfg.SessionMessageLimit),
+	}
+	if a.cfg.MemoryStrategy == MemoryStrategySummary {
+		opts = append(opts, session.WithSummarization())
+	}
+	sess, err := a.sessionStore.NewSession(ctx, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new session: %w", err)
 	}
 	return sess, nil
 }
+
+// retrieveDocuments returns the limit most relevant chunks of the books matching the filters for the query,
+// reranked when a reranker is configured, then expanded with their neighbor chunks when configured.
+// It must be called from a flow.
+func (a *Agent) retrieveDocuments(
+	ctx context.Context,
+	query string,
+	bookIDs []string,
+	filters map[string]string,
+	limit int,
+) ([]*ai.Document, error) {
+	candidates := limit
+	if a.reranker != nil {
+		candidates = a.rerankCandidates()
+		if candidates < limit {
+			candidates = limit
+		}
+	}
+
+	resp, err := a.retriever.Retrieve(ctx, &ai.RetrieverRequest{
+		Query: ai.DocumentFromText(query, map[string]any{
+			"limit":    candidates,
+			"book_ids": bookIDs,
+			"filters":  filters,
+		}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve documents: %w", err)
+	}
+	docs := resp.Documents
+	if a.reranker != nil {
+		docs, err = genkit.Run(ctx, "rerankDocuments", func() ([]*ai.Document, error) {
+			return rerankDocuments(ctx, a.reranker, query, docs, limit)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if a.cfg.NeighborChunks <= 0 {
+		return docs, nil
+	}
+
+	return genkit.Run(ctx, "expandNeighbors", func() ([]*ai.Document, error) {
+		return expandNeighbors(ctx, a.bookVectorStore, docs, a.cfg.NeighborChunks)
+	})
+}
@@ -2,66 +2,212 @@ package agent
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/thomas-marquis/goLLMan/internal/domain"
 	"github.com/thomas-marquis/goLLMan/pkg"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
 	indexingBatchSize = 50
+
+	defaultIndexingWorkers = 4
 )
 
+// dataToInsert is an embedded batch waiting to be stored.
 type dataToInsert struct {
-	Content   string
-	Embedding []float32
-	Index     int
-	Batch     int
+	Batch   int
+	Docs    []*ai.Document
+	Vectors [][]float32
+	Stats   EmbeddingCacheStats
 }
 
-const numInsertWorkers = 10
-
-func indexDocuments(embedder ai.Embedder, bookVectorStore domain.BookVectorStore, ctx context.Context, book domain.Book, docs []*ai.Document) error {
-	splitter := makeTextSplitter()
+// indexDocuments splits, embeds and stores the documents of the book, batch by batch.
+// A checkpoint is saved along with each batch, so that a failed indexing resumes from the first
+// batch not stored instead of starting over. It returns how many chunks were found in the embedding cache.
+//
+// The batches are embedded by concurrent workers, each request being spaced out by the rate limit of its provider,
+// while a single writer stores them in order, keeping the checkpoints consistent.
+// The first error cancels the whole pipeline.
+func (a *Agent) indexDocuments(ctx context.Context, book domain.Book, docs []*ai.Document) (EmbeddingCacheStats, error) {
+	var stats EmbeddingCacheStats
+	splitter, err := NewTextSplitter(a.cfg.Splitter, CharsTokenCounter{CharsPerToken: a.cfg.CharsPerToken})
+	if err != nil {
+		return stats, err
+	}
 
 	preparedDocs, err := SplitDocuments(splitter, docs)
 	if err != nil {
-		return fmt.Errorf("failed to split documents: %w", err)
+		return stats, fmt.Errorf("failed to split documents: %w", err)
 	}
 
 	documentsBatches := batchDocuments(preparedDocs, indexingBatchSize)
-	pkg.Logger.Printf("Indexing %d documents for book %s through %d batches",
-		len(preparedDocs), book.Title, len(documentsBatches))
+	fingerprint := indexingFingerprint(a.cfg.EmbeddingModel, a.cfg.ChunkContext.Mode(), documentsBatches)
+	chapters := chapterTexts(docs)
 
-	for i, batch := range documentsBatches {
-		batchSize := len(batch)
-		if batchSize == 0 {
-			continue
-		}
+	start, err := a.resumeIndexing(ctx, book, fingerprint)
+	if err != nil {
+		return stats, err
+	}
+
+	workers := a.indexingWorkers()
+	pkg.Logger.Printf("Indexing %d documents for book %s through %d batches with %d workers, starting at batch %d",
+		len(preparedDocs), book.Title, len(documentsBatches), workers, start+1)
 
-		embedRes, err := ai.Embed(ctx, embedder, ai.WithDocs(batch...))
-		if err != nil {
-			return fmt.Errorf("failed to embed documents: %w", err)
+	g, ctx := errgroup.WithContext(ctx)
+	jobs := make(chan int)
+	results := make(chan dataToInsert, workers)
+	// inFlight bounds the batches embedded but not stored yet, waiting for a slower previous one
+	inFlight := make(chan struct{}, 2*workers)
+
+	g.Go(func() error {
+		defer close(jobs)
+		for i := start; i < len(documentsBatches); i++ {
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
+		return nil
+	})
+
+	var embedders sync.WaitGroup
+	for range workers {
+		embedders.Add(1)
+		g.Go(func() error {
+			defer embedders.Done()
+			for i := range jobs {
+				inputs, err := a.embeddingInputs(ctx, book, chapters, documentsBatches[i])
+				if err != nil {
+					return fmt.Errorf("failed to contextualize documents at batch %d: %w", i, err)
+				}
+				vectors, batchStats, err := embedDocuments(ctx, a.embedder, a.embeddingCache, a.cfg.EmbeddingModel, inputs)
+				if err != nil {
+					return fmt.Errorf("failed to embed documents at batch %d: %w", i, err)
+				}
+				select {
+				case results <- dataToInsert{Batch: i, Docs: documentsBatches[i], Vectors: vectors, Stats: batchStats}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		embedders.Wait()
+		close(results)
+		return nil
+	})
+
+	g.Go(func() error {
+		pending := make(map[int]dataToInsert)
+		next := start
+		for data := range results {
+			pending[data.Batch] = data
+			for {
+				data, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
 
-		vectors := make([][]float32, batchSize)
-		for j, emb := range embedRes.Embeddings {
-			vectors[j] = emb.Embedding
+				checkpoint := domain.IndexingCheckpoint{
+					NextBatch:    next + 1,
+					TotalBatches: len(documentsBatches),
+					Fingerprint:  fingerprint,
+				}
+				if err := a.bookVectorStore.Index(ctx, book, data.Docs, data.Vectors, checkpoint); err != nil {
+					return fmt.Errorf("failed to index documents at batch %d: %w", next, err)
+				}
+				stats.add(data.Stats)
+				<-inFlight
+
+				pkg.Logger.Printf("Batch no %d/%d indexed with %d documents for book %s (%d cached)",
+					next+1, len(documentsBatches), len(data.Docs), book.Title, data.Stats.Hits)
+				next++
+			}
 		}
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		return stats, err
+	}
 
-		contents := make([]string, batchSize)
-		for j, doc := range batch {
-			contents[j] = pkg.ContentToText(doc.Content)
+	pkg.Logger.Printf("Book %s indexed, embedding cache hit ratio: %.1f%% (%d hits, %d misses)",
+		book.Title, stats.HitRatio()*100, stats.Hits, stats.Misses)
+	return stats, nil
+}
+
+// indexingWorkers returns the number of batches embedded concurrently.
+func (a *Agent) indexingWorkers() int {
+	if a.cfg.IndexingWorkers > 0 {
+		return a.cfg.IndexingWorkers
+	}
+	return defaultIndexingWorkers
+}
+
+// resumeIndexing returns the first batch to index. It resumes from the book checkpoint when it was saved
+// for the same chunks, otherwise the parts already stored are deleted and the indexing starts over.
+func (a *Agent) resumeIndexing(ctx context.Context, book domain.Book, fingerprint string) (int, error) {
+	checkpoint, err := a.bookVectorStore.GetIndexingCheckpoint(ctx, book)
+	if err != nil && !errors.Is(err, domain.ErrIndexingCheckpointNotFound) {
+		return 0, fmt.Errorf("failed to get the indexing checkpoint: %w", err)
+	}
+	if err == nil && checkpoint.Fingerprint == fingerprint {
+		if checkpoint.NextBatch > 0 {
+			pkg.Logger.Printf("Resuming the indexing of book %s after batch %d/%d",
+				book.Title, checkpoint.NextBatch, checkpoint.TotalBatches)
 		}
+		return checkpoint.NextBatch, nil
+	}
 
-		if err := bookVectorStore.Index(ctx, book, contents, vectors); err != nil {
-			return fmt.Errorf("failed to index documents at batch %d: %w", i, err)
+	if err := a.bookVectorStore.ClearIndex(ctx, book); err != nil {
+		return 0, fmt.Errorf("failed to clear the previous index: %w", err)
+	}
+	return 0, nil
+}
+
+// indexingFingerprint identifies the embedding model, the chunk context mode, the chunks and how they are batched.
+// Any change to one of them makes the previous checkpoint stale.
+func indexingFingerprint(embeddingModel, chunkContext string, batches [][]*ai.Document) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%d\n", embeddingModel, chunkContext, len(batches))
+	for _, batch := range batches {
+		fmt.Fprintf(h, "%d\n", len(batch))
+		for _, doc := range batch {
+			h.Write([]byte(contentHash(pkg.ContentToText(doc.Content))))
 		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-		pkg.Logger.Printf("Batch no %d/%d indexed with %d documents for book %s",
-			i+1, len(documentsBatches), batchSize, book.Title)
+// OutdatedBooks returns the indexed books split with another configuration than the current one.
+// They need to be indexed again for their chunks to follow the configuration.
+func (a *Agent) OutdatedBooks(ctx context.Context) ([]domain.Book, error) {
+	books, err := a.bookRepository.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list books: %w", err)
 	}
 
-	return nil
+	outdated := make([]domain.Book, 0)
+	for _, book := range books {
+		if book.Status == domain.StatusIndexed && a.cfg.Splitter.Outdated(book) {
+			outdated = append(outdated, book)
+		}
+	}
+	return outdated, nil
 }
@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/agent/provider/fake"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+// memoryVectorStore keeps the parts and the checkpoint in memory and fails the failAt-th call to Index.
+type memoryVectorStore struct {
+	domain.BookVectorStore
+	parts      []string
+	checkpoint *domain.IndexingCheckpoint
+	stored     []int
+	calls      int
+	failAt     int
+}
+
+func (s *memoryVectorStore) Index(ctx context.Context, book domain.Book, parts []*ai.Document, vectors [][]float32, checkpoint domain.IndexingCheckpoint) error {
+	s.calls++
+	if s.calls == s.failAt {
+		return errors.New("connection lost")
+	}
+	for _, part := range parts {
+		s.parts = append(s.parts, pkg.ContentToText(part.Content))
+	}
+	s.checkpoint = &checkpoint
+	s.stored = append(s.stored, checkpoint.NextBatch-1)
+	return nil
+}
+
+func (s *memoryVectorStore) GetIndexingCheckpoint(ctx context.Context, book domain.Book) (domain.IndexingCheckpoint, error) {
+	if s.checkpoint == nil {
+		return domain.IndexingCheckpoint{}, domain.ErrIndexingCheckpointNotFound
+	}
+	return *s.checkpoint, nil
+}
+
+func (s *memoryVectorStore) ClearIndex(ctx context.Context, book domain.Book) error {
+	s.parts = nil
+	s.checkpoint = nil
+	return nil
+}
+
+func Test_indexDocuments_ShouldResumeFromLastCheckpoint(t *testing.T) {
+	// Given
+	ctx := context.Background()
+	g, err := genkit.Init(ctx, genkit.WithPlugins(fake.NewPlugin()))
+	require.NoError(t, err)
+	store := &memoryVectorStore{failAt: 2}
+	a := &Agent{
+		cfg:             Config{EmbeddingModel: "fake/embed"},
+		embedder:        genkit.LookupEmbedder(g, "fake", "embed"),
+		bookVectorStore: store,
+	}
+	docs := make([]*ai.Document, 0, 2*indexingBatchSize+10)
+	for i := range cap(docs) {
+		docs = append(docs, ai.DocumentFromText(fmt.Sprintf("Paragraph number %d.", i), nil))
+	}
+	book := domain.Book{ID: "1", Title: "Les Misérables"}
+
+	// When the second batch fails
+	_, err = a.indexDocuments(ctx, book, docs)
+
+	// Then
+	require.Error(t, err)
+	assert.Len(t, store.parts, indexingBatchSize)
+	assert.Equal(t, 1, store.checkpoint.NextBatch)
+
+	// When retrying
+	_, err = a.indexDocuments(ctx, book, docs)
+
+	// Then
+	require.NoError(t, err)
+	assert.Len(t, store.parts, len(docs))
+	assert.Equal(t, 4, store.calls, "the first batch should not be indexed again")
+	assert.True(t, store.checkpoint.Done())
+
+	// When the chunks change
+	_, err = a.indexDocuments(ctx, book, docs[:10])
+
+	// Then
+	require.NoError(t, err)
+	assert.Len(t, store.parts, 10)
+}
+
+func newIndexingTestAgent(t *testing.T, store domain.BookVectorStore, embed func(context.Context, *ai.EmbedRequest) (*ai.EmbedResponse, error)) (*Agent, []*ai.Document) {
+	t.Helper()
+	g, err := genkit.Init(context.Background())
+	require.NoError(t, err)
+	docs := make([]*ai.Document, 0, 4*indexingBatchSize)
+	for i := range cap(docs) {
+		docs = append(docs, ai.DocumentFromText(fmt.Sprintf("Paragraph number %d.", i), nil))
+	}
+	return &Agent{
+		cfg:             Config{EmbeddingModel: "test/embed", IndexingWorkers: 4},
+		embedder:        genkit.DefineEmbedder(g, "test", "embed", embed),
+		bookVectorStore: store,
+	}, docs
+}
+
+func Test_indexDocuments_ShouldStoreBatchesInOrder(t *testing.T) {
+	// Given
+	store := &memoryVectorStore{}
+	a, docs := newIndexingTestAgent(t, store, func(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		// The first batches are the slowest to embed
+		if strings.Contains(req.Input[0].Content[0].Text, "number 0.") {
+			time.Sleep(50 * time.Millisecond)
+		}
+		resp := &ai.EmbedResponse{}
+		for range req.Input {
+			resp.Embeddings = append(resp.Embeddings, &ai.Embedding{Embedding: []float32{1}})
+		}
+		return resp, nil
+	})
+
+	// When
+	stats, err := a.indexDocuments(context.Background(), domain.Book{ID: "1"}, docs)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3}, store.stored)
+	assert.Len(t, store.parts, len(docs))
+	assert.Equal(t, len(docs), stats.Misses)
+}
+
+func Test_indexDocuments_ShouldStopOnEmbeddingError(t *testing.T) {
+	// Given
+	store := &memoryVectorStore{}
+	a, docs := newIndexingTestAgent(t, store, func(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		if strings.Contains(req.Input[0].Content[0].Text, fmt.Sprintf("number %d.", indexingBatchSize)) {
+			return nil, errors.New("quota exceeded")
+		}
+		resp := &ai.EmbedResponse{}
+		for range req.Input {
+			resp.Embeddings = append(resp.Embeddings, &ai.Embedding{Embedding: []float32{1}})
+		}
+		return resp, nil
+	})
+
+	// When
+	_, err := a.indexDocuments(context.Background(), domain.Book{ID: "1"}, docs)
+
+	// Then
+	require.ErrorContains(t, err, "quota exceeded")
+	assert.NotContains(t, store.stored, 1)
+	assert.NotContains(t, store.stored, 2, "no batch should be stored after the failed one")
+}
@@ -0,0 +1,86 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// The cover thumbnails fit in a box of that size, in pixels.
+	coverThumbnailWidth  = 240
+	coverThumbnailHeight = 360
+
+	coverThumbnailQuality = 85
+
+	// maxCoverPixels caps the size of the decoded covers, read from untrusted files.
+	maxCoverPixels = 25_000_000
+	// maxCoverFileSize caps the size of the cover files read from the book archives, in bytes.
+	maxCoverFileSize = 20 << 20
+)
+
+// ErrNoCover is returned for the books without cover image.
+var ErrNoCover = errors.New("no cover found in book")
+
+// CoverReader is implemented by the loaders of the formats holding a cover image.
+type CoverReader interface {
+	// ReadCover returns the cover image of the book file, or ErrNoCover.
+	ReadCover(file *domain.FileWithContent) (image.Image, error)
+}
+
+// CoverThumbnail scales the cover down to fit the thumbnail size, keeping its ratio, and encodes it as JPEG.
+// The smaller covers are kept at their size. The transparent parts, which JPEG can't hold, turn white.
+func CoverThumbnail(cover image.Image) ([]byte, error) {
+	bounds := cover.Bounds()
+	if bounds.Empty() {
+		return nil, ErrNoCover
+	}
+
+	width, height := bounds.Dx(), bounds.Dy()
+	if scale := min(float64(coverThumbnailWidth)/float64(width), float64(coverThumbnailHeight)/float64(height)); scale < 1 {
+		width = max(1, int(float64(width)*scale))
+		height = max(1, int(float64(height)*scale))
+	}
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(thumbnail, thumbnail.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), cover, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: coverThumbnailQuality}); err != nil {
+		return nil, fmt.Errorf("failed to encode cover thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeCover decodes a cover stored as JPEG, PNG or GIF. Its size is checked before decoding it.
+func decodeCover(content []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover image: %w", err)
+	}
+	if err := checkCoverSize(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover image: %w", err)
+	}
+	return img, nil
+}
+
+// checkCoverSize rejects the covers too large to be decoded safely.
+func checkCoverSize(width, height int) error {
+	if width <= 0 || height <= 0 || int64(width)*int64(height) > maxCoverPixels {
+		return fmt.Errorf("cover image of %dx%d pixels is too large", width, height)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package loader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCover returns an image of the given size, filled with a single color.
+func testCover(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 0x20, G: 0x60, B: 0xa0, A: 0xff})
+		}
+	}
+	return img
+}
+
+func encodeTestPNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestCoverThumbnail(t *testing.T) {
+	testCases := []struct {
+		name           string
+		width, height  int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{name: "should scale a portrait cover to the thumbnail height", width: 1200, height: 3600, expectedWidth: 120, expectedHeight: 360},
+		{name: "should scale a landscape cover to the thumbnail width", width: 960, height: 480, expectedWidth: 240, expectedHeight: 120},
+		{name: "should keep a small cover at its size", width: 100, height: 150, expectedWidth: 100, expectedHeight: 150},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When
+			thumbnail, err := CoverThumbnail(testCover(tc.width, tc.height))
+
+			// Then
+			require.NoError(t, err)
+			config, err := jpeg.DecodeConfig(bytes.NewReader(thumbnail))
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedWidth, config.Width)
+			assert.Equal(t, tc.expectedHeight, config.Height)
+		})
+	}
+}
+
+// encodeTestPNGHeader returns the signature and the header of a PNG image of the given size, without its pixels.
+func encodeTestPNGHeader(width, height uint32) []byte {
+	chunk := []byte("IHDR")
+	chunk = binary.BigEndian.AppendUint32(chunk, width)
+	chunk = binary.BigEndian.AppendUint32(chunk, height)
+	chunk = append(chunk, 8, 6, 0, 0, 0)
+
+	content := []byte("\x89PNG\r\n\x1a\n")
+	content = binary.BigEndian.AppendUint32(content, uint32(len(chunk)-4))
+	content = append(content, chunk...)
+	return binary.BigEndian.AppendUint32(content, crc32.ChecksumIEEE(chunk))
+}
+
+func TestDecodeCover_ShouldRejectTooLargeImage(t *testing.T) {
+	// Given
+	content := encodeTestPNGHeader(100000, 100000)
+
+	// When
+	_, err := decodeCover(content)
+
+	// Then
+	assert.EqualError(t, err, "cover image of 100000x100000 pixels is too large")
+}
+
+func TestDecodeCover_ShouldDecodeImage(t *testing.T) {
+	// Given
+	content := encodeTestPNG(t, testCover(10, 20))
+
+	// When
+	cover, err := decodeCover(content)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 10, 20), cover.Bounds())
+}
+
+func TestCoverThumbnail_ShouldTurnTransparentPartsWhite(t *testing.T) {
+	// Given
+	cover := image.NewNRGBA(image.Rect(0, 0, 100, 150))
+
+	// When
+	thumbnail, err := CoverThumbnail(cover)
+
+	// Then
+	require.NoError(t, err)
+	img, err := jpeg.Decode(bytes.NewReader(thumbnail))
+	require.NoError(t, err)
+	r, g, b, _ := img.At(50, 75).RGBA()
+	assert.Greater(t, r>>8, uint32(0xf0))
+	assert.Greater(t, g>>8, uint32(0xf0))
+	assert.Greater(t, b>>8, uint32(0xf0))
+}
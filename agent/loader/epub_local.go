@@ -1,7 +1,9 @@
 package loader
 
 import (
+	"errors"
 	"fmt"
+	"image"
 
 	"github.com/JohannesKaufmann/dom"
 	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
@@ -19,21 +21,15 @@ type LocalEpubLoader struct {
 	conv       *converter.Converter
 }
 
-var _ BookLoader = (*LocalEpubLoader)(nil)
+var (
+	_ BookLoader  = (*LocalEpubLoader)(nil)
+	_ CoverReader = (*LocalEpubLoader)(nil)
+)
 
 func NewLocalEpubLoader(repository domain.BookRepository) *LocalEpubLoader {
-	conv := converter.NewConverter(
-		converter.WithPlugins(
-			base.NewBasePlugin(),
-			commonmark.NewCommonmarkPlugin(),
-			table.NewTablePlugin(),
-		),
-	)
-	conv.Register.PreRenderer(fixLinksPreRender, converter.PriorityEarly)
-
 	return &LocalEpubLoader{
 		repository: repository,
-		conv:       conv,
+		conv:       newHTMLConverter(),
 	}
 }
 
@@ -60,14 +56,60 @@ func (l *LocalEpubLoader) Load(book domain.Book, file *domain.FileWithContent) (
 			continue
 		}
 		documents = append(documents, ai.DocumentFromText(markdown, map[string]any{
-			"title":   chapter.Title,
-			"book_id": book.ID,
+			"chapter_title": chapter.Title,
+			"chapter_index": i,
+			"book_id":       book.ID,
 		}))
 	}
 
 	return documents, nil
 }
 
+// ReadMetadata reads the title and the author of the book, along with the descriptive metadata
+// of its OPF package.
+func (l *LocalEpubLoader) ReadMetadata(file *domain.FileWithContent) (domain.Book, error) {
+	parser, err := pamphlet.OpenBytes(file.Content)
+	if err != nil {
+		return domain.Book{}, fmt.Errorf("error opening epub file: %w", err)
+	}
+
+	book := parser.GetBook()
+	if book == nil {
+		return domain.Book{}, errors.New("invalid epub file")
+	}
+
+	opf, err := readEpubMetadata(file.Content)
+	if err != nil {
+		return domain.Book{}, fmt.Errorf("error reading epub metadata: %w", err)
+	}
+	if book.Title != "" {
+		opf.Title = book.Title
+	}
+	if book.Author != "" {
+		opf.Author = book.Author
+	}
+	opf.File = file.File
+	return opf, nil
+}
+
+// ReadCover returns the cover image declared by the OPF package.
+func (l *LocalEpubLoader) ReadCover(file *domain.FileWithContent) (image.Image, error) {
+	return readEpubCover(file.Content)
+}
+
+// newHTMLConverter returns the html to markdown converter shared by the loaders of HTML content.
+func newHTMLConverter() *converter.Converter {
+	conv := converter.NewConverter(
+		converter.WithPlugins(
+			base.NewBasePlugin(),
+			commonmark.NewCommonmarkPlugin(),
+			table.NewTablePlugin(),
+		),
+	)
+	conv.Register.PreRenderer(fixLinksPreRender, converter.PriorityEarly)
+	return conv
+}
+
 func fixLinksPreRender(ctx converter.Context, doc *html.Node) {
 	var walk func(*html.Node)
 	walk = func(n *html.Node) {
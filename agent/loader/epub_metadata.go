@@ -0,0 +1,383 @@
+package loader
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"golang.org/x/net/html"
+)
+
+const epubContainerPath = "META-INF/container.xml"
+
+var (
+	isbnRe = regexp.MustCompile(`^(?:97[89])?\d{9}[\dX]$`)
+	dateRe = regexp.MustCompile(`^\d{4}(?:-\d{2}(?:-\d{2})?)?`)
+)
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// opfPackage is the package document of an EPUB. The Dublin Core elements are matched by their local name,
+// so that both EPUB 2 and EPUB 3 packages are read.
+type opfPackage struct {
+	Metadata struct {
+		Titles       []opfElement `xml:"title"`
+		Creators     []opfElement `xml:"creator"`
+		Languages    []opfElement `xml:"language"`
+		Publishers   []opfElement `xml:"publisher"`
+		Dates        []opfElement `xml:"date"`
+		Identifiers  []opfElement `xml:"identifier"`
+		Subjects     []opfElement `xml:"subject"`
+		Descriptions []opfElement `xml:"description"`
+		Metas        []opfMeta    `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest struct {
+		Items []opfItem `xml:"item"`
+	} `xml:"manifest"`
+}
+
+type opfElement struct {
+	ID     string `xml:"id,attr"`
+	Role   string `xml:"role,attr"`
+	Scheme string `xml:"scheme,attr"`
+	Event  string `xml:"event,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// opfMeta is either an EPUB 2 <meta name content> or an EPUB 3 <meta property>, refining another element.
+type opfMeta struct {
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	ID       string `xml:"id,attr"`
+	Property string `xml:"property,attr"`
+	Refines  string `xml:"refines,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type opfItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// readEpubPackage opens the EPUB archive and parses its package document, whose path is returned along with it.
+func readEpubPackage(content []byte) (*zip.Reader, opfPackage, string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, opfPackage{}, "", fmt.Errorf("error opening epub archive: %w", err)
+	}
+
+	var container epubContainer
+	if err := readZipXML(archive, epubContainerPath, &container); err != nil {
+		return nil, opfPackage{}, "", err
+	}
+	if len(container.Rootfiles) == 0 {
+		return nil, opfPackage{}, "", errors.New("no package document found in epub container")
+	}
+	opfPath := container.Rootfiles[0].FullPath
+	var pkg opfPackage
+	if err := readZipXML(archive, opfPath, &pkg); err != nil {
+		return nil, opfPackage{}, "", err
+	}
+	return archive, pkg, opfPath, nil
+}
+
+// readEpubMetadata reads the title, the author and the descriptive metadata of the OPF package of an EPUB:
+// language, publisher, publication date, identifiers, subjects, description and series.
+func readEpubMetadata(content []byte) (domain.Book, error) {
+	_, pkg, _, err := readEpubPackage(content)
+	if err != nil {
+		return domain.Book{}, err
+	}
+	meta := pkg.Metadata
+
+	// The EPUB 3 refinements, by refined element ID then by property
+	refinements := make(map[string]map[string]string)
+	for _, m := range meta.Metas {
+		if m.Refines == "" || m.Property == "" {
+			continue
+		}
+		id := strings.TrimPrefix(m.Refines, "#")
+		if refinements[id] == nil {
+			refinements[id] = make(map[string]string)
+		}
+		refinements[id][m.Property] = strings.TrimSpace(m.Value)
+	}
+
+	book := domain.Book{Metadata: make(map[string]any)}
+	if len(meta.Titles) > 0 {
+		book.Title = strings.TrimSpace(meta.Titles[0].Value)
+	}
+	authors := make([]string, 0, len(meta.Creators))
+	for _, c := range meta.Creators {
+		role := c.Role
+		if role == "" {
+			role = refinements[c.ID]["role"]
+		}
+		if role == "" || role == "aut" {
+			authors = appendUnique(authors, strings.TrimSpace(c.Value))
+		}
+	}
+	book.Author = strings.Join(authors, ", ")
+
+	if language := firstValue(meta.Languages); language != "" {
+		book.Metadata[domain.MetadataLanguage] = language
+	}
+	if publisher := firstValue(meta.Publishers); publisher != "" {
+		book.Metadata[domain.MetadataPublisher] = publisher
+	}
+	if published := publicationDate(meta.Dates); published != "" {
+		book.Metadata[domain.MetadataPublished] = published
+	}
+
+	identifiers := make(map[string]any)
+	for _, id := range meta.Identifiers {
+		scheme, value := identifierScheme(id, refinements[id.ID])
+		if value == "" {
+			continue
+		}
+		if _, exists := identifiers[scheme]; !exists {
+			identifiers[scheme] = value
+		}
+	}
+	if len(identifiers) > 0 {
+		book.Metadata[domain.MetadataIdentifiers] = identifiers
+		if isbn, ok := identifiers["isbn"]; ok {
+			book.Metadata[domain.MetadataISBN] = isbn
+		}
+	}
+
+	subjects := make([]string, 0, len(meta.Subjects))
+	for _, s := range meta.Subjects {
+		subjects = appendUnique(subjects, strings.TrimSpace(s.Value))
+	}
+	if len(subjects) > 0 {
+		book.Metadata[domain.MetadataSubjects] = subjects
+	}
+
+	if description := htmlText(firstValue(meta.Descriptions)); description != "" {
+		book.Metadata[domain.MetadataDescription] = description
+	}
+
+	if series, index := epubSeries(meta.Metas, refinements); series != "" {
+		book.Metadata[domain.MetadataSeries] = series
+		if index != nil {
+			book.Metadata[domain.MetadataSeriesIndex] = index
+		}
+	}
+
+	return book, nil
+}
+
+// readEpubCover returns the cover image of the package: the manifest item with the cover-image property
+// in EPUB 3, the one of the cover meta in EPUB 2, or else the first image named after the cover.
+func readEpubCover(content []byte) (image.Image, error) {
+	archive, pkg, opfPath, err := readEpubPackage(content)
+	if err != nil {
+		return nil, err
+	}
+
+	items := pkg.Manifest.Items
+	cover := slices.IndexFunc(items, func(item opfItem) bool {
+		return slices.Contains(strings.Fields(item.Properties), "cover-image")
+	})
+	if cover < 0 {
+		for _, m := range pkg.Metadata.Metas {
+			if m.Name == "cover" {
+				cover = slices.IndexFunc(items, func(item opfItem) bool { return item.ID == m.Content })
+				break
+			}
+		}
+	}
+	if cover < 0 {
+		cover = slices.IndexFunc(items, func(item opfItem) bool {
+			return strings.HasPrefix(item.MediaType, "image/") &&
+				(strings.Contains(strings.ToLower(item.ID), "cover") || strings.Contains(strings.ToLower(item.Href), "cover"))
+		})
+	}
+	if cover < 0 || !strings.HasPrefix(items[cover].MediaType, "image/") {
+		return nil, ErrNoCover
+	}
+
+	// The manifest paths are URLs relative to the package document
+	href, err := url.PathUnescape(items[cover].Href)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cover path %s: %w", items[cover].Href, err)
+	}
+	f, err := archive.Open(path.Join(path.Dir(opfPath), href))
+	if err != nil {
+		return nil, fmt.Errorf("error opening cover in epub: %w", err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxCoverFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading cover in epub: %w", err)
+	}
+	if len(data) > maxCoverFileSize {
+		return nil, fmt.Errorf("cover file in epub is larger than %d bytes", maxCoverFileSize)
+	}
+	return decodeCover(data)
+}
+
+func readZipXML(archive *zip.Reader, name string, v any) error {
+	f, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("error opening %s in epub: %w", name, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("error reading %s in epub: %w", name, err)
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s in epub: %w", name, err)
+	}
+	return nil
+}
+
+func firstValue(elements []opfElement) string {
+	for _, e := range elements {
+		if v := strings.TrimSpace(e.Value); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func appendUnique(values []string, value string) []string {
+	if value == "" {
+		return values
+	}
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// publicationDate returns the date of publication, without its time, among the EPUB 2 dated events.
+func publicationDate(dates []opfElement) string {
+	for _, d := range dates {
+		if d.Event == "" || strings.EqualFold(d.Event, "publication") {
+			value := strings.TrimSpace(d.Value)
+			if date := dateRe.FindString(value); date != "" {
+				return date
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// identifierScheme returns the lowercase scheme of an identifier, given by its attribute, its EPUB 3
+// refinement or its URN prefix, along with its value. ISBNs are stored without their dashes.
+func identifierScheme(id opfElement, refinements map[string]string) (string, string) {
+	value := strings.TrimSpace(id.Value)
+	scheme := strings.ToLower(id.Scheme)
+	if scheme == "" {
+		// The ONIX codes 02 and 15 are the ISBN-10 and ISBN-13
+		switch refinements["identifier-type"] {
+		case "02", "15":
+			scheme = "isbn"
+		}
+	}
+
+	// Such as urn:isbn:9781491941195 or urn:uuid:…
+	urn := value
+	if len(urn) > 4 && strings.EqualFold(urn[:4], "urn:") {
+		urn = urn[4:]
+	}
+	if name, rest, ok := strings.Cut(urn, ":"); ok {
+		if name = strings.ToLower(name); name == "isbn" || name == "uuid" || name == "doi" {
+			if scheme == "" {
+				scheme = name
+			}
+			value = strings.TrimSpace(rest)
+		}
+	}
+
+	if scheme == "isbn" || (scheme == "" && isbnRe.MatchString(strings.ReplaceAll(value, "-", ""))) {
+		return "isbn", strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(value))
+	}
+	if scheme == "" {
+		scheme = "identifier"
+	}
+	return scheme, value
+}
+
+// epubSeries returns the series of the book and its position in it, from the calibre metadata or else the
+// EPUB 3 collections.
+func epubSeries(metas []opfMeta, refinements map[string]map[string]string) (string, any) {
+	var series, index string
+	for _, m := range metas {
+		switch m.Name {
+		case "calibre:series":
+			series = strings.TrimSpace(m.Content)
+		case "calibre:series_index":
+			index = strings.TrimSpace(m.Content)
+		}
+	}
+	if series == "" {
+		for _, m := range metas {
+			if m.Property != "belongs-to-collection" || m.Refines != "" {
+				continue
+			}
+			if kind := refinements[m.ID]["collection-type"]; kind != "" && kind != "series" {
+				continue
+			}
+			series = strings.TrimSpace(m.Value)
+			index = refinements[m.ID]["group-position"]
+			break
+		}
+	}
+	if series == "" || index == "" {
+		return series, nil
+	}
+	if n, err := strconv.ParseFloat(index, 64); err == nil {
+		return series, n
+	}
+	return series, index
+}
+
+// htmlText returns the text of an HTML fragment, such as the descriptions written by calibre.
+func htmlText(fragment string) string {
+	if !strings.Contains(fragment, "<") {
+		return strings.Join(strings.Fields(fragment), " ")
+	}
+	doc, err := html.Parse(strings.NewReader(fragment))
+	if err != nil {
+		return strings.Join(strings.Fields(fragment), " ")
+	}
+
+	var texts []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			texts = append(texts, n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return strings.Join(strings.Fields(strings.Join(texts, " ")), " ")
+}
@@ -0,0 +1,174 @@
+package loader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+const testContainer = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+func TestReadEpubMetadata_ShouldReadEpub2Package(t *testing.T) {
+	// Given
+	content := buildTestEpub(t, map[string]string{
+		epubContainerPath: testContainer,
+		"OEBPS/content.opf": `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="uuid_id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:title>Concurrency in Go</dc:title>
+    <dc:creator opf:role="aut">Katherine Cox-Buday</dc:creator>
+    <dc:creator opf:role="edt">Dawn Schanafelt</dc:creator>
+    <dc:language>en</dc:language>
+    <dc:publisher>O'Reilly Media</dc:publisher>
+    <dc:date opf:event="modification">2020-01-01</dc:date>
+    <dc:date opf:event="publication">2017-07-19T00:00:00+00:00</dc:date>
+    <dc:identifier id="uuid_id" opf:scheme="uuid">b5a2d3e4-0000-4000-8000-000000000000</dc:identifier>
+    <dc:identifier opf:scheme="ISBN">978-1-4919-4119-5</dc:identifier>
+    <dc:subject>Computers</dc:subject>
+    <dc:subject>Programming</dc:subject>
+    <dc:description>&lt;p&gt;Concurrency can be &lt;b&gt;notoriously&lt;/b&gt; difficult.&lt;/p&gt;&lt;p&gt;Learn it.&lt;/p&gt;</dc:description>
+    <meta name="calibre:series" content="Go in Depth"/>
+    <meta name="calibre:series_index" content="2.0"/>
+  </metadata>
+</package>`,
+	})
+
+	// When
+	book, err := readEpubMetadata(content)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Concurrency in Go", book.Title)
+	assert.Equal(t, "Katherine Cox-Buday", book.Author)
+	assert.Equal(t, map[string]any{
+		domain.MetadataLanguage:  "en",
+		domain.MetadataPublisher: "O'Reilly Media",
+		domain.MetadataPublished: "2017-07-19",
+		domain.MetadataIdentifiers: map[string]any{
+			"uuid": "b5a2d3e4-0000-4000-8000-000000000000",
+			"isbn": "9781491941195",
+		},
+		domain.MetadataISBN:        "9781491941195",
+		domain.MetadataSubjects:    []string{"Computers", "Programming"},
+		domain.MetadataDescription: "Concurrency can be notoriously difficult. Learn it.",
+		domain.MetadataSeries:      "Go in Depth",
+		domain.MetadataSeriesIndex: 2.0,
+	}, book.Metadata)
+}
+
+func TestReadEpubMetadata_ShouldReadEpub3Refinements(t *testing.T) {
+	// Given
+	content := buildTestEpub(t, map[string]string{
+		epubContainerPath: testContainer,
+		"OEBPS/content.opf": `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="pub-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>The Fellowship of the Ring</dc:title>
+    <dc:creator id="creator">J. R. R. Tolkien</dc:creator>
+    <meta refines="#creator" property="role" scheme="marc:relators">aut</meta>
+    <dc:identifier id="pub-id">urn:isbn:9780261102354</dc:identifier>
+    <dc:identifier id="onix-id">0261102354</dc:identifier>
+    <meta refines="#onix-id" property="identifier-type" scheme="onix:codelist5">02</meta>
+    <dc:date>1954</dc:date>
+    <meta property="belongs-to-collection" id="c01">The Lord of the Rings</meta>
+    <meta refines="#c01" property="collection-type">series</meta>
+    <meta refines="#c01" property="group-position">1</meta>
+  </metadata>
+</package>`,
+	})
+
+	// When
+	book, err := readEpubMetadata(content)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "J. R. R. Tolkien", book.Author)
+	assert.Equal(t, "9780261102354", book.Metadata[domain.MetadataISBN])
+	assert.Equal(t, "1954", book.Metadata[domain.MetadataPublished])
+	assert.Equal(t, "The Lord of the Rings", book.Metadata[domain.MetadataSeries])
+	assert.Equal(t, 1.0, book.Metadata[domain.MetadataSeriesIndex])
+}
+
+func TestReadEpubMetadata_ShouldFailWithoutContainer(t *testing.T) {
+	// Given
+	content := buildTestEpub(t, nil)
+
+	// When
+	_, err := readEpubMetadata(content)
+
+	// Then
+	assert.Error(t, err)
+}
+
+func TestReadEpubCover(t *testing.T) {
+	testCases := []struct {
+		name     string
+		manifest string
+		metas    string
+	}{
+		{name: "should read the epub 3 cover image",
+			manifest: `<item id="img" href="images/cover%20art.png" media-type="image/png" properties="cover-image"/>`},
+		{name: "should read the epub 2 cover meta",
+			manifest: `<item id="img" href="images/cover%20art.png" media-type="image/png"/>`,
+			metas:    `<meta name="cover" content="img"/>`},
+		{name: "should fall back on the image named after the cover",
+			manifest: `<item id="page" href="text/page.xhtml" media-type="application/xhtml+xml"/><item id="img" href="images/cover%20art.png" media-type="image/png"/>`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			content := buildTestEpub(t, map[string]string{
+				epubContainerPath: testContainer,
+				"OEBPS/content.opf": `<package xmlns="http://www.idpf.org/2007/opf"><metadata>` + tc.metas +
+					`</metadata><manifest>` + tc.manifest + `</manifest></package>`,
+				"OEBPS/images/cover art.png": string(encodeTestPNG(t, testCover(30, 45))),
+			})
+
+			// When
+			cover, err := readEpubCover(content)
+
+			// Then
+			require.NoError(t, err)
+			assert.Equal(t, 30, cover.Bounds().Dx())
+			assert.Equal(t, 45, cover.Bounds().Dy())
+		})
+	}
+}
+
+func TestReadEpubCover_ShouldFailWithoutCover(t *testing.T) {
+	// Given
+	content := buildTestEpub(t, map[string]string{
+		epubContainerPath:   testContainer,
+		"OEBPS/content.opf": `<package><manifest><item id="page" href="page.xhtml" media-type="application/xhtml+xml"/></manifest></package>`,
+	})
+
+	// When
+	_, err := readEpubCover(content)
+
+	// Then
+	assert.ErrorIs(t, err, ErrNoCover)
+}
+
+func TestReadEpubCover_ShouldFailWithTooLargeCoverFile(t *testing.T) {
+	// Given
+	content := buildTestEpub(t, map[string]string{
+		epubContainerPath:   testContainer,
+		"OEBPS/content.opf": `<package><manifest><item id="img" href="cover.png" media-type="image/png" properties="cover-image"/></manifest></package>`,
+		"OEBPS/cover.png":   strings.Repeat("\x00", maxCoverFileSize+1),
+	})
+
+	// When
+	_, err := readEpubCover(content)
+
+	// Then
+	assert.ErrorContains(t, err, "larger than")
+}
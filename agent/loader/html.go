@@ -0,0 +1,65 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/JohannesKaufmann/dom"
+	"github.com/JohannesKaufmann/html-to-markdown/v2/converter"
+	"github.com/firebase/genkit/go/ai"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"golang.org/x/net/html"
+)
+
+// HTMLLoader loads HTML documents, converted to markdown like the EPUB chapters.
+// The <title> and the author <meta> give the book metadata, and the top level headings start the chapters.
+type HTMLLoader struct {
+	conv *converter.Converter
+}
+
+var _ BookLoader = (*HTMLLoader)(nil)
+
+func NewHTMLLoader() *HTMLLoader {
+	return &HTMLLoader{
+		conv: newHTMLConverter(),
+	}
+}
+
+func (l *HTMLLoader) Load(book domain.Book, file *domain.FileWithContent) ([]*ai.Document, error) {
+	markdown, err := l.conv.ConvertReader(bytes.NewReader(file.Content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert html to markdown: %w", err)
+	}
+	return chapterDocuments(book, splitMarkdownChapters(string(markdown))), nil
+}
+
+// ReadMetadata reads the title and the author from the <head>.
+// Without title, the first <h1>, or else the file name, stands for it.
+func (l *HTMLLoader) ReadMetadata(file *domain.FileWithContent) (domain.Book, error) {
+	doc, err := html.Parse(bytes.NewReader(file.Content))
+	if err != nil {
+		return domain.Book{}, fmt.Errorf("error parsing html file: %w", err)
+	}
+
+	book := domain.Book{File: file.File}
+	if title := dom.FindFirstNode(doc, func(n *html.Node) bool { return dom.NodeName(n) == "title" }); title != nil {
+		book.Title = strings.Join(strings.Fields(dom.CollectText(title)), " ")
+	}
+	author := dom.FindFirstNode(doc, func(n *html.Node) bool {
+		return dom.NodeName(n) == "meta" && strings.EqualFold(dom.GetAttributeOr(n, "name", ""), "author")
+	})
+	if author != nil {
+		book.Author = strings.TrimSpace(dom.GetAttributeOr(author, "content", ""))
+	}
+
+	if book.Title == "" {
+		if h1 := dom.FindFirstNode(doc, func(n *html.Node) bool { return dom.NodeName(n) == "h1" }); h1 != nil {
+			book.Title = strings.Join(strings.Fields(dom.CollectText(h1)), " ")
+		}
+	}
+	if book.Title == "" {
+		book.Title = titleFromFileName(file.Name)
+	}
+	return book, nil
+}
@@ -0,0 +1,82 @@
+package loader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+const testHTML = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Concurrency
+    in Go</title>
+  <meta name="author" content="Katherine Cox-Buday">
+</head>
+<body>
+  <p>Some foreword.</p>
+  <h1>Goroutines</h1>
+  <p>Goroutines are <a href="#">cheap</a>.</p>
+  <h2>Scheduling</h2>
+  <p>They are multiplexed.</p>
+  <h1>Channels</h1>
+  <p>Channels connect them.</p>
+</body>
+</html>`
+
+func TestHTMLLoader_ShouldMapTopLevelHeadingsToChapters(t *testing.T) {
+	// Given
+	file := &domain.FileWithContent{File: domain.File{Name: "book.html"}, Content: []byte(testHTML)}
+	book := domain.Book{ID: "1", Title: "Concurrency in Go"}
+
+	// When
+	docs, err := NewHTMLLoader().Load(book, file)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+	assert.Equal(t, "Concurrency in Go", docs[0].Metadata["chapter_title"])
+	assert.Equal(t, "Some foreword.", docs[0].Content[0].Text)
+	assert.Equal(t, "Goroutines", docs[1].Metadata["chapter_title"])
+	assert.Contains(t, docs[1].Content[0].Text, "## Scheduling")
+	assert.NotContains(t, docs[1].Content[0].Text, "](#)")
+	assert.Equal(t, map[string]any{
+		"chapter_title": "Channels",
+		"chapter_index": 2,
+		"book_id":       "1",
+	}, docs[2].Metadata)
+}
+
+func TestHTMLLoader_ReadMetadata(t *testing.T) {
+	testCases := []struct {
+		name           string
+		file           string
+		content        string
+		expectedTitle  string
+		expectedAuthor string
+	}{
+		{name: "should read the head", file: "book.html", content: testHTML,
+			expectedTitle: "Concurrency in Go", expectedAuthor: "Katherine Cox-Buday"},
+		{name: "should fall back on the first heading", file: "book.html", content: "<h2>Intro</h2><h1>Go Notes</h1>",
+			expectedTitle: "Go Notes"},
+		{name: "should fall back on the file name", file: "go-notes.htm", content: "<p>Some text.</p>",
+			expectedTitle: "go notes"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			file := &domain.FileWithContent{File: domain.File{Name: tc.file}, Content: []byte(tc.content)}
+
+			// When
+			book, err := NewHTMLLoader().ReadMetadata(file)
+
+			// Then
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedTitle, book.Title)
+			assert.Equal(t, tc.expectedAuthor, book.Author)
+		})
+	}
+}
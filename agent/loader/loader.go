@@ -7,4 +7,6 @@ import (
 
 type BookLoader interface {
 	Load(book domain.Book, file *domain.FileWithContent) ([]*ai.Document, error)
+	// ReadMetadata reads the title, the author and the metadata of the book file, without loading its content.
+	ReadMetadata(file *domain.FileWithContent) (domain.Book, error)
 }
@@ -0,0 +1,185 @@
+package loader
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	markdownHeadingRe = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	markdownFenceRe   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+)
+
+// MarkdownLoader loads markdown documents. The YAML front matter gives the title, the author
+// and the book metadata, and the top level headings start the chapters.
+type MarkdownLoader struct{}
+
+var _ BookLoader = (*MarkdownLoader)(nil)
+
+func NewMarkdownLoader() *MarkdownLoader {
+	return &MarkdownLoader{}
+}
+
+func (l *MarkdownLoader) Load(book domain.Book, file *domain.FileWithContent) ([]*ai.Document, error) {
+	_, body, err := splitFrontMatter(file.Content)
+	if err != nil {
+		return nil, err
+	}
+	return chapterDocuments(book, splitMarkdownChapters(body)), nil
+}
+
+// ReadMetadata reads the "title" and "author" of the front matter, the other keys become the book metadata
+// except the ones the application writes, such as the cover.
+// Without title, the first top level heading, or else the file name, stands for it.
+func (l *MarkdownLoader) ReadMetadata(file *domain.FileWithContent) (domain.Book, error) {
+	frontMatter, body, err := splitFrontMatter(file.Content)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	book := domain.Book{File: file.File, Metadata: make(map[string]any)}
+	for k, v := range frontMatter {
+		switch strings.ToLower(k) {
+		case "title":
+			book.Title = strings.TrimSpace(fmt.Sprint(v))
+		case "author", "authors":
+			book.Author = frontMatterText(v)
+		default:
+			if domain.IsReservedMetadata(k) {
+				continue
+			}
+			book.Metadata[k] = v
+		}
+	}
+
+	if book.Title == "" {
+		if chapters := splitMarkdownChapters(body); len(chapters) > 0 && chapters[0].level == 1 {
+			book.Title = chapters[0].title
+		}
+	}
+	if book.Title == "" {
+		book.Title = titleFromFileName(file.Name)
+	}
+	return book, nil
+}
+
+// splitFrontMatter returns the YAML front matter, between "---" lines at the top of the document,
+// and the markdown following it.
+func splitFrontMatter(content []byte) (map[string]any, string, error) {
+	text := strings.TrimPrefix(strings.ReplaceAll(string(content), "\r\n", "\n"), "\ufeff")
+	lines := strings.Split(text, "\n")
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return nil, text, nil
+	}
+
+	for i := 1; i < len(lines); i++ {
+		if end := strings.TrimSpace(lines[i]); end != "---" && end != "..." {
+			continue
+		}
+		frontMatter := make(map[string]any)
+		if err := yaml.Unmarshal([]byte(strings.Join(lines[1:i], "\n")), &frontMatter); err != nil {
+			return nil, "", fmt.Errorf("invalid front matter: %w", err)
+		}
+		return frontMatter, strings.Join(lines[i+1:], "\n"), nil
+	}
+	return nil, text, nil
+}
+
+// frontMatterText joins the items of a list, like the authors of a document.
+func frontMatterText(v any) string {
+	if items, ok := v.([]any); ok {
+		texts := make([]string, len(items))
+		for i, item := range items {
+			texts[i] = strings.TrimSpace(fmt.Sprint(item))
+		}
+		return strings.Join(texts, ", ")
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
+
+type markdownChapter struct {
+	title   string
+	level   int
+	content string
+}
+
+// splitMarkdownChapters cuts the markdown before each heading of the highest level found, ignoring the
+// code blocks. The text before the first heading makes an untitled chapter.
+func splitMarkdownChapters(markdown string) []markdownChapter {
+	lines := strings.Split(markdown, "\n")
+
+	levels := make([]int, len(lines))
+	topLevel := 0
+	fence := ""
+	for i, line := range lines {
+		if m := markdownFenceRe.FindStringSubmatch(line); m != nil {
+			switch {
+			case fence == "":
+				fence = m[1]
+			case strings.HasPrefix(m[1], fence):
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		if m := markdownHeadingRe.FindStringSubmatch(line); m != nil {
+			levels[i] = len(m[1])
+			if topLevel == 0 || levels[i] < topLevel {
+				topLevel = levels[i]
+			}
+		}
+	}
+
+	chapters := make([]markdownChapter, 0)
+	current := markdownChapter{}
+	start := 0
+	flush := func(end int) {
+		current.content = strings.TrimSpace(strings.Join(lines[start:end], "\n"))
+		if current.content != "" {
+			chapters = append(chapters, current)
+		}
+	}
+	for i, line := range lines {
+		if topLevel == 0 || levels[i] != topLevel {
+			continue
+		}
+		flush(i)
+		m := markdownHeadingRe.FindStringSubmatch(line)
+		current = markdownChapter{title: strings.TrimSpace(m[2]), level: topLevel}
+		start = i
+	}
+	flush(len(lines))
+	return chapters
+}
+
+// chapterDocuments makes a document per chapter. The untitled ones are named after the book.
+func chapterDocuments(book domain.Book, chapters []markdownChapter) []*ai.Document {
+	documents := make([]*ai.Document, 0, len(chapters))
+	for i, chapter := range chapters {
+		title := chapter.title
+		if title == "" {
+			title = book.Title
+		}
+		documents = append(documents, ai.DocumentFromText(chapter.content, map[string]any{
+			"chapter_title": title,
+			"chapter_index": i,
+			"book_id":       book.ID,
+		}))
+	}
+	return documents
+}
+
+// titleFromFileName returns the file name without its extension, its dashes and its underscores.
+func titleFromFileName(name string) string {
+	title := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	title = strings.NewReplacer("_", " ", "-", " ").Replace(title)
+	return strings.Join(strings.Fields(title), " ")
+}
@@ -0,0 +1,135 @@
+package loader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+const testMarkdown = `---
+title: Concurrency in Go
+authors:
+  - Katherine Cox-Buday
+year: 2017
+---
+Some foreword.
+
+# Goroutines
+
+Goroutines are cheap.
+
+` + "```" + `sh
+# not a chapter
+go run main.go
+` + "```" + `
+
+## Scheduling
+
+They are multiplexed.
+
+# Channels ##
+
+Channels connect them.
+`
+
+func TestMarkdownLoader_ShouldMapTopLevelHeadingsToChapters(t *testing.T) {
+	// Given
+	file := &domain.FileWithContent{File: domain.File{Name: "book.md"}, Content: []byte(testMarkdown)}
+	book := domain.Book{ID: "1", Title: "Concurrency in Go"}
+
+	// When
+	docs, err := NewMarkdownLoader().Load(book, file)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+	assert.Equal(t, map[string]any{
+		"chapter_title": "Concurrency in Go",
+		"chapter_index": 0,
+		"book_id":       "1",
+	}, docs[0].Metadata)
+	assert.Equal(t, "Some foreword.", docs[0].Content[0].Text)
+	assert.Equal(t, "Goroutines", docs[1].Metadata["chapter_title"])
+	assert.Contains(t, docs[1].Content[0].Text, "# not a chapter")
+	assert.Contains(t, docs[1].Content[0].Text, "## Scheduling\n\nThey are multiplexed.")
+	assert.Equal(t, "Channels", docs[2].Metadata["chapter_title"])
+	assert.Equal(t, "# Channels ##\n\nChannels connect them.", docs[2].Content[0].Text)
+}
+
+func TestMarkdownLoader_ReadMetadata(t *testing.T) {
+	testCases := []struct {
+		name           string
+		file           string
+		content        string
+		expectedTitle  string
+		expectedAuthor string
+	}{
+		{name: "should read the front matter", file: "book.md", content: testMarkdown,
+			expectedTitle: "Concurrency in Go", expectedAuthor: "Katherine Cox-Buday"},
+		{name: "should fall back on the first heading", file: "book.md", content: "# Go Notes\n\nSome text.",
+			expectedTitle: "Go Notes"},
+		{name: "should fall back on the file name", file: "go_notes-2024.md", content: "Some text.\n\n## Details",
+			expectedTitle: "go notes 2024"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			file := &domain.FileWithContent{File: domain.File{Name: tc.file}, Content: []byte(tc.content)}
+
+			// When
+			book, err := NewMarkdownLoader().ReadMetadata(file)
+
+			// Then
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedTitle, book.Title)
+			assert.Equal(t, tc.expectedAuthor, book.Author)
+			assert.Equal(t, file.File, book.File)
+		})
+	}
+}
+
+func TestMarkdownLoader_ReadMetadata_ShouldKeepOtherFrontMatterKeys(t *testing.T) {
+	// Given
+	file := &domain.FileWithContent{File: domain.File{Name: "book.md"}, Content: []byte(testMarkdown)}
+
+	// When
+	book, err := NewMarkdownLoader().ReadMetadata(file)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"year": 2017}, book.Metadata)
+}
+
+func TestMarkdownLoader_ReadMetadata_ShouldDropReservedFrontMatterKeys(t *testing.T) {
+	// Given
+	content := "---\ntitle: Notes\ncover: ../../../../etc/passwd\nsplitter: recursive\nError: failed\nchunk_context: none\nlanguage: en\n---\nSome text.\n"
+	file := &domain.FileWithContent{File: domain.File{Name: "notes.md"}, Content: []byte(content)}
+
+	// When
+	book, err := NewMarkdownLoader().ReadMetadata(file)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{domain.MetadataLanguage: "en"}, book.Metadata)
+}
+
+func TestTextLoader_ShouldLoadASingleChapter(t *testing.T) {
+	// Given
+	file := &domain.FileWithContent{File: domain.File{Name: "release_notes.txt"}, Content: []byte("# Not a heading\r\nSome text.\r\n")}
+	loader := NewTextLoader()
+
+	// When
+	book, err := loader.ReadMetadata(file)
+	require.NoError(t, err)
+	docs, err := loader.Load(domain.Book{ID: "1", Title: book.Title}, file)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "release notes", book.Title)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "release notes", docs[0].Metadata["chapter_title"])
+	assert.Equal(t, "# Not a heading\nSome text.", docs[0].Content[0].Text)
+}
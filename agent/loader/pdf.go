@@ -0,0 +1,272 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/ledongthuc/pdf"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+// pdfPagesPerChapter groups the pages of a PDF without outline into chapters of that many pages.
+const pdfPagesPerChapter = 10
+
+// PDFLoader extracts the text of a PDF book page by page, in pure Go.
+// The top level entries of the outline become the chapters, each one spanning the pages up to the next one.
+// Without outline, the pages are grouped by pdfPagesPerChapter. The chapters without title are named after their pages.
+// Each document carries its first and last pages as "page_start" and "page_end" metadata.
+type PDFLoader struct{}
+
+var _ BookLoader = (*PDFLoader)(nil)
+
+func NewPDFLoader() *PDFLoader {
+	return &PDFLoader{}
+}
+
+// pdfChapter is a range of pages, numbered from 1.
+type pdfChapter struct {
+	title string
+	start int
+	end   int
+}
+
+func (l *PDFLoader) Load(book domain.Book, file *domain.FileWithContent) (docs []*ai.Document, err error) {
+	// The PDF reader panics on malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			docs = nil
+			err = fmt.Errorf("error reading pdf content: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(file.Content), int64(len(file.Content)))
+	if err != nil {
+		return nil, fmt.Errorf("error opening pdf content: %w", err)
+	}
+
+	numPages := reader.NumPage()
+	pages := make([]string, numPages+1)
+	fonts := make(map[string]*pdf.Font)
+	for i := 1; i <= numPages; i++ {
+		page := reader.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				f := page.Font(name)
+				fonts[name] = &f
+			}
+		}
+		text, err := page.GetPlainText(fonts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get text of page %d: %w", i, err)
+		}
+		pages[i] = cleanPDFText(text)
+	}
+
+	chapters := pdfOutlineChapters(reader, numPages)
+	if len(chapters) == 0 {
+		chapters = pdfPageChapters(numPages)
+	}
+
+	documents := make([]*ai.Document, 0, len(chapters))
+	for i, chapter := range chapters {
+		texts := make([]string, 0, chapter.end-chapter.start+1)
+		for p := chapter.start; p <= chapter.end; p++ {
+			if pages[p] != "" {
+				texts = append(texts, pages[p])
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+
+		title := chapter.title
+		content := strings.Join(texts, "\n\n")
+		if title != "" {
+			content = "# " + title + "\n\n" + content
+		} else {
+			title = fmt.Sprintf("Pages %d-%d", chapter.start, chapter.end)
+		}
+		documents = append(documents, ai.DocumentFromText(content, map[string]any{
+			"chapter_title": title,
+			"chapter_index": i,
+			"book_id":       book.ID,
+			"page_start":    chapter.start,
+			"page_end":      chapter.end,
+		}))
+	}
+
+	if len(documents) == 0 {
+		return nil, errors.New("no text found in pdf, it may only contain scanned images")
+	}
+	return documents, nil
+}
+
+// ReadMetadata reads the title and the author from the document information dictionary.
+// The file name stands for the title when it is not set.
+func (l *PDFLoader) ReadMetadata(file *domain.FileWithContent) (book domain.Book, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			book = domain.Book{}
+			err = fmt.Errorf("error reading pdf info: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(file.Content), int64(len(file.Content)))
+	if err != nil {
+		return domain.Book{}, fmt.Errorf("error opening pdf file: %w", err)
+	}
+
+	info := reader.Trailer().Key("Info")
+	title := strings.TrimSpace(info.Key("Title").Text())
+	if title == "" {
+		title = titleFromFileName(file.Name)
+	}
+
+	return domain.Book{
+		Title:  title,
+		Author: strings.TrimSpace(info.Key("Author").Text()),
+		File:   file.File,
+	}, nil
+}
+
+// pdfOutlineChapters maps the top level outline entries to the pages they point to.
+// An outline made of a single entry, usually the book title, is skipped for its children.
+// The pages before the first entry make an untitled chapter.
+func pdfOutlineChapters(reader *pdf.Reader, numPages int) []pdfChapter {
+	root := reader.Trailer().Key("Root")
+	entries := outlineChildren(root.Key("Outlines"))
+	if len(entries) == 1 {
+		if children := outlineChildren(entries[0]); len(children) > 0 {
+			entries = children
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	pageNumbers := make(map[string]int, numPages)
+	for i := 1; i <= numPages; i++ {
+		pageNumbers[reader.Page(i).V.String()] = i
+	}
+
+	chapters := make([]pdfChapter, 0, len(entries)+1)
+	for _, entry := range entries {
+		dest := outlineDestination(root, entry)
+		if dest.Kind() != pdf.Array || dest.Len() == 0 {
+			continue
+		}
+		page, ok := pageNumbers[dest.Index(0).String()]
+		if !ok {
+			continue
+		}
+		chapters = append(chapters, pdfChapter{title: strings.TrimSpace(entry.Key("Title").Text()), start: page})
+	}
+	if len(chapters) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(chapters, func(i, j int) bool { return chapters[i].start < chapters[j].start })
+	if chapters[0].start > 1 {
+		chapters = append([]pdfChapter{{start: 1}}, chapters...)
+	}
+
+	// Entries pointing to the same page are merged into the first one
+	merged := chapters[:0]
+	for _, c := range chapters {
+		if len(merged) > 0 && merged[len(merged)-1].start == c.start {
+			continue
+		}
+		merged = append(merged, c)
+	}
+	for i := range merged {
+		merged[i].end = numPages
+		if i+1 < len(merged) {
+			merged[i].end = merged[i+1].start - 1
+		}
+	}
+	return merged
+}
+
+func outlineChildren(entry pdf.Value) []pdf.Value {
+	children := make([]pdf.Value, 0)
+	for child := entry.Key("First"); child.Kind() == pdf.Dict; child = child.Key("Next") {
+		children = append(children, child)
+	}
+	return children
+}
+
+// outlineDestination returns the explicit destination of an outline entry, an array starting with the page.
+// The destination is either set directly or through a GoTo action, and may be named.
+func outlineDestination(root, entry pdf.Value) pdf.Value {
+	dest := entry.Key("Dest")
+	if dest.IsNull() {
+		action := entry.Key("A")
+		if action.Key("S").Name() != "GoTo" {
+			return pdf.Value{}
+		}
+		dest = action.Key("D")
+	}
+
+	switch dest.Kind() {
+	case pdf.Name:
+		dest = root.Key("Dests").Key(dest.Name())
+	case pdf.String:
+		dest = lookupNameTree(root.Key("Names").Key("Dests"), dest.RawString())
+	}
+	if dest.Kind() == pdf.Dict {
+		dest = dest.Key("D")
+	}
+	return dest
+}
+
+// lookupNameTree returns the value of the key in a PDF name tree.
+func lookupNameTree(node pdf.Value, key string) pdf.Value {
+	names := node.Key("Names")
+	for i := 0; i+1 < names.Len(); i += 2 {
+		if names.Index(i).RawString() == key {
+			return names.Index(i + 1)
+		}
+	}
+	kids := node.Key("Kids")
+	for i := 0; i < kids.Len(); i++ {
+		kid := kids.Index(i)
+		limits := kid.Key("Limits")
+		if limits.Len() == 2 && (key < limits.Index(0).RawString() || key > limits.Index(1).RawString()) {
+			continue
+		}
+		if v := lookupNameTree(kid, key); !v.IsNull() {
+			return v
+		}
+	}
+	return pdf.Value{}
+}
+
+// pdfPageChapters groups the pages by pdfPagesPerChapter, for the PDF without outline.
+func pdfPageChapters(numPages int) []pdfChapter {
+	chapters := make([]pdfChapter, 0, numPages/pdfPagesPerChapter+1)
+	for start := 1; start <= numPages; start += pdfPagesPerChapter {
+		end := min(start+pdfPagesPerChapter-1, numPages)
+		chapters = append(chapters, pdfChapter{start: start, end: end})
+	}
+	return chapters
+}
+
+// cleanPDFText trims the lines of a page and drops the empty ones.
+func cleanPDFText(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,114 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+var _ CoverReader = (*PDFLoader)(nil)
+
+// ReadCover returns the largest image of the first page, which is the cover of most PDF books.
+// The page itself is not rendered, so the covers made of text and vector graphics are not found.
+// The PDF reader does not give access to the undecoded streams, so the JPEG images are not read either.
+func (l *PDFLoader) ReadCover(file *domain.FileWithContent) (cover image.Image, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			cover = nil
+			err = fmt.Errorf("error reading pdf cover: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(file.Content), int64(len(file.Content)))
+	if err != nil {
+		return nil, fmt.Errorf("error opening pdf content: %w", err)
+	}
+	if reader.NumPage() == 0 {
+		return nil, ErrNoCover
+	}
+
+	var largest pdf.Value
+	var largestArea int64
+	xObjects := reader.Page(1).Resources().Key("XObject")
+	for _, name := range xObjects.Keys() {
+		xObject := xObjects.Key(name)
+		if xObject.Key("Subtype").Name() != "Image" {
+			continue
+		}
+		if area := xObject.Key("Width").Int64() * xObject.Key("Height").Int64(); area > largestArea {
+			largest, largestArea = xObject, area
+		}
+	}
+	if largestArea == 0 {
+		return nil, ErrNoCover
+	}
+	return decodePDFImage(largest)
+}
+
+// decodePDFImage decodes the raw 8 bits gray, RGB and CMYK images.
+func decodePDFImage(xObject pdf.Value) (image.Image, error) {
+	width, height := int(xObject.Key("Width").Int64()), int(xObject.Key("Height").Int64())
+	if err := checkCoverSize(width, height); err != nil {
+		return nil, err
+	}
+
+	filter := xObject.Key("Filter")
+	if filter.Kind() == pdf.Array {
+		filter = filter.Index(filter.Len() - 1)
+	}
+	switch filter.Name() {
+	case "", "FlateDecode":
+	default:
+		return nil, ErrNoCover
+	}
+
+	if bits := xObject.Key("BitsPerComponent").Int64(); bits != 8 {
+		return nil, ErrNoCover
+	}
+	components := pdfColorComponents(xObject.Key("ColorSpace"))
+	if components == 0 {
+		return nil, ErrNoCover
+	}
+	data, err := io.ReadAll(io.LimitReader(xObject.Reader(), int64(width*height*components)))
+	if err != nil {
+		return nil, fmt.Errorf("error reading pdf image: %w", err)
+	}
+	if len(data) < width*height*components {
+		return nil, ErrNoCover
+	}
+	rect := image.Rect(0, 0, width, height)
+	switch components {
+	case 1:
+		return &image.Gray{Pix: data, Stride: width, Rect: rect}, nil
+	case 4:
+		return &image.CMYK{Pix: data, Stride: 4 * width, Rect: rect}, nil
+	default:
+		img := image.NewRGBA(rect)
+		for i := 0; i < width*height; i++ {
+			copy(img.Pix[4*i:], data[3*i:3*i+3])
+			img.Pix[4*i+3] = 0xff
+		}
+		return img, nil
+	}
+}
+
+// pdfColorComponents returns the number of components of the gray, RGB and CMYK color spaces, or 0.
+func pdfColorComponents(colorSpace pdf.Value) int {
+	if colorSpace.Kind() == pdf.Array && colorSpace.Index(0).Name() == "ICCBased" {
+		return int(colorSpace.Index(1).Key("N").Int64())
+	}
+	switch colorSpace.Name() {
+	case "DeviceGray":
+		return 1
+	case "DeviceRGB":
+		return 3
+	case "DeviceCMYK":
+		return 4
+	default:
+		return 0
+	}
+}
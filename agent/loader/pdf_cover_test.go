@@ -0,0 +1,84 @@
+package loader
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+// buildTestPDFWithImage writes a single page PDF drawing an image stream of the given size and filter.
+func buildTestPDFWithImage(data []byte, filter string, width, height int) []byte {
+	drawing := "q 612 0 0 792 0 0 cm /Im0 Do Q"
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 5 0 R /Resources << /XObject << /Im0 4 0 R >> >> >>",
+		fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /%s /Length %d >>\nstream\n%s\nendstream",
+			width, height, filter, len(data), data),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(drawing), drawing),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestPDFLoader_ReadCover_ShouldNotDecodeJPEGImage(t *testing.T) {
+	// Given
+	var img bytes.Buffer
+	require.NoError(t, jpeg.Encode(&img, testCover(60, 90), nil))
+	file := &domain.FileWithContent{File: domain.File{Name: "book.pdf"}, Content: buildTestPDFWithImage(img.Bytes(), "DCTDecode", 60, 90)}
+
+	// When
+	_, err := NewPDFLoader().ReadCover(file)
+
+	// Then
+	assert.ErrorIs(t, err, ErrNoCover)
+}
+
+func TestPDFLoader_ReadCover_ShouldDecodeRawImage(t *testing.T) {
+	// Given
+	var img bytes.Buffer
+	w := zlib.NewWriter(&img)
+	_, err := w.Write(bytes.Repeat([]byte{0x20, 0x60, 0xa0}, 4*6))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	file := &domain.FileWithContent{File: domain.File{Name: "book.pdf"}, Content: buildTestPDFWithImage(img.Bytes(), "FlateDecode", 4, 6)}
+
+	// When
+	cover, err := NewPDFLoader().ReadCover(file)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, 4, cover.Bounds().Dx())
+	r, g, b, _ := cover.At(1, 2).RGBA()
+	assert.Equal(t, []uint32{0x20, 0x60, 0xa0}, []uint32{r >> 8, g >> 8, b >> 8})
+}
+
+func TestPDFLoader_ReadCover_ShouldFailWithoutImage(t *testing.T) {
+	// Given
+	file := &domain.FileWithContent{File: domain.File{Name: "book.pdf"}, Content: buildTestPDF([]string{"Some text."}, nil, "", "")}
+
+	// When
+	_, err := NewPDFLoader().ReadCover(file)
+
+	// Then
+	assert.ErrorIs(t, err, ErrNoCover)
+}
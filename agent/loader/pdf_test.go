@@ -0,0 +1,147 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+type testOutlineEntry struct {
+	title string
+	page  int
+}
+
+// buildTestPDF writes a PDF with one line of text per page, the outline entries pointing to their page
+// and the title and author in the information dictionary.
+func buildTestPDF(pages []string, outline []testOutlineEntry, title, author string) []byte {
+	// 1: catalog, 2: pages, 3: font, 4: info, 5: outlines, then the outline entries, then a page and its content
+	objects := []string{"", "", "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Title (%s) /Author (%s) >>", title, author), ""}
+	firstEntry := len(objects) + 1
+	firstPage := firstEntry + len(outline)
+	pageRef := func(i int) string { return fmt.Sprintf("%d 0 R", firstPage+2*i) }
+
+	for i, entry := range outline {
+		obj := fmt.Sprintf("<< /Title (%s) /Parent 5 0 R /Dest [%s /XYZ 0 792 0]", entry.title, pageRef(entry.page-1))
+		if i+1 < len(outline) {
+			obj += fmt.Sprintf(" /Next %d 0 R", firstEntry+i+1)
+		}
+		objects = append(objects, obj+" >>")
+	}
+
+	kids := make([]string, len(pages))
+	for i, text := range pages {
+		kids[i] = pageRef(i)
+		stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R /Resources << /Font << /F1 3 0 R >> >> >>",
+				firstPage+2*i+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		)
+	}
+
+	if len(outline) > 0 {
+		objects[0] = "<< /Type /Catalog /Pages 2 0 R /Outlines 5 0 R >>"
+		objects[4] = fmt.Sprintf("<< /Type /Outlines /First %d 0 R /Last %d 0 R /Count %d >>",
+			firstEntry, firstEntry+len(outline)-1, len(outline))
+	} else {
+		objects[0] = "<< /Type /Catalog /Pages 2 0 R >>"
+		objects[4] = "<< /Type /Outlines /Count 0 >>"
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestPDFLoader_ShouldMapOutlineToChapters(t *testing.T) {
+	// Given
+	content := buildTestPDF(
+		[]string{"Copyright page", "Goroutines are cheap.", "They are multiplexed.", "Channels connect them."},
+		[]testOutlineEntry{{title: "Goroutines", page: 2}, {title: "Channels", page: 4}},
+		"Concurrency in Go", "Katherine Cox-Buday",
+	)
+	file := &domain.FileWithContent{File: domain.File{Name: "book.pdf"}, Content: content}
+
+	// When
+	docs, err := NewPDFLoader().Load(domain.Book{ID: "1"}, file)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, docs, 3)
+	assert.Equal(t, map[string]any{
+		"chapter_title": "Pages 1-1",
+		"chapter_index": 0,
+		"book_id":       "1",
+		"page_start":    1,
+		"page_end":      1,
+	}, docs[0].Metadata)
+	assert.Equal(t, "# Goroutines\n\nGoroutines are cheap.\n\nThey are multiplexed.", docs[1].Content[0].Text)
+	assert.Equal(t, 2, docs[1].Metadata["page_start"])
+	assert.Equal(t, 3, docs[1].Metadata["page_end"])
+	assert.Equal(t, "Channels", docs[2].Metadata["chapter_title"])
+	assert.Equal(t, 4, docs[2].Metadata["page_start"])
+	assert.Equal(t, 4, docs[2].Metadata["page_end"])
+}
+
+func TestPDFLoader_ShouldGroupPagesWithoutOutline(t *testing.T) {
+	// Given
+	pages := make([]string, 12)
+	for i := range pages {
+		pages[i] = fmt.Sprintf("Page number %d.", i+1)
+	}
+	file := &domain.FileWithContent{File: domain.File{Name: "book.pdf"}, Content: buildTestPDF(pages, nil, "", "")}
+
+	// When
+	docs, err := NewPDFLoader().Load(domain.Book{ID: "1"}, file)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, docs, 2)
+	assert.Equal(t, "Pages 1-10", docs[0].Metadata["chapter_title"])
+	assert.Equal(t, "Pages 11-12", docs[1].Metadata["chapter_title"])
+	assert.Equal(t, "Page number 11.\n\nPage number 12.", docs[1].Content[0].Text)
+}
+
+func TestPDFLoader_ReadMetadata(t *testing.T) {
+	// Given
+	content := buildTestPDF([]string{"Some text."}, nil, "Concurrency in Go", "Katherine Cox-Buday")
+	file := &domain.FileWithContent{File: domain.File{Name: "book.pdf"}, Content: content}
+
+	// When
+	book, err := NewPDFLoader().ReadMetadata(file)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Concurrency in Go", book.Title)
+	assert.Equal(t, "Katherine Cox-Buday", book.Author)
+	assert.Equal(t, file.File, book.File)
+}
+
+func TestPDFLoader_ShouldFailOnInvalidFile(t *testing.T) {
+	// Given
+	file := &domain.FileWithContent{File: domain.File{Name: "book.pdf"}, Content: []byte("not a pdf")}
+
+	// When
+	_, err := NewPDFLoader().Load(domain.Book{ID: "1"}, file)
+
+	// Then
+	assert.Error(t, err)
+}
@@ -0,0 +1,189 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+// ErrUnsupportedFormat is returned for the files no registered loader can read.
+var ErrUnsupportedFormat = errors.New("unsupported book format")
+
+// Format describes the files a loader reads: their MIME types and their extensions, with the leading dot.
+// The MIME types are matched exactly, or through the aliases of the sniffed type, never through its parents:
+// a format of text/plain does not read the JSON or CSV files.
+type Format struct {
+	Name      string
+	MimeTypes []string
+	// FallbackMimeTypes are too generic to tell the format on their own, such as text/plain sniffed for
+	// any text file: they are only accepted along with one of the extensions.
+	FallbackMimeTypes []string
+	Extensions        []string
+}
+
+type registeredFormat struct {
+	Format
+	loader BookLoader
+}
+
+// Registry picks the loader of a book file from its content, sniffed for its MIME type, then from its extension.
+// It is a BookLoader itself, so that new formats are added in a single place.
+type Registry struct {
+	formats []registeredFormat
+}
+
+var (
+	_ BookLoader  = (*Registry)(nil)
+	_ CoverReader = (*Registry)(nil)
+)
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewDefaultRegistry returns a registry of all the supported formats.
+func NewDefaultRegistry(repository domain.BookRepository) *Registry {
+	return NewRegistry().
+		Register(Format{
+			Name:       "EPUB",
+			MimeTypes:  []string{"application/epub+zip"},
+			Extensions: []string{".epub"},
+		}, NewLocalEpubLoader(repository)).
+		Register(Format{
+			Name:       "PDF",
+			MimeTypes:  []string{"application/pdf"},
+			Extensions: []string{".pdf"},
+		}, NewPDFLoader()).
+		Register(Format{
+			Name:       "HTML",
+			MimeTypes:  []string{"text/html"},
+			Extensions: []string{".html", ".htm"},
+		}, NewHTMLLoader()).
+		Register(Format{
+			Name:              "Markdown",
+			MimeTypes:         []string{"text/markdown"},
+			FallbackMimeTypes: []string{"text/plain"},
+			Extensions:        []string{".md", ".markdown"},
+		}, NewMarkdownLoader()).
+		Register(Format{
+			Name:              "Text",
+			FallbackMimeTypes: []string{"text/plain"},
+			Extensions:        []string{".txt"},
+		}, NewTextLoader())
+}
+
+// Register adds the loader of a format. The formats registered first win when several ones match a file.
+func (r *Registry) Register(format Format, loader BookLoader) *Registry {
+	r.formats = append(r.formats, registeredFormat{Format: format, loader: loader})
+	return r
+}
+
+// Extensions returns the extensions of all the registered formats.
+func (r *Registry) Extensions() []string {
+	extensions := make([]string, 0, len(r.formats))
+	for _, f := range r.formats {
+		extensions = append(extensions, f.Extensions...)
+	}
+	return extensions
+}
+
+// Detect returns the format of the file along with its loader.
+// The content decides: the format of the file extension is picked when it accepts the sniffed MIME type,
+// otherwise the first format accepting it. The extension only breaks the ties, such as a markdown file
+// sniffed as plain text, so that a PDF renamed as .epub is still read as a PDF.
+func (r *Registry) Detect(file *domain.FileWithContent) (Format, BookLoader, error) {
+	mime := mimetype.Detect(file.Content)
+	ext := strings.ToLower(filepath.Ext(file.Name))
+
+	var candidate *registeredFormat
+	for i, f := range r.formats {
+		if !f.accepts(mime, ext) {
+			continue
+		}
+		if f.hasExtension(ext) {
+			return f.Format, f.loader, nil
+		}
+		if candidate == nil {
+			candidate = &r.formats[i]
+		}
+	}
+	if candidate == nil {
+		return Format{}, nil, fmt.Errorf("%w: %s file %s", ErrUnsupportedFormat, mime.String(), file.Name)
+	}
+	return candidate.Format, candidate.loader, nil
+}
+
+func (r *Registry) Load(book domain.Book, file *domain.FileWithContent) ([]*ai.Document, error) {
+	_, loader, err := r.Detect(file)
+	if err != nil {
+		return nil, err
+	}
+	return loader.Load(book, file)
+}
+
+// ReadMetadata reads the book with the loader of its format. The format is recorded in the metadata.
+func (r *Registry) ReadMetadata(file *domain.FileWithContent) (domain.Book, error) {
+	format, loader, err := r.Detect(file)
+	if err != nil {
+		return domain.Book{}, err
+	}
+
+	book, err := loader.ReadMetadata(file)
+	if err != nil {
+		return domain.Book{}, err
+	}
+	if book.Metadata == nil {
+		book.Metadata = make(map[string]any)
+	}
+	book.Metadata[domain.MetadataFormat] = format.Name
+	return book, nil
+}
+
+// ReadCover reads the cover image of the book with the loader of its format, or returns ErrNoCover
+// for the formats without cover.
+func (r *Registry) ReadCover(file *domain.FileWithContent) (image.Image, error) {
+	_, loader, err := r.Detect(file)
+	if err != nil {
+		return nil, err
+	}
+
+	coverReader, ok := loader.(CoverReader)
+	if !ok {
+		return nil, ErrNoCover
+	}
+	return coverReader.ReadCover(file)
+}
+
+// accepts tells whether the MIME type, or one of its aliases, is one of the format,
+// or one of its fallback ones when the file has one of its extensions.
+func (f registeredFormat) accepts(mime *mimetype.MIME, ext string) bool {
+	for _, expected := range f.MimeTypes {
+		if mime.Is(expected) {
+			return true
+		}
+	}
+	if !f.hasExtension(ext) {
+		return false
+	}
+	for _, expected := range f.FallbackMimeTypes {
+		if mime.Is(expected) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f registeredFormat) hasExtension(ext string) bool {
+	for _, e := range f.Extensions {
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
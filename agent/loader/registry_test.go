@@ -0,0 +1,200 @@
+package loader
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+// namedLoader loads a single document holding its name.
+type namedLoader string
+
+func (l namedLoader) Load(book domain.Book, file *domain.FileWithContent) ([]*ai.Document, error) {
+	return []*ai.Document{ai.DocumentFromText(string(l), nil)}, nil
+}
+
+func (l namedLoader) ReadMetadata(file *domain.FileWithContent) (domain.Book, error) {
+	return domain.Book{Title: string(l), File: file.File}, nil
+}
+
+func newTestRegistry() *Registry {
+	return NewRegistry().
+		Register(Format{Name: "EPUB", MimeTypes: []string{"application/epub+zip"}, Extensions: []string{".epub"}}, namedLoader("epub")).
+		Register(Format{Name: "PDF", MimeTypes: []string{"application/pdf"}, Extensions: []string{".pdf"}}, namedLoader("pdf")).
+		Register(Format{Name: "Text", MimeTypes: []string{"text/plain"}, Extensions: []string{".txt"}}, namedLoader("txt")).
+		Register(Format{Name: "Markdown", MimeTypes: []string{"text/markdown", "text/plain"}, Extensions: []string{".md"}}, namedLoader("md"))
+}
+
+// buildTestEpub writes an EPUB archive holding the files, after its mimetype.
+func buildTestEpub(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	require.NoError(t, err)
+	_, err = f.Write([]byte("application/epub+zip"))
+	require.NoError(t, err)
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestRegistry_Detect(t *testing.T) {
+	pdfContent := buildTestPDF([]string{"Some text."}, nil, "", "")
+
+	testCases := []struct {
+		name     string
+		file     string
+		content  []byte
+		expected string
+	}{
+		{name: "should detect an epub", file: "book.epub", content: buildTestEpub(t, nil), expected: "EPUB"},
+		{name: "should detect a pdf", file: "book.pdf", content: pdfContent, expected: "PDF"},
+		{name: "should detect a pdf from its content despite its extension", file: "book.epub", content: pdfContent, expected: "PDF"},
+		{name: "should detect a pdf without extension", file: "book", content: pdfContent, expected: "PDF"},
+		{name: "should pick the format of the extension among the matching ones", file: "notes.md", content: []byte("# Notes\n\nSome text."), expected: "Markdown"},
+		{name: "should pick the first matching format otherwise", file: "notes", content: []byte("Some text."), expected: "Text"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			registry := newTestRegistry()
+			file := &domain.FileWithContent{File: domain.File{Name: tc.file}, Content: tc.content}
+
+			// When
+			format, _, err := registry.Detect(file)
+
+			// Then
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, format.Name)
+		})
+	}
+}
+
+func TestNewDefaultRegistry_ShouldDetectDocuments(t *testing.T) {
+	testCases := []struct {
+		name     string
+		file     string
+		content  string
+		expected string
+	}{
+		{name: "should detect a markdown file", file: "notes.md", content: "# Notes\n\nSome text.", expected: "Markdown"},
+		{name: "should detect a text file", file: "notes.txt", content: "Some text.", expected: "Text"},
+		{name: "should detect an html file", file: "notes.html", content: "<html><body><p>Some text.</p></body></html>", expected: "HTML"},
+		{name: "should detect a markdown file with the long extension", file: "notes.markdown", content: "# Notes", expected: "Markdown"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			registry := NewDefaultRegistry(nil)
+			file := &domain.FileWithContent{File: domain.File{Name: tc.file}, Content: []byte(tc.content)}
+
+			// When
+			format, _, err := registry.Detect(file)
+
+			// Then
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, format.Name)
+		})
+	}
+}
+
+func TestRegistry_Detect_ShouldRejectUnsupportedFormat(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "should reject an image", file: "cover.png", content: "\x89PNG\r\n\x1a\n"},
+		{name: "should reject a subtype of a supported format", file: "data.json", content: `{"title": "Some text."}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			registry := newTestRegistry()
+			file := &domain.FileWithContent{File: domain.File{Name: tc.file}, Content: []byte(tc.content)}
+
+			// When
+			_, _, err := registry.Detect(file)
+
+			// Then
+			assert.ErrorIs(t, err, ErrUnsupportedFormat)
+		})
+	}
+}
+
+func TestRegistry_ReadMetadata_ShouldRecordFormat(t *testing.T) {
+	// Given
+	registry := newTestRegistry()
+	file := &domain.FileWithContent{File: domain.File{Name: "book.pdf"}, Content: buildTestPDF([]string{"Some text."}, nil, "", "")}
+
+	// When
+	book, err := registry.ReadMetadata(file)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "pdf", book.Title)
+	assert.Equal(t, "PDF", book.Metadata["format"])
+}
+
+func TestRegistry_ReadCover_ShouldFailForFormatsWithoutCover(t *testing.T) {
+	// Given
+	registry := newTestRegistry()
+	file := &domain.FileWithContent{File: domain.File{Name: "notes.txt"}, Content: []byte("Some text.")}
+
+	// When
+	_, err := registry.ReadCover(file)
+
+	// Then
+	assert.ErrorIs(t, err, ErrNoCover)
+}
+
+func TestRegistry_Extensions(t *testing.T) {
+	// Given
+	registry := newTestRegistry()
+
+	// When
+	extensions := registry.Extensions()
+
+	// Then
+	assert.Equal(t, []string{".epub", ".pdf", ".txt", ".md"}, extensions)
+}
+
+func TestNewDefaultRegistry_ShouldRejectTextFilesOfOtherFormats(t *testing.T) {
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "should reject a source file", file: "main.go", content: "package main\n\nfunc main() {}\n"},
+		{name: "should reject a log file", file: "server.log", content: "2024-01-01 server started\n"},
+		{name: "should reject a text file without extension", file: "notes", content: "Some text."},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Given
+			registry := NewDefaultRegistry(nil)
+			file := &domain.FileWithContent{File: domain.File{Name: tc.file}, Content: []byte(tc.content)}
+
+			// When
+			_, _, err := registry.Detect(file)
+
+			// Then
+			assert.ErrorIs(t, err, ErrUnsupportedFormat)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package loader
+
+import (
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+// TextLoader loads plain text documents as a single chapter, named after the file.
+type TextLoader struct{}
+
+var _ BookLoader = (*TextLoader)(nil)
+
+func NewTextLoader() *TextLoader {
+	return &TextLoader{}
+}
+
+func (l *TextLoader) Load(book domain.Book, file *domain.FileWithContent) ([]*ai.Document, error) {
+	text := strings.TrimSpace(strings.ReplaceAll(string(file.Content), "\r\n", "\n"))
+	if text == "" {
+		return nil, nil
+	}
+	return chapterDocuments(book, []markdownChapter{{content: text}}), nil
+}
+
+func (l *TextLoader) ReadMetadata(file *domain.FileWithContent) (domain.Book, error) {
+	return domain.Book{
+		Title: titleFromFileName(file.Name),
+		File:  file.File,
+	}, nil
+}
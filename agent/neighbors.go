@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+// chunkContentMetadataKey holds the content of the retrieved chunk in an expanded document, to cite it.
+const chunkContentMetadataKey = "chunk_content"
+
+// chunkWindow is a retrieved chunk along with its neighbours, in reading order.
+type chunkWindow struct {
+	hit   *ai.Document
+	parts []*ai.Document
+	ids   map[string]bool
+}
+
+// expandNeighbors replaces each retrieved chunk by a single document made of the chunk and its radius
+// preceding and following chunks of the same chapter. The windows sharing chunks are merged,
+// keeping the rank and the metadata of the best ranked chunk, so that no passage is sent twice.
+func expandNeighbors(
+	ctx context.Context,
+	store domain.BookVectorStore,
+	docs []*ai.Document,
+	radius int,
+) ([]*ai.Document, error) {
+	if radius <= 0 || len(docs) == 0 {
+		return docs, nil
+	}
+
+	windows := make([]*chunkWindow, 0, len(docs))
+	for _, doc := range docs {
+		parts, err := store.GetNeighborParts(ctx, metadataToString(doc.Metadata["id"]), radius)
+		if err != nil {
+			if !errors.Is(err, domain.ErrBookPartNotFound) {
+				return nil, fmt.Errorf("failed to get the neighbors of chunk %v: %w", doc.Metadata["id"], err)
+			}
+			parts = []*ai.Document{doc}
+		}
+
+		w := &chunkWindow{hit: doc, ids: make(map[string]bool, len(parts))}
+		w.add(parts...)
+
+		// The window joins the best ranked window it overlaps, along with the other ones it overlaps
+		var target *chunkWindow
+		kept := windows[:0]
+		for _, other := range windows {
+			switch {
+			case !other.overlaps(w):
+				kept = append(kept, other)
+			case target == nil:
+				target = other
+				kept = append(kept, other)
+			default:
+				target.add(other.parts...)
+			}
+		}
+		windows = kept
+		if target != nil {
+			target.add(w.parts...)
+		} else {
+			windows = append(windows, w)
+		}
+	}
+
+	expanded := make([]*ai.Document, len(windows))
+	for i, w := range windows {
+		expanded[i] = w.document()
+	}
+	return expanded, nil
+}
+
+func (w *chunkWindow) add(parts ...*ai.Document) {
+	for _, part := range parts {
+		id := metadataToString(part.Metadata["id"])
+		if w.ids[id] {
+			continue
+		}
+		w.ids[id] = true
+		w.parts = append(w.parts, part)
+	}
+	sort.SliceStable(w.parts, func(i, j int) bool {
+		return partOrder(w.parts[i]).less(partOrder(w.parts[j]))
+	})
+}
+
+func (w *chunkWindow) overlaps(other *chunkWindow) bool {
+	for id := range other.ids {
+		if w.ids[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// document joins the parts of the window, with the metadata of the retrieved chunk,
+// its own content and the ids of all the joined chunks.
+func (w *chunkWindow) document() *ai.Document {
+	if len(w.parts) == 1 {
+		return w.hit
+	}
+
+	texts := make([]string, len(w.parts))
+	ids := make([]string, len(w.parts))
+	for i, part := range w.parts {
+		texts[i] = pkg.ContentToText(part.Content)
+		ids[i] = metadataToString(part.Metadata["id"])
+	}
+
+	metadata := make(map[string]any, len(w.hit.Metadata)+1)
+	for k, v := range w.hit.Metadata {
+		metadata[k] = v
+	}
+	metadata["part_ids"] = ids
+	metadata[chunkContentMetadataKey] = pkg.ContentToText(w.hit.Content)
+	return ai.DocumentFromText(strings.Join(texts, "\n\n"), metadata)
+}
+
+// partKey sorts the parts of a chapter in reading order: by position, then by id.
+type partKey struct {
+	position int
+	id       uint64
+}
+
+func (k partKey) less(other partKey) bool {
+	if k.position != other.position {
+		return k.position < other.position
+	}
+	return k.id < other.id
+}
+
+func partOrder(doc *ai.Document) partKey {
+	position, _ := doc.Metadata["position"].(int)
+	id, _ := strconv.ParseUint(metadataToString(doc.Metadata["id"]), 10, 64)
+	return partKey{position: position, id: id}
+}
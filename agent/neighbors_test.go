@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+// chapterVectorStore holds the parts of a single chapter, in reading order.
+type chapterVectorStore struct {
+	domain.BookVectorStore
+	parts []*ai.Document
+}
+
+func (s *chapterVectorStore) GetNeighborParts(ctx context.Context, partID string, radius int) ([]*ai.Document, error) {
+	for i, part := range s.parts {
+		if metadataToString(part.Metadata["id"]) == partID {
+			return s.parts[max(0, i-radius):min(len(s.parts), i+radius+1)], nil
+		}
+	}
+	return nil, domain.ErrBookPartNotFound
+}
+
+func newChapterVectorStore(n int) *chapterVectorStore {
+	s := &chapterVectorStore{}
+	for i := range n {
+		s.parts = append(s.parts, ai.DocumentFromText(fmt.Sprintf("part %d", i), map[string]any{
+			"id":       uint(100 + i),
+			"position": i,
+		}))
+	}
+	return s
+}
+
+func Test_expandNeighbors_ShouldMergeOverlappingWindows(t *testing.T) {
+	// Given
+	store := newChapterVectorStore(10)
+	docs := []*ai.Document{store.parts[5], store.parts[1], store.parts[3], store.parts[9]}
+
+	// When
+	res, err := expandNeighbors(context.Background(), store, docs, 1)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "part 0\n\npart 1\n\npart 2\n\npart 3\n\npart 4\n\npart 5\n\npart 6", res[0].Content[0].Text)
+	assert.Equal(t, uint(105), res[0].Metadata["id"], "the best ranked chunk should be cited")
+	assert.Equal(t, "part 5", res[0].Metadata[chunkContentMetadataKey])
+	assert.Equal(t, "part 8\n\npart 9", res[1].Content[0].Text)
+	assert.Equal(t, []string{"108", "109"}, res[1].Metadata["part_ids"])
+}
+
+func Test_expandNeighbors_ShouldKeepUnknownChunks(t *testing.T) {
+	// Given
+	store := newChapterVectorStore(3)
+	unknown := ai.DocumentFromText("orphan", map[string]any{"id": uint(1)})
+
+	// When
+	res, err := expandNeighbors(context.Background(), store, []*ai.Document{unknown}, 2)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []*ai.Document{unknown}, res)
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core/tracing"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/google/dotprompt/go/dotprompt"
+)
+
+const (
+	// DefaultPromptDir is the directory the .prompt files are loaded from when none is configured.
+	DefaultPromptDir = "prompts"
+
+	// promptVersionAttrPrefix prefixes the trace attributes holding the version of each rendered prompt.
+	promptVersionAttrPrefix = "promptVersion:"
+
+	chatbotSystemPromptName          = "chatbot_system"
+	chatbotUserPromptName            = "chatbot_user"
+	agentSystemPromptName            = "agent_system"
+	condenseQuestionSystemPromptName = "condense_question_system"
+	condenseQuestionUserPromptName   = "condense_question_user"
+	summarizeSystemPromptName        = "summarize_system"
+	summarizeUserPromptName          = "summarize_user"
+	evalJudgeSystemPromptName        = "eval_judge_system"
+	evalJudgeUserPromptName          = "eval_judge_user"
+	chunkContextSystemPromptName     = "chunk_context_system"
+	chunkContextUserPromptName       = "chunk_context_user"
+	rerankSystemPromptName           = "rerank_system"
+	rerankUserPromptName             = "rerank_user"
+)
+
+var promptNames = []string{
+	chatbotSystemPromptName,
+	chatbotUserPromptName,
+	agentSystemPromptName,
+	condenseQuestionSystemPromptName,
+	condenseQuestionUserPromptName,
+	summarizeSystemPromptName,
+	summarizeUserPromptName,
+	evalJudgeSystemPromptName,
+	evalJudgeUserPromptName,
+	chunkContextSystemPromptName,
+	chunkContextUserPromptName,
+	rerankSystemPromptName,
+	rerankUserPromptName,
+}
+
+// promptTemplate is a .prompt file loaded by genkit, along with the version declared in its front matter.
+type promptTemplate struct {
+	prompt  *ai.Prompt
+	version string
+}
+
+// promptSet holds the loaded prompts by name.
+type promptSet map[string]*promptTemplate
+
+// renderedPrompt holds the texts sent to the model and the version of the prompts they were rendered from.
+type renderedPrompt struct {
+	System   string            `json:"system"`
+	Prompt   string            `json:"prompt"`
+	Versions map[string]string `json:"versions"`
+}
+
+// loadPrompts looks up the prompts genkit loaded from the directory.
+func loadPrompts(g *genkit.Genkit, dir string) (promptSet, error) {
+	templates := make(promptSet, len(promptNames))
+	for _, name := range promptNames {
+		p := genkit.LookupPrompt(g, name)
+		if p == nil {
+			return nil, fmt.Errorf("prompt %s not found in directory %s", name, dir)
+		}
+
+		source, err := os.ReadFile(filepath.Join(dir, name+".prompt"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt %s: %w", name, err)
+		}
+		parsed, err := dotprompt.ParseDocument(string(source))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt %s: %w", name, err)
+		}
+
+		templates[name] = &promptTemplate{prompt: p, version: parsed.Version}
+	}
+	return templates, nil
+}
+
+// promptCall is a prompt to render along with its input variables.
+type promptCall struct {
+	name  string
+	input map[string]any
+}
+
+// renderPrompt renders the system prompt and, when its name is not empty, the user prompt.
+// The version of each prompt is recorded in the current trace span.
+func (a *Agent) renderPrompt(ctx context.Context, system, user promptCall) (renderedPrompt, error) {
+	return a.prompts.render(ctx, system, user)
+}
+
+func (s promptSet) render(ctx context.Context, system, user promptCall) (renderedPrompt, error) {
+	rendered := renderedPrompt{Versions: make(map[string]string, 2)}
+
+	text, err := s.renderTemplate(ctx, system.name, system.input, rendered.Versions)
+	if err != nil {
+		return renderedPrompt{}, err
+	}
+	rendered.System = text
+
+	if user.name != "" {
+		text, err := s.renderTemplate(ctx, user.name, user.input, rendered.Versions)
+		if err != nil {
+			return renderedPrompt{}, err
+		}
+		rendered.Prompt = text
+	}
+	return rendered, nil
+}
+
+func (s promptSet) renderTemplate(ctx context.Context, name string, input map[string]any, versions map[string]string) (string, error) {
+	tmpl, ok := s[name]
+	if !ok {
+		return "", fmt.Errorf("prompt %s is not loaded", name)
+	}
+	if input == nil {
+		input = map[string]any{}
+	}
+
+	opts, err := tmpl.prompt.Render(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", name, err)
+	}
+
+	var text strings.Builder
+	for _, msg := range opts.Messages {
+		text.WriteString(msg.Text())
+	}
+	versions[name] = tmpl.version
+	tracing.SetCustomMetadataAttr(ctx, promptVersionAttrPrefix+name, tmpl.version)
+	return strings.TrimSpace(text.String()), nil
+}
@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_renderPrompt_ShouldRenderTemplatesWithTheirVersion(t *testing.T) {
+	// Given
+	a := newFakeAgent(t, Config{})
+
+	// When
+	rendered, err := a.renderPrompt(context.Background(),
+		promptCall{name: chatbotSystemPromptName, input: map[string]any{"summary": "The user reads Les Misérables."}},
+		promptCall{name: chatbotUserPromptName, input: map[string]any{"question": "Who is <Javert>?"}},
+	)
+
+	// Then
+	require.NoError(t, err)
+	assert.Contains(t, rendered.System, "You are a helpful assistant.")
+	assert.True(t, strings.HasSuffix(rendered.System,
+		"Summary of the earlier conversation:\nThe user reads Les Misérables."))
+	assert.Equal(t, "# User's message:\nWho is <Javert>?", rendered.Prompt)
+	assert.Equal(t, map[string]string{
+		chatbotSystemPromptName: "2",
+		chatbotUserPromptName:   "1",
+	}, rendered.Versions)
+}
+
+func Test_renderPrompt_ShouldRenderRerankPrompts(t *testing.T) {
+	// Given
+	a := newFakeAgent(t, Config{})
+
+	// When
+	rendered, err := a.renderPrompt(context.Background(),
+		promptCall{name: rerankSystemPromptName},
+		promptCall{name: rerankUserPromptName, input: map[string]any{
+			"question": "Who is Javert?",
+			"passages": "## Passage 0\nJavert is an inspector.",
+		}},
+	)
+
+	// Then
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rendered.System, "You are a relevance grader."))
+	assert.Equal(t, "# Question:\nWho is Javert?\n\n# Passages:\n## Passage 0\nJavert is an inspector.", rendered.Prompt)
+	assert.Equal(t, map[string]string{
+		rerankSystemPromptName: "1",
+		rerankUserPromptName:   "1",
+	}, rendered.Versions)
+}
@@ -0,0 +1,262 @@
+// Package fake implements an offline genkit plugin with deterministic models,
+// so that the application and its tests can run without network nor API key.
+//
+// Any embedder name resolves to a hash based embedder and any model name to a model
+// answering from the fixtures file, or echoing the question and its context otherwise.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
+	"github.com/firebase/genkit/go/genkit"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ProviderName = "fake"
+
+	// DefaultDimension matches the size of the book parts embedding column.
+	DefaultDimension = 1024
+)
+
+// Fixture is a canned answer returned when the user's message contains Match, ignoring case.
+type Fixture struct {
+	Match  string `yaml:"match"`
+	Answer string `yaml:"answer"`
+}
+
+type fixturesFile struct {
+	Answers []Fixture `yaml:"answers"`
+}
+
+type Plugin struct {
+	name      string
+	dimension int
+	fixtures  []Fixture
+}
+
+var _ genkit.DynamicPlugin = (*Plugin)(nil)
+
+type Option func(p *Plugin)
+
+// WithName registers the plugin under another provider name.
+func WithName(name string) Option {
+	return func(p *Plugin) {
+		p.name = name
+	}
+}
+
+// WithDimension sets the size of the embedding vectors.
+func WithDimension(dimension int) Option {
+	return func(p *Plugin) {
+		if dimension > 0 {
+			p.dimension = dimension
+		}
+	}
+}
+
+// WithFixtures adds canned answers, the first matching one wins.
+func WithFixtures(fixtures ...Fixture) Option {
+	return func(p *Plugin) {
+		p.fixtures = append(p.fixtures, fixtures...)
+	}
+}
+
+func NewPlugin(opts ...Option) *Plugin {
+	p := &Plugin{
+		name:      ProviderName,
+		dimension: DefaultDimension,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// LoadFixtures reads the canned answers from a YAML file like:
+//
+//	answers:
+//	  - match: who wrote
+//	    answer: Victor Hugo wrote it.
+func LoadFixtures(path string) ([]Fixture, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures file %s: %w", path, err)
+	}
+
+	var f fixturesFile
+	if err := yaml.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures file %s: %w", path, err)
+	}
+	return f.Answers, nil
+}
+
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+func (p *Plugin) Init(ctx context.Context, g *genkit.Genkit) error {
+	return nil
+}
+
+func (p *Plugin) ListActions(ctx context.Context) []core.ActionDesc {
+	return nil
+}
+
+func (p *Plugin) ResolveAction(g *genkit.Genkit, atype core.ActionType, name string) error {
+	switch atype {
+	case core.ActionTypeModel:
+		genkit.DefineModel(g, p.name, name, &ai.ModelInfo{
+			Label: name,
+			Supports: &ai.ModelSupports{
+				Multiturn:   true,
+				SystemRole:  true,
+				Context:     true,
+				Constrained: ai.ConstrainedSupportAll,
+			},
+		}, p.generate)
+	case core.ActionTypeEmbedder:
+		genkit.DefineEmbedder(g, p.name, name, p.embed)
+	default:
+		return fmt.Errorf("action type %s is not supported by the %s plugin", atype, p.name)
+	}
+	return nil
+}
+
+func (p *Plugin) generate(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+	answer := p.answer(req)
+
+	if cb != nil {
+		for _, word := range strings.SplitAfter(answer, " ") {
+			if err := cb(ctx, &ai.ModelResponseChunk{
+				Role:    ai.RoleModel,
+				Content: []*ai.Part{ai.NewTextPart(word)},
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &ai.ModelResponse{
+		Request:      req,
+		Message:      ai.NewModelTextMessage(answer),
+		FinishReason: ai.FinishReasonStop,
+		Usage: &ai.GenerationUsage{
+			InputCharacters:  len(requestText(req)),
+			OutputCharacters: len(answer),
+		},
+	}, nil
+}
+
+// answer returns the first matching fixture, or an answer shaped like the requested output.
+func (p *Plugin) answer(req *ai.ModelRequest) string {
+	question := lastUserMessage(req.Messages)
+	lowered := strings.ToLower(question)
+	for _, f := range p.fixtures {
+		if strings.Contains(lowered, strings.ToLower(f.Match)) {
+			return f.Answer
+		}
+	}
+
+	if req.Output != nil && req.Output.Format == "json" {
+		return zeroJSON(req.Output.Schema)
+	}
+	return echo(question, req.Docs)
+}
+
+func (p *Plugin) embed(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+	resp := &ai.EmbedResponse{Embeddings: make([]*ai.Embedding, 0, len(req.Input))}
+	for _, doc := range req.Input {
+		resp.Embeddings = append(resp.Embeddings, &ai.Embedding{
+			Embedding: hashEmbedding(textOf(doc.Content), p.dimension),
+		})
+	}
+	return resp, nil
+}
+
+// hashEmbedding hashes each word of the text into a dimension of the vector, then normalizes it.
+// Texts sharing words get close vectors, and the same text always gets the same vector.
+func hashEmbedding(text string, dimension int) []float32 {
+	vector := make([]float32, dimension)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		words = []string{text}
+	}
+	for _, word := range words {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		sum := h.Sum64()
+		sign := float32(1)
+		if sum&(1<<63) != 0 {
+			sign = -1
+		}
+		vector[sum%uint64(dimension)] += sign
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v * v)
+	}
+	norm = math.Sqrt(norm)
+	if norm == 0 {
+		return vector
+	}
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+func echo(question string, docs []*ai.Document) string {
+	var sb strings.Builder
+	sb.WriteString(question)
+	for i, doc := range docs {
+		if i == 0 {
+			sb.WriteString("\n\nContext:")
+		}
+		sb.WriteString("\n- ")
+		sb.WriteString(textOf(doc.Content))
+	}
+	return sb.String()
+}
+
+func lastUserMessage(msgs []*ai.Message) string {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role == ai.RoleUser {
+			return strings.TrimSpace(textOf(msgs[i].Content))
+		}
+	}
+	return ""
+}
+
+func requestText(req *ai.ModelRequest) string {
+	var sb strings.Builder
+	for _, msg := range req.Messages {
+		sb.WriteString(textOf(msg.Content))
+	}
+	for _, doc := range req.Docs {
+		sb.WriteString(textOf(doc.Content))
+	}
+	return sb.String()
+}
+
+func textOf(parts []*ai.Part) string {
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.IsText() {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
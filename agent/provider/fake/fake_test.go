@@ -0,0 +1,143 @@
+package fake_test
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/agent/provider/fake"
+)
+
+func newTestGenkit(t *testing.T, opts ...fake.Option) *genkit.Genkit {
+	t.Helper()
+	g, err := genkit.Init(context.Background(), genkit.WithPlugins(fake.NewPlugin(opts...)))
+	require.NoError(t, err)
+	return g
+}
+
+func embed(t *testing.T, embedder ai.Embedder, texts ...string) [][]float32 {
+	t.Helper()
+	req := &ai.EmbedRequest{}
+	for _, text := range texts {
+		req.Input = append(req.Input, ai.DocumentFromText(text, nil))
+	}
+	resp, err := embedder.Embed(context.Background(), req)
+	require.NoError(t, err)
+
+	vectors := make([][]float32, 0, len(resp.Embeddings))
+	for _, e := range resp.Embeddings {
+		vectors = append(vectors, e.Embedding)
+	}
+	return vectors
+}
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i] * b[i])
+	}
+	return dot
+}
+
+func Test_Embed_ShouldBeDeterministicAndNormalized(t *testing.T) {
+	// Given
+	g := newTestGenkit(t, fake.WithDimension(64))
+	embedder := genkit.LookupEmbedder(g, fake.ProviderName, "embed")
+
+	// When
+	vectors := embed(t, embedder, "Gavroche sings on the barricade", "Gavroche sings on the barricade")
+
+	// Then
+	require.Len(t, vectors, 2)
+	assert.Len(t, vectors[0], 64)
+	assert.Equal(t, vectors[0], vectors[1])
+	assert.InDelta(t, 1.0, math.Sqrt(cosine(vectors[0], vectors[0])), 1e-6)
+}
+
+func Test_Embed_ShouldGetCloserVectorsForTextsSharingWords(t *testing.T) {
+	// Given
+	g := newTestGenkit(t)
+	embedder := genkit.LookupEmbedder(g, fake.ProviderName, "embed")
+
+	// When
+	vectors := embed(t, embedder,
+		"Jean Valjean steals the candlesticks",
+		"Valjean and the bishop candlesticks",
+		"A whale hunt in the Pacific ocean",
+	)
+
+	// Then
+	assert.Len(t, vectors[0], fake.DefaultDimension)
+	assert.Greater(t, cosine(vectors[0], vectors[1]), cosine(vectors[0], vectors[2]))
+}
+
+func Test_Generate_ShouldReturnMatchingFixture(t *testing.T) {
+	// Given
+	path := filepath.Join(t.TempDir(), "fixtures.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`answers:
+  - match: who wrote
+    answer: Victor Hugo wrote it.
+`), 0o644))
+	fixtures, err := fake.LoadFixtures(path)
+	require.NoError(t, err)
+	g := newTestGenkit(t, fake.WithFixtures(fixtures...))
+
+	// When
+	resp, err := genkit.Generate(context.Background(), g,
+		ai.WithModelName("fake/completion"),
+		ai.WithPrompt("Who WROTE Les Misérables?"),
+	)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Victor Hugo wrote it.", resp.Text())
+}
+
+func Test_Generate_ShouldEchoQuestionAndContextWhenStreaming(t *testing.T) {
+	// Given
+	g := newTestGenkit(t)
+	var streamed string
+
+	// When
+	resp, err := genkit.Generate(context.Background(), g,
+		ai.WithModelName("fake/completion"),
+		ai.WithSystem("Be nice"),
+		ai.WithPrompt("Where is Cosette?"),
+		ai.WithDocs(ai.DocumentFromText("Cosette lives in Montfermeil.", nil)),
+		ai.WithStreaming(func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+			streamed += chunk.Text()
+			return nil
+		}),
+	)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Where is Cosette?\n\nContext:\n- Cosette lives in Montfermeil.", resp.Text())
+	assert.Equal(t, resp.Text(), streamed)
+}
+
+func Test_GenerateData_ShouldReturnZeroValueOfSchema(t *testing.T) {
+	// Given
+	g := newTestGenkit(t)
+	type answer struct {
+		Scores []float64 `json:"scores"`
+		Reason string    `json:"reason"`
+	}
+
+	// When
+	res, _, err := genkit.GenerateData[answer](context.Background(), g,
+		ai.WithModelName("fake/completion"),
+		ai.WithPrompt("Score those passages"),
+	)
+
+	// Then
+	require.NoError(t, err)
+	assert.Empty(t, res.Scores)
+	assert.Empty(t, res.Reason)
+}
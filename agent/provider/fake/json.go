@@ -0,0 +1,57 @@
+package fake
+
+import "encoding/json"
+
+// zeroJSON returns a JSON document matching the schema, filled with zero values.
+func zeroJSON(schema map[string]any) string {
+	b, err := json.Marshal(zeroValue(schema))
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+func zeroValue(schema map[string]any) any {
+	if schema == nil {
+		return map[string]any{}
+	}
+
+	switch schemaType(schema) {
+	case "object":
+		obj := make(map[string]any)
+		props, _ := schema["properties"].(map[string]any)
+		for name, prop := range props {
+			propSchema, _ := prop.(map[string]any)
+			obj[name] = zeroValue(propSchema)
+		}
+		return obj
+	case "array":
+		return []any{}
+	case "string":
+		return ""
+	case "number", "integer":
+		return 0
+	case "boolean":
+		return false
+	default:
+		return nil
+	}
+}
+
+// schemaType returns the first non null type of the schema.
+func schemaType(schema map[string]any) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []any:
+		for _, v := range t {
+			if s, ok := v.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	return ""
+}
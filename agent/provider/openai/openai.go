@@ -0,0 +1,220 @@
+// Package openai implements a genkit plugin for the servers exposing the OpenAI chat completions
+// and embeddings API: OpenAI itself, Ollama, vLLM, LM Studio...
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const (
+	defaultClientTimeout = 60 * time.Second
+
+	chatCompletionsPath = "/chat/completions"
+	embeddingsPath      = "/embeddings"
+)
+
+// Plugin resolves any model or embedder name against an OpenAI compatible server.
+// Models are referenced as "<plugin name>/<model name>", e.g. "ollama/llama3.1".
+type Plugin struct {
+	name    string
+	baseURL string
+	apiKey  string
+	client  *http.Client
+	limiter *rateLimiter
+}
+
+var _ genkit.DynamicPlugin = (*Plugin)(nil)
+
+type Option func(p *Plugin)
+
+// WithAPIKey sets the bearer token sent with each request. Ollama does not need one.
+func WithAPIKey(apiKey string) Option {
+	return func(p *Plugin) {
+		p.apiKey = apiKey
+	}
+}
+
+// WithClientTimeout sets the timeout of the HTTP client.
+func WithClientTimeout(timeout time.Duration) Option {
+	return func(p *Plugin) {
+		if timeout > 0 {
+			p.client.Timeout = timeout
+		}
+	}
+}
+
+// WithHTTPClient replaces the HTTP client used to call the server.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Plugin) {
+		p.client = client
+	}
+}
+
+// WithMaxRequestsPerSecond spaces out the requests sent to the server, whatever the model. 0 doesn't limit them.
+func WithMaxRequestsPerSecond(perSecond int) Option {
+	return func(p *Plugin) {
+		p.limiter = newRateLimiter(perSecond)
+	}
+}
+
+// NewPlugin creates a plugin registered under the given name and calling the API at baseURL,
+// e.g. "http://localhost:11434/v1" for Ollama.
+func NewPlugin(name, baseURL string, opts ...Option) *Plugin {
+	p := &Plugin{
+		name:    name,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: defaultClientTimeout},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+func (p *Plugin) Init(ctx context.Context, g *genkit.Genkit) error {
+	return nil
+}
+
+// ListActions returns nothing: the models available depend on the server.
+func (p *Plugin) ListActions(ctx context.Context) []core.ActionDesc {
+	return nil
+}
+
+// ResolveAction defines the model or the embedder the first time it is looked up.
+func (p *Plugin) ResolveAction(g *genkit.Genkit, atype core.ActionType, name string) error {
+	switch atype {
+	case core.ActionTypeModel:
+		genkit.DefineModel(g, p.name, name, &ai.ModelInfo{
+			Label: name,
+			Supports: &ai.ModelSupports{
+				Multiturn:  true,
+				SystemRole: true,
+				Tools:      true,
+				ToolChoice: true,
+			},
+		}, p.generate(name))
+	case core.ActionTypeEmbedder:
+		genkit.DefineEmbedder(g, p.name, name, p.embed(name))
+	default:
+		return fmt.Errorf("action type %s is not supported by the %s plugin", atype, p.name)
+	}
+	return nil
+}
+
+func (p *Plugin) generate(model string) ai.ModelFunc {
+	return func(ctx context.Context, req *ai.ModelRequest, cb ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		body, err := newChatRequest(model, req)
+		if err != nil {
+			return nil, err
+		}
+
+		// Tool calls arrive split across many chunks when streamed, so the tool turns are not streamed.
+		if cb == nil || len(req.Tools) > 0 {
+			var resp chatResponse
+			if err := p.post(ctx, chatCompletionsPath, body, &resp); err != nil {
+				return nil, err
+			}
+			modelResp, err := resp.toModelResponse(req)
+			if err != nil {
+				return nil, err
+			}
+			if cb != nil && modelResp.Text() != "" {
+				if err := cb(ctx, &ai.ModelResponseChunk{
+					Role:    ai.RoleModel,
+					Content: []*ai.Part{ai.NewTextPart(modelResp.Text())},
+				}); err != nil {
+					return nil, err
+				}
+			}
+			return modelResp, nil
+		}
+
+		body.Stream = true
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+		return p.stream(ctx, body, req, cb)
+	}
+}
+
+func (p *Plugin) embed(model string) func(context.Context, *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+	return func(ctx context.Context, req *ai.EmbedRequest) (*ai.EmbedResponse, error) {
+		body := embeddingRequest{Model: model, Input: make([]string, 0, len(req.Input))}
+		for _, doc := range req.Input {
+			body.Input = append(body.Input, documentText(doc))
+		}
+
+		var resp embeddingResponse
+		if err := p.post(ctx, embeddingsPath, body, &resp); err != nil {
+			return nil, err
+		}
+		if len(resp.Data) != len(req.Input) {
+			return nil, fmt.Errorf("%s returned %d embeddings for %d inputs", p.name, len(resp.Data), len(req.Input))
+		}
+
+		embeddings := make([]*ai.Embedding, len(resp.Data))
+		for _, d := range resp.Data {
+			if d.Index < 0 || d.Index >= len(embeddings) {
+				return nil, fmt.Errorf("%s returned an embedding with an unexpected index %d", p.name, d.Index)
+			}
+			embeddings[d.Index] = &ai.Embedding{Embedding: d.Embedding}
+		}
+		return &ai.EmbedResponse{Embeddings: embeddings}, nil
+	}
+}
+
+func (p *Plugin) post(ctx context.Context, path string, body any, out any) error {
+	resp, err := p.do(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", p.name, err)
+	}
+	return nil
+}
+
+func (p *Plugin) do(ctx context.Context, path string, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s request: %w", p.name, err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", p.name, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	if err := p.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", p.name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s responded with status %d: %s", p.name, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,226 @@
+package openai_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/agent/provider/openai"
+)
+
+type chatRequest struct {
+	Model    string `json:"model"`
+	Stream   bool   `json:"stream"`
+	Messages []struct {
+		Role       string `json:"role"`
+		Content    string `json:"content"`
+		ToolCallID string `json:"tool_call_id"`
+	} `json:"messages"`
+	Tools []struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	} `json:"tools"`
+}
+
+func newTestGenkit(t *testing.T, handler http.HandlerFunc, opts ...openai.Option) *genkit.Genkit {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	opts = append([]openai.Option{openai.WithAPIKey("secret")}, opts...)
+	g, err := genkit.Init(context.Background(),
+		genkit.WithPlugins(openai.NewPlugin("local", server.URL+"/v1", opts...)))
+	require.NoError(t, err)
+	return g
+}
+
+func decodeChatRequest(t *testing.T, r *http.Request) chatRequest {
+	t.Helper()
+	var req chatRequest
+	require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+	return req
+}
+
+func Test_Generate_ShouldCallChatCompletions(t *testing.T) {
+	// Given
+	var received chatRequest
+	g := newTestGenkit(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		received = decodeChatRequest(t, r)
+		fmt.Fprint(w, `{
+			"choices": [{"message": {"role": "assistant", "content": "Hello there"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 2, "total_tokens": 14}
+		}`)
+	})
+
+	// When
+	resp, err := genkit.Generate(context.Background(), g,
+		ai.WithModelName("local/llama3.1"),
+		ai.WithSystem("Be nice"),
+		ai.WithPrompt("Hello"),
+	)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Hello there", resp.Text())
+	assert.Equal(t, ai.FinishReasonStop, resp.FinishReason)
+	assert.Equal(t, 14, resp.Usage.TotalTokens)
+	assert.Equal(t, "llama3.1", received.Model)
+	assert.False(t, received.Stream)
+	require.Len(t, received.Messages, 2)
+	assert.Equal(t, "system", received.Messages[0].Role)
+	assert.Equal(t, "Be nice", received.Messages[0].Content)
+	assert.Equal(t, "user", received.Messages[1].Role)
+	assert.Equal(t, "Hello", received.Messages[1].Content)
+}
+
+func Test_Generate_ShouldStreamChunks(t *testing.T) {
+	// Given
+	g := newTestGenkit(t, func(w http.ResponseWriter, r *http.Request) {
+		req := decodeChatRequest(t, r)
+		assert.True(t, req.Stream)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{"Hel", "lo ", "there"} {
+			fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: {\"choices\": [{\"delta\": {}, \"finish_reason\": \"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	var chunks []string
+
+	// When
+	resp, err := genkit.Generate(context.Background(), g,
+		ai.WithModelName("local/llama3.1"),
+		ai.WithPrompt("Hello"),
+		ai.WithStreaming(func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+			chunks = append(chunks, chunk.Text())
+			return nil
+		}),
+	)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Hel", "lo ", "there"}, chunks)
+	assert.Equal(t, "Hello there", resp.Text())
+	assert.Equal(t, ai.FinishReasonStop, resp.FinishReason)
+}
+
+func Test_Generate_ShouldRunRequestedTools(t *testing.T) {
+	// Given
+	var calls []chatRequest
+	g := newTestGenkit(t, func(w http.ResponseWriter, r *http.Request) {
+		req := decodeChatRequest(t, r)
+		calls = append(calls, req)
+		if len(calls) == 1 {
+			fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "count_books", "arguments": "{\"author\": \"Hugo\"}"}}
+			]}, "finish_reason": "tool_calls"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "You have 3 books by Hugo"}, "finish_reason": "stop"}]}`)
+	})
+	type countBooksInput struct {
+		Author string `json:"author"`
+	}
+	tool := genkit.DefineTool(g, "count_books", "Count the books of an author",
+		func(ctx *ai.ToolContext, in countBooksInput) (int, error) {
+			assert.Equal(t, "Hugo", in.Author)
+			return 3, nil
+		})
+
+	// When
+	resp, err := genkit.Generate(context.Background(), g,
+		ai.WithModelName("local/llama3.1"),
+		ai.WithPrompt("How many books by Hugo?"),
+		ai.WithTools(tool),
+	)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "You have 3 books by Hugo", resp.Text())
+	require.Len(t, calls, 2)
+	require.Len(t, calls[0].Tools, 1)
+	assert.Equal(t, "count_books", calls[0].Tools[0].Function.Name)
+	last := calls[1].Messages[len(calls[1].Messages)-1]
+	assert.Equal(t, "tool", last.Role)
+	assert.Equal(t, "call_1", last.ToolCallID)
+	assert.Equal(t, "3", last.Content)
+}
+
+func Test_Embed_ShouldCallEmbeddings(t *testing.T) {
+	// Given
+	g := newTestGenkit(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "nomic-embed-text", req.Model)
+		assert.Equal(t, []string{"first", "second"}, req.Input)
+		fmt.Fprint(w, `{"data": [
+			{"index": 1, "embedding": [0.3, 0.4]},
+			{"index": 0, "embedding": [0.1, 0.2]}
+		]}`)
+	})
+	embedder := genkit.LookupEmbedder(g, "local", "nomic-embed-text")
+	require.NotNil(t, embedder)
+
+	// When
+	resp, err := embedder.Embed(context.Background(), &ai.EmbedRequest{
+		Input: []*ai.Document{ai.DocumentFromText("first", nil), ai.DocumentFromText("second", nil)},
+	})
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, resp.Embeddings, 2)
+	assert.Equal(t, []float32{0.1, 0.2}, resp.Embeddings[0].Embedding)
+	assert.Equal(t, []float32{0.3, 0.4}, resp.Embeddings[1].Embedding)
+}
+
+func Test_Embed_ShouldSpaceOutRequests(t *testing.T) {
+	// Given
+	g := newTestGenkit(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": [{"index": 0, "embedding": [0.1, 0.2]}]}`)
+	}, openai.WithMaxRequestsPerSecond(20))
+	embedder := genkit.LookupEmbedder(g, "local", "nomic-embed-text")
+	require.NotNil(t, embedder)
+	start := time.Now()
+
+	// When
+	for range 3 {
+		_, err := embedder.Embed(context.Background(), &ai.EmbedRequest{
+			Input: []*ai.Document{ai.DocumentFromText("first", nil)},
+		})
+		require.NoError(t, err)
+	}
+
+	// Then
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func Test_Generate_ShouldFailOnErrorStatus(t *testing.T) {
+	// Given
+	g := newTestGenkit(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": "model not found"}`, http.StatusNotFound)
+	})
+
+	// When
+	_, err := genkit.Generate(context.Background(), g,
+		ai.WithModelName("local/unknown"),
+		ai.WithPrompt("Hello"),
+	)
+
+	// Then
+	assert.ErrorContains(t, err, "status 404")
+}
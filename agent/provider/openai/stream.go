@@ -0,0 +1,85 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+const (
+	sseDataPrefix = "data:"
+	sseDone       = "[DONE]"
+)
+
+// stream reads the server-sent events of a streamed chat completion,
+// forwarding each content delta to cb and returning the whole answer.
+func (p *Plugin) stream(
+	ctx context.Context,
+	body *chatRequest,
+	req *ai.ModelRequest,
+	cb ai.ModelStreamCallback,
+) (*ai.ModelResponse, error) {
+	resp, err := p.do(ctx, chatCompletionsPath, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var (
+		answer       strings.Builder
+		finishReason string
+		u            *usage
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, sseDataPrefix) {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, sseDataPrefix))
+		if data == sseDone {
+			break
+		}
+
+		var chunk chatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode %s stream chunk: %w", p.name, err)
+		}
+		if chunk.Usage != nil {
+			u = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+		if choice.Delta.Content == "" {
+			continue
+		}
+		answer.WriteString(choice.Delta.Content)
+		if err := cb(ctx, &ai.ModelResponseChunk{
+			Role:    ai.RoleModel,
+			Content: []*ai.Part{ai.NewTextPart(choice.Delta.Content)},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s stream: %w", p.name, err)
+	}
+
+	return &ai.ModelResponse{
+		Request:      req,
+		Message:      ai.NewModelTextMessage(answer.String()),
+		FinishReason: toFinishReason(finishReason),
+		Usage:        u.toGenerationUsage(),
+	}, nil
+}
@@ -0,0 +1,268 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Tools          []chatTool      `json:"tools,omitempty"`
+	ToolChoice     string          `json:"tool_choice,omitempty"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	TopP           *float64        `json:"top_p,omitempty"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	Stop           []string        `json:"stop,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+}
+
+type chatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+type toolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+type toolCall struct {
+	Index    int              `json:"index,omitempty"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function toolCallFunction `json:"function"`
+}
+
+type toolCallFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatResponse struct {
+	Choices []chatChoice `json:"choices"`
+	Usage   *usage       `json:"usage,omitempty"`
+}
+
+type chatChoice struct {
+	Message      chatMessage `json:"message"`
+	Delta        chatMessage `json:"delta"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func newChatRequest(model string, req *ai.ModelRequest) (*chatRequest, error) {
+	body := &chatRequest{Model: model}
+
+	for _, msg := range req.Messages {
+		msgs, err := toChatMessages(msg)
+		if err != nil {
+			return nil, err
+		}
+		body.Messages = append(body.Messages, msgs...)
+	}
+
+	for _, tool := range req.Tools {
+		body.Tools = append(body.Tools, chatTool{
+			Type: "function",
+			Function: toolFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if len(body.Tools) > 0 {
+		body.ToolChoice = string(req.ToolChoice)
+	}
+
+	switch cfg := req.Config.(type) {
+	case *ai.GenerationCommonConfig:
+		applyCommonConfig(body, cfg)
+	case ai.GenerationCommonConfig:
+		applyCommonConfig(body, &cfg)
+	}
+
+	if req.Output != nil && req.Output.Format == "json" {
+		body.ResponseFormat = &responseFormat{Type: "json_object"}
+	}
+
+	return body, nil
+}
+
+func applyCommonConfig(body *chatRequest, cfg *ai.GenerationCommonConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.Temperature != 0 {
+		body.Temperature = &cfg.Temperature
+	}
+	if cfg.TopP != 0 {
+		body.TopP = &cfg.TopP
+	}
+	body.MaxTokens = cfg.MaxOutputTokens
+	body.Stop = cfg.StopSequences
+}
+
+// toChatMessages converts a genkit message. A tool message becomes one message per tool response.
+func toChatMessages(msg *ai.Message) ([]chatMessage, error) {
+	switch msg.Role {
+	case ai.RoleSystem:
+		return []chatMessage{{Role: "system", Content: partsText(msg.Content)}}, nil
+	case ai.RoleUser:
+		return []chatMessage{{Role: "user", Content: partsText(msg.Content)}}, nil
+	case ai.RoleModel:
+		out := chatMessage{Role: "assistant", Content: partsText(msg.Content)}
+		for _, part := range msg.Content {
+			if !part.IsToolRequest() {
+				continue
+			}
+			args, err := json.Marshal(part.ToolRequest.Input)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s tool arguments: %w", part.ToolRequest.Name, err)
+			}
+			out.ToolCalls = append(out.ToolCalls, toolCall{
+				ID:       toolCallID(part.ToolRequest.Ref, part.ToolRequest.Name),
+				Type:     "function",
+				Function: toolCallFunction{Name: part.ToolRequest.Name, Arguments: string(args)},
+			})
+		}
+		return []chatMessage{out}, nil
+	case ai.RoleTool:
+		var out []chatMessage
+		for _, part := range msg.Content {
+			if !part.IsToolResponse() {
+				continue
+			}
+			content, err := json.Marshal(part.ToolResponse.Output)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode %s tool output: %w", part.ToolResponse.Name, err)
+			}
+			out = append(out, chatMessage{
+				Role:       "tool",
+				Content:    string(content),
+				ToolCallID: toolCallID(part.ToolResponse.Ref, part.ToolResponse.Name),
+			})
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported message role: %s", msg.Role)
+	}
+}
+
+func (r *chatResponse) toModelResponse(req *ai.ModelRequest) (*ai.ModelResponse, error) {
+	if len(r.Choices) == 0 {
+		return nil, fmt.Errorf("no choice in the chat completion response")
+	}
+	choice := r.Choices[0]
+
+	var parts []*ai.Part
+	if choice.Message.Content != "" {
+		parts = append(parts, ai.NewTextPart(choice.Message.Content))
+	}
+	for _, call := range choice.Message.ToolCalls {
+		var input any
+		if call.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &input); err != nil {
+				return nil, fmt.Errorf("invalid arguments for the %s tool call: %w", call.Function.Name, err)
+			}
+		}
+		parts = append(parts, ai.NewToolRequestPart(&ai.ToolRequest{
+			Name:  call.Function.Name,
+			Ref:   call.ID,
+			Input: input,
+		}))
+	}
+
+	return &ai.ModelResponse{
+		Request:      req,
+		Message:      ai.NewModelMessage(parts...),
+		FinishReason: toFinishReason(choice.FinishReason),
+		Usage:        r.Usage.toGenerationUsage(),
+	}, nil
+}
+
+func (u *usage) toGenerationUsage() *ai.GenerationUsage {
+	if u == nil {
+		return nil
+	}
+	return &ai.GenerationUsage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+		TotalTokens:  u.TotalTokens,
+	}
+}
+
+func toFinishReason(reason string) ai.FinishReason {
+	switch reason {
+	case "stop", "tool_calls":
+		return ai.FinishReasonStop
+	case "length":
+		return ai.FinishReasonLength
+	case "content_filter":
+		return ai.FinishReasonBlocked
+	case "":
+		return ai.FinishReasonUnknown
+	default:
+		return ai.FinishReasonOther
+	}
+}
+
+func toolCallID(ref, name string) string {
+	if ref != "" {
+		return ref
+	}
+	return name
+}
+
+func partsText(parts []*ai.Part) string {
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.IsText() {
+			sb.WriteString(part.Text)
+		}
+	}
+	return sb.String()
+}
+
+func documentText(doc *ai.Document) string {
+	return partsText(doc.Content)
+}
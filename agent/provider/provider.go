@@ -0,0 +1,136 @@
+// Package provider builds the genkit plugins serving the completion and embedding models from the configuration.
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/thomas-marquis/genkit-mistral/mistral"
+	"github.com/thomas-marquis/goLLMan/agent/provider/fake"
+	"github.com/thomas-marquis/goLLMan/agent/provider/openai"
+)
+
+const (
+	// TypeMistral is the Mistral AI API. Its provider must be named "mistral".
+	TypeMistral = "mistral"
+	// TypeOpenAI is any server exposing the OpenAI API: OpenAI, Ollama, vLLM...
+	TypeOpenAI = "openai"
+	// TypeFake is the offline deterministic provider, for development and tests.
+	TypeFake = "fake"
+)
+
+// Config describes a model provider.
+// Its name prefixes the references of the models it serves, e.g. "ollama/llama3.1".
+type Config struct {
+	Name string
+	// Type is the kind of API, defaults to the name.
+	Type    string
+	BaseURL string
+	APIKey  string
+	Timeout time.Duration
+	// MaxRequestsPerSecond spaces out every request sent to the provider, 0 doesn't limit them.
+	MaxRequestsPerSecond int
+	Verbose              bool
+
+	// Dimension is the size of the vectors of the fake embedders.
+	Dimension int
+	// FixturesPath is the YAML file of the fake models canned answers.
+	FixturesPath string
+}
+
+// Factory creates the genkit plugin of a provider.
+type Factory func(cfg Config) (genkit.Plugin, error)
+
+var factories = map[string]Factory{
+	TypeMistral: newMistralPlugin,
+	TypeOpenAI:  newOpenAIPlugin,
+	TypeFake:    newFakePlugin,
+}
+
+// Register makes a provider type available to the configuration.
+func Register(providerType string, factory Factory) {
+	factories[providerType] = factory
+}
+
+// Types returns the registered provider types.
+func Types() []string {
+	types := make([]string, 0, len(factories))
+	for t := range factories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewPlugins creates one plugin per configured provider.
+func NewPlugins(cfgs []Config) ([]genkit.Plugin, error) {
+	plugins := make([]genkit.Plugin, 0, len(cfgs))
+	names := make(map[string]bool, len(cfgs))
+	for _, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("a provider has no name")
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("provider %s is configured twice", cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		if cfg.Type == "" {
+			cfg.Type = cfg.Name
+		}
+		factory, ok := factories[cfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown type %s for provider %s, expected one of %v", cfg.Type, cfg.Name, Types())
+		}
+
+		plugin, err := factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create provider %s: %w", cfg.Name, err)
+		}
+		if plugin.Name() != cfg.Name {
+			return nil, fmt.Errorf("provider %s must be named %s", cfg.Name, plugin.Name())
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+func newMistralPlugin(cfg Config) (genkit.Plugin, error) {
+	opts := []mistral.Option{
+		mistral.WithVerbose(cfg.Verbose),
+		mistral.WithClientTimeout(cfg.Timeout),
+	}
+	if rateLimit := cfg.MaxRequestsPerSecond; rateLimit > 0 {
+		opts = append(opts,
+			mistral.WithRateLimiter(mistral.NewBucketCallsRateLimiter(rateLimit, rateLimit, time.Second)))
+	}
+	return mistral.NewPlugin(cfg.APIKey, opts...), nil
+}
+
+func newOpenAIPlugin(cfg Config) (genkit.Plugin, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("the base URL is required")
+	}
+	return openai.NewPlugin(cfg.Name, cfg.BaseURL,
+		openai.WithAPIKey(cfg.APIKey),
+		openai.WithClientTimeout(cfg.Timeout),
+		openai.WithMaxRequestsPerSecond(cfg.MaxRequestsPerSecond),
+	), nil
+}
+
+func newFakePlugin(cfg Config) (genkit.Plugin, error) {
+	opts := []fake.Option{
+		fake.WithName(cfg.Name),
+		fake.WithDimension(cfg.Dimension),
+	}
+	if cfg.FixturesPath != "" {
+		fixtures, err := fake.LoadFixtures(cfg.FixturesPath)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, fake.WithFixtures(fixtures...))
+	}
+	return fake.NewPlugin(opts...), nil
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+)
+
+const (
+	// searchQueryMetadataKey is the assistant message metadata key holding the query used for the retrieval.
+	searchQueryMetadataKey = "search_query"
+)
+
+// SearchQueryFromMessage returns the search query the assistant message was generated from, if any.
+func SearchQueryFromMessage(msg *ai.Message) string {
+	query, _ := msg.Metadata[searchQueryMetadataKey].(string)
+	return query
+}
+
+// rewriteQuery condenses the question and the last session messages into a standalone search query.
+// The question is returned as is when rewriting is disabled or when there is no history yet.
+func (a *Agent) rewriteQuery(ctx context.Context, question string, history []*ai.Message) (string, error) {
+	limit := a.cfg.QueryRewriteHistory
+	if limit <= 0 {
+		return question, nil
+	}
+
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	conversation := formatConversation(history)
+	if conversation == "" {
+		return question, nil
+	}
+
+	prompt, err := a.renderPrompt(ctx,
+		promptCall{name: condenseQuestionSystemPromptName},
+		promptCall{name: condenseQuestionUserPromptName, input: map[string]any{
+			"conversation": conversation,
+			"question":     question,
+		}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	query, err := genkit.GenerateText(ctx, a.g,
+		ai.WithSystem(prompt.System),
+		ai.WithPrompt(prompt.Prompt),
+		ai.WithModelName(a.cfg.CompletionModel),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return question, nil
+	}
+	return query, nil
+}
+
+// formatConversation writes the messages one per line, prefixed by their role. System messages are skipped.
+func formatConversation(msgs []*ai.Message) string {
+	var conversation strings.Builder
+	for _, msg := range msgs {
+		if msg.Role == ai.RoleSystem {
+			continue
+		}
+		fmt.Fprintf(&conversation, "%s: %s\n", msg.Role, msg.Text())
+	}
+	return conversation.String()
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/agent/provider/fake"
+)
+
+func newFakeAgent(t *testing.T, cfg Config, fixtures ...fake.Fixture) *Agent {
+	t.Helper()
+	promptDir := filepath.Join("..", DefaultPromptDir)
+	g, err := genkit.Init(context.Background(),
+		genkit.WithPlugins(fake.NewPlugin(fake.WithFixtures(fixtures...))),
+		genkit.WithPromptDir(promptDir),
+	)
+	require.NoError(t, err)
+	prompts, err := loadPrompts(g, promptDir)
+	require.NoError(t, err)
+
+	cfg.CompletionModel = "fake/completion"
+	cfg.EmbeddingModel = "fake/embed"
+	return &Agent{g: g, cfg: cfg, prompts: prompts}
+}
+
+func Test_rewriteQuery_ShouldCondenseFollowUpQuestion(t *testing.T) {
+	// Given
+	a := newFakeAgent(t, Config{QueryRewriteHistory: 2},
+		fake.Fixture{Match: "what about his daughter", Answer: " Cosette, the daughter of Fantine \n"})
+	history := []*ai.Message{
+		ai.NewUserTextMessage("Who is Fantine?"),
+		ai.NewModelTextMessage("A young woman in Les Misérables."),
+	}
+
+	// When
+	query, err := a.rewriteQuery(context.Background(), "What about his daughter?", history)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Cosette, the daughter of Fantine", query)
+}
+
+func Test_rewriteQuery_ShouldKeepQuestionWithoutHistory(t *testing.T) {
+	// Given
+	a := newFakeAgent(t, Config{QueryRewriteHistory: 2},
+		fake.Fixture{Match: "fantine", Answer: "rewritten"})
+
+	// When
+	query, err := a.rewriteQuery(context.Background(), "Who is Fantine?", nil)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "Who is Fantine?", query)
+}
+
+func Test_rewriteQuery_ShouldKeepQuestionWhenDisabled(t *testing.T) {
+	// Given
+	a := newFakeAgent(t, Config{QueryRewriteHistory: 0},
+		fake.Fixture{Match: "daughter", Answer: "rewritten"})
+	history := []*ai.Message{ai.NewUserTextMessage("Who is Fantine?")}
+
+	// When
+	query, err := a.rewriteQuery(context.Background(), "What about his daughter?", history)
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, "What about his daughter?", query)
+}
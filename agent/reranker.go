@@ -0,0 +1,130 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+const (
+	// defaultRerankCandidatesFactor is the number of candidates fetched per kept document when no candidates count is configured.
+	defaultRerankCandidatesFactor = 3
+)
+
+// Reranker scores retrieved documents against the question.
+type Reranker interface {
+	// Rerank returns one relevance score per document, in the same order as the documents.
+	// The higher the score, the more relevant the document.
+	Rerank(ctx context.Context, query string, docs []*ai.Document) ([]float64, error)
+}
+
+// LLMReranker asks a completion model to grade each document, with the rerank prompts.
+type LLMReranker struct {
+	g       *genkit.Genkit
+	model   string
+	prompts promptSet
+}
+
+var _ Reranker = (*LLMReranker)(nil)
+
+func newLLMReranker(g *genkit.Genkit, model string, prompts promptSet) *LLMReranker {
+	return &LLMReranker{
+		g:       g,
+		model:   model,
+		prompts: prompts,
+	}
+}
+
+type passageScore struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+type passageScores struct {
+	Scores []passageScore `json:"scores"`
+}
+
+func (r *LLMReranker) Rerank(ctx context.Context, query string, docs []*ai.Document) ([]float64, error) {
+	var passages strings.Builder
+	for i, doc := range docs {
+		fmt.Fprintf(&passages, "## Passage %d\n%s\n\n", i, pkg.ContentToText(doc.Content))
+	}
+
+	prompt, err := r.prompts.render(ctx,
+		promptCall{name: rerankSystemPromptName},
+		promptCall{name: rerankUserPromptName, input: map[string]any{
+			"question": query,
+			"passages": strings.TrimSpace(passages.String()),
+		}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	out, _, err := genkit.GenerateData[passageScores](ctx, r.g,
+		ai.WithSystem(prompt.System),
+		ai.WithPrompt(prompt.Prompt),
+		ai.WithModelName(r.model),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to grade passages: %w", err)
+	}
+
+	scores := make([]float64, len(docs))
+	for _, s := range out.Scores {
+		if s.Index < 0 || s.Index >= len(docs) {
+			continue
+		}
+		scores[s.Index] = s.Score
+	}
+	return scores, nil
+}
+
+// rerankDocuments sorts the documents by decreasing reranker score and keeps the limit first ones.
+func rerankDocuments(
+	ctx context.Context,
+	reranker Reranker,
+	query string,
+	docs []*ai.Document,
+	limit int,
+) ([]*ai.Document, error) {
+	if len(docs) == 0 {
+		return docs, nil
+	}
+
+	scores, err := reranker.Rerank(ctx, query, docs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rerank documents: %w", err)
+	}
+	if len(scores) != len(docs) {
+		return nil, fmt.Errorf("reranker returned %d scores for %d documents", len(scores), len(docs))
+	}
+
+	order := make([]int, len(docs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	if limit <= 0 || limit > len(docs) {
+		limit = len(docs)
+	}
+
+	reranked := make([]*ai.Document, limit)
+	for i, idx := range order[:limit] {
+		doc := docs[idx]
+		if doc.Metadata == nil {
+			doc.Metadata = make(map[string]any)
+		}
+		doc.Metadata["rerank_score"] = scores[idx]
+		reranked[i] = doc
+	}
+	return reranked, nil
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+type fakeReranker struct {
+	scores []float64
+	err    error
+}
+
+func (r *fakeReranker) Rerank(ctx context.Context, query string, docs []*ai.Document) ([]float64, error) {
+	return r.scores, r.err
+}
+
+func Test_rerankDocuments_ShouldKeepBestScoredDocuments(t *testing.T) {
+	// Given
+	docs := []*ai.Document{
+		ai.DocumentFromText("doc 1", nil),
+		ai.DocumentFromText("doc 2", nil),
+		ai.DocumentFromText("doc 3", nil),
+		ai.DocumentFromText("doc 4", nil),
+	}
+	reranker := &fakeReranker{scores: []float64{1, 8, 3, 9}}
+
+	// When
+	res, err := rerankDocuments(context.Background(), reranker, "question", docs, 2)
+
+	// Then
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+	assert.Equal(t, "doc 4", pkg.ContentToText(res[0].Content))
+	assert.Equal(t, "doc 2", pkg.ContentToText(res[1].Content))
+	assert.Equal(t, 9.0, res[0].Metadata["rerank_score"])
+}
+
+func Test_rerankDocuments_ShouldFailWhenScoresDoNotMatchDocuments(t *testing.T) {
+	// Given
+	docs := []*ai.Document{
+		ai.DocumentFromText("doc 1", nil),
+		ai.DocumentFromText("doc 2", nil),
+	}
+	reranker := &fakeReranker{scores: []float64{1}}
+
+	// When
+	_, err := rerankDocuments(context.Background(), reranker, "question", docs, 1)
+
+	// Then
+	assert.Error(t, err)
+}
+
+func Test_rerankDocuments_ShouldPropagateRerankerError(t *testing.T) {
+	// Given
+	docs := []*ai.Document{ai.DocumentFromText("doc 1", nil)}
+	reranker := &fakeReranker{err: errors.New("boom")}
+
+	// When
+	_, err := rerankDocuments(context.Background(), reranker, "question", docs, 1)
+
+	// Then
+	assert.ErrorContains(t, err, "boom")
+}
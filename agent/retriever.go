@@ -10,15 +10,28 @@ import (
 )
 
 func (a *Agent) bookRetrieverHandler(ctx context.Context, req *ai.RetrieverRequest) (*ai.RetrieverResponse, error) {
-	books, err := a.bookRepository.ListSelected(ctx)
+	bookIDs, _ := req.Query.Metadata["book_ids"].([]string)
+	if len(bookIDs) == 0 {
+		pkg.Logger.Println("No book selected, returning empty retriever response")
+		return &ai.RetrieverResponse{Documents: make([]*ai.Document, 0)}, nil
+	}
+
+	books, err := a.bookRepository.ListByIDs(ctx, bookIDs)
 	if err != nil {
 		if errors.Is(err, domain.ErrBookNotFound) {
-			pkg.Logger.Println("No book selected, returning empty retriever response")
+			pkg.Logger.Println("No selected book found, returning empty retriever response")
 			return &ai.RetrieverResponse{Documents: make([]*ai.Document, 0)}, nil
 		}
 		return nil, fmt.Errorf("failed to get selected books: %w", err)
 	}
 
+	filters, _ := req.Query.Metadata["filters"].(map[string]string)
+	books = filterBooks(books, filters)
+	if len(books) == 0 {
+		pkg.Logger.Println("No selected book matches the metadata filters, returning empty retriever response")
+		return &ai.RetrieverResponse{Documents: make([]*ai.Document, 0)}, nil
+	}
+
 	limit, ok := req.Query.Metadata["limit"].(int)
 	if !ok || limit <= 0 {
 		limit = 3
@@ -27,7 +40,7 @@ func (a *Agent) bookRetrieverHandler(ctx context.Context, req *ai.RetrieverReque
 
 	query := pkg.ContentToText(req.Query.Content)
 
-	docs, err := retrieveDocument(a.embedder, a.bookVectorStore, ctx, books, query, limit)
+	docs, err := retrieveDocument(a.embedder, a.bookVectorStore, ctx, books, query, limit, a.retrieveOptions(query)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve documents: %w", err)
 	}
@@ -35,11 +48,35 @@ func (a *Agent) bookRetrieverHandler(ctx context.Context, req *ai.RetrieverReque
 	return &ai.RetrieverResponse{Documents: docs}, nil
 }
 
+// filterBooks keeps the books whose metadata match the filters, such as {"language": "en"}.
+func filterBooks(books []domain.Book, filters map[string]string) []domain.Book {
+	if len(filters) == 0 {
+		return books
+	}
+	kept := make([]domain.Book, 0, len(books))
+	for _, book := range books {
+		if book.MatchesMetadata(filters) {
+			kept = append(kept, book)
+		}
+	}
+	return kept
+}
+
+// retrieveOptions returns the vector store options matching the configured retrieval mode.
+func (a *Agent) retrieveOptions(query string) []domain.RetrieveOption {
+	var opts []domain.RetrieveOption
+	if domain.RetrievalModeFromString(a.cfg.RetrievalMode) == domain.RetrievalModeHybrid {
+		opts = append(opts, domain.WithHybridSearch(query, a.cfg.HybridVectorWeight, a.cfg.HybridLexicalWeight))
+	}
+	return opts
+}
+
 func retrieveDocument(
 	embedder ai.Embedder,
 	vectorStore domain.BookVectorStore,
 	ctx context.Context,
 	books []domain.Book, query string, limit int,
+	opts ...domain.RetrieveOption,
 ) ([]*ai.Document, error) {
 	eReq := &ai.EmbedRequest{
 		Input: []*ai.Document{ai.DocumentFromText(query, nil)},
@@ -50,5 +87,5 @@ func retrieveDocument(
 	}
 	vec := eRes.Embeddings[0].Embedding
 
-	return vectorStore.Retrieve(ctx, books, vec, limit)
+	return vectorStore.Retrieve(ctx, books, vec, limit, opts...)
 }
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+func Test_filterBooks(t *testing.T) {
+	// Metadata as read back from the JSONB column
+	books := []domain.Book{
+		{ID: "1", Metadata: map[string]any{
+			domain.MetadataLanguage:    "en",
+			domain.MetadataSubjects:    []any{"Computers", "Programming"},
+			domain.MetadataSeriesIndex: float64(2),
+		}},
+		{ID: "2", Metadata: map[string]any{
+			domain.MetadataLanguage: "fr",
+			domain.MetadataSubjects: []any{"Programming"},
+		}},
+		{ID: "3"},
+	}
+
+	testCases := []struct {
+		name     string
+		filters  map[string]string
+		expected []string
+	}{
+		{name: "should keep all the books without filters", filters: nil, expected: []string{"1", "2", "3"}},
+		{name: "should match a value regardless of the case", filters: map[string]string{"language": "EN"}, expected: []string{"1"}},
+		{name: "should match an item of a list", filters: map[string]string{"subjects": "programming"}, expected: []string{"1", "2"}},
+		{name: "should match a number", filters: map[string]string{"series_index": "2"}, expected: []string{"1"}},
+		{name: "should match all the filters", filters: map[string]string{"language": "fr", "subjects": "computers"}, expected: []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When
+			res := filterBooks(books, tc.filters)
+
+			// Then
+			ids := make([]string, len(res))
+			for i, book := range res {
+				ids[i] = book.ID
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/firebase/genkit/go/ai"
 	"github.com/google/uuid"
 	"github.com/thomas-marquis/goLLMan/pkg"
+	"sync"
 )
 
 type Option func(s *Session)
@@ -13,7 +14,7 @@ func WithLimit(limit int) Option {
 	if limit < 0 {
 		limit = 0
 	}
-	if limit <= 2 {
+	if limit > 0 && limit <= 2 {
 		limit = 2
 	}
 	return func(s *Session) {
@@ -32,17 +33,38 @@ func WithID(id string) Option {
 	}
 }
 
+// WithSummarization keeps the messages evicted by the limit until they are folded into the summary,
+// instead of discarding them.
+func WithSummarization() Option {
+	return func(s *Session) {
+		s.summarized = true
+	}
+}
+
+// WithBookIDs sets the books the conversation is scoped to.
+func WithBookIDs(ids ...string) Option {
+	return func(s *Session) {
+		s.SetBookIDs(ids)
+	}
+}
+
 func GenerateID() string {
 	return uuid.New().String()
 }
 
 type Session struct {
-	id               string
+	id string
+	// mu guards the fields below, as a session is shared by the requests of its conversation.
+	mu               sync.Mutex
 	messages         []*ai.Message
 	limited          bool
 	limit            int
 	hasSystemMessage bool
 	messageChan      chan *ai.Message
+	bookIDs          []string
+	summarized       bool
+	summary          string
+	evicted          []*ai.Message
 }
 
 func New(opts ...Option) *Session {
@@ -68,6 +90,8 @@ func (s *Session) ID() string {
 }
 
 func (s *Session) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	if s.limited {
 		return s.limit
 	}
@@ -75,6 +99,23 @@ func (s *Session) Limit() int {
 }
 
 func (s *Session) AddMessage(msg *ai.Message) error {
+	if err := s.appendMessage(msg); err != nil {
+		return err
+	}
+
+	select {
+	case s.messageChan <- msg:
+	default:
+		pkg.Logger.Printf("Session %s message channel is full, dropping message: %s", s.id, pkg.ContentToText(msg.Content))
+	}
+
+	return nil
+}
+
+func (s *Session) appendMessage(msg *ai.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if msg.Role == ai.RoleSystem {
 		if s.hasSystemMessage {
 			return fmt.Errorf("cannot add message to system message")
@@ -90,19 +131,20 @@ func (s *Session) AddMessage(msg *ai.Message) error {
 
 	if s.limited && len(s.messages) > s.limit {
 		if s.hasSystemMessage {
+			s.evict(s.messages[1])
 			s.messages = append([]*ai.Message{s.messages[0]}, s.messages[2:]...)
 		} else {
+			s.evict(s.messages[0])
 			s.messages = s.messages[1:]
 		}
 	}
+	return nil
+}
 
-	select {
-	case s.messageChan <- msg:
-	default:
-		pkg.Logger.Printf("Session %s message channel is full, dropping message: %s", s.id, pkg.ContentToText(msg.Content))
+func (s *Session) evict(msg *ai.Message) {
+	if s.summarized {
+		s.evicted = append(s.evicted, msg)
 	}
-
-	return nil
 }
 
 func (s *Session) ListenMessages() chan *ai.Message {
@@ -110,5 +152,88 @@ func (s *Session) ListenMessages() chan *ai.Message {
 }
 
 func (s *Session) GetMessages() []*ai.Message {
-	return s.messages
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := make([]*ai.Message, len(s.messages))
+	copy(messages, s.messages)
+	return messages
+}
+
+// Summary returns the summary of the messages evicted from the session so far.
+func (s *Session) Summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summary
+}
+
+// Evicted returns the messages evicted from the session and not yet folded into the summary.
+func (s *Session) Evicted() []*ai.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	evicted := make([]*ai.Message, len(s.evicted))
+	copy(evicted, s.evicted)
+	return evicted
+}
+
+// SetSummary replaces the summary once the evicted messages have been folded into it.
+func (s *Session) SetSummary(summary string, folded int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = summary
+	if folded > len(s.evicted) {
+		folded = len(s.evicted)
+	}
+	s.evicted = s.evicted[folded:]
+}
+
+// BookIDs returns the IDs of the books the conversation is scoped to.
+func (s *Session) BookIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(s.bookIDs))
+	copy(ids, s.bookIDs)
+	return ids
+}
+
+// SetBookIDs scopes the conversation to the given books, duplicates are ignored.
+func (s *Session) SetBookIDs(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bookIDs = make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !s.hasBook(id) {
+			s.bookIDs = append(s.bookIDs, id)
+		}
+	}
+}
+
+// HasBook returns true if the conversation is scoped to the given book.
+func (s *Session) HasBook(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hasBook(id)
+}
+
+func (s *Session) hasBook(id string) bool {
+	for _, bookID := range s.bookIDs {
+		if bookID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ToggleBook adds the book to the conversation scope or removes it if it was already there.
+// It returns true if the book is in the scope after the toggle.
+func (s *Session) ToggleBook(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, bookID := range s.bookIDs {
+		if bookID == id {
+			s.bookIDs = append(s.bookIDs[:i], s.bookIDs[i+1:]...)
+			return false
+		}
+	}
+	s.bookIDs = append(s.bookIDs, id)
+	return true
 }
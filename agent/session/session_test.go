@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/thomas-marquis/goLLMan/agent/session"
 	"github.com/thomas-marquis/goLLMan/pkg"
+	"sync"
 	"testing"
 )
 
@@ -59,3 +60,61 @@ func Test_Session_AddMessage_ShouldRemoveOldestMessageWithoutSystemMessage(t *te
 	assert.Equal(t, "user message 3", pkg.ContentToText(res[0].Content))
 	assert.Equal(t, "assistant response 3", pkg.ContentToText(res[1].Content))
 }
+
+func Test_Session_ToggleBook_ShouldAddThenRemoveBook(t *testing.T) {
+	// Given
+	sess := session.New(session.WithBookIDs("1", "2", "1"))
+
+	// When
+	added := sess.ToggleBook("3")
+	removed := sess.ToggleBook("1")
+
+	// Then
+	assert.True(t, added)
+	assert.False(t, removed)
+	assert.Equal(t, []string{"2", "3"}, sess.BookIDs())
+	assert.False(t, sess.HasBook("1"))
+}
+
+func Test_Session_AddMessage_ShouldKeepEvictedMessagesToSummarize(t *testing.T) {
+	// Given
+	sess := session.New(session.WithLimit(2), session.WithSummarization())
+	for _, text := range []string{"user message 1", "assistant response 1", "user message 2", "assistant response 2"} {
+		assert.NoError(t, sess.AddMessage(ai.NewUserTextMessage(text)))
+	}
+	evicted := sess.Evicted()
+	assert.NoError(t, sess.AddMessage(ai.NewUserTextMessage("user message 3")))
+
+	// When
+	sess.SetSummary("the user said hello twice", len(evicted))
+
+	// Then
+	assert.Len(t, evicted, 2)
+	assert.Equal(t, "user message 1", evicted[0].Text())
+	assert.Equal(t, "assistant response 1", evicted[1].Text())
+	assert.Equal(t, "the user said hello twice", sess.Summary())
+	assert.Len(t, sess.Evicted(), 1)
+	assert.Equal(t, "user message 2", sess.Evicted()[0].Text())
+}
+
+func Test_Session_ShouldSupportConcurrentRequests(t *testing.T) {
+	// Given
+	sess := session.New(session.WithLimit(4), session.WithSummarization())
+	var wg sync.WaitGroup
+
+	// When
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, sess.AddMessage(ai.NewUserTextMessage("user message")))
+			sess.ToggleBook("1")
+			sess.SetSummary(sess.Summary(), len(sess.Evicted()))
+			_ = sess.GetMessages()
+		}()
+	}
+	wg.Wait()
+
+	// Then
+	assert.Len(t, sess.GetMessages(), 4)
+}
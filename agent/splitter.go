@@ -0,0 +1,305 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/tmc/langchaingo/textsplitter"
+)
+
+const (
+	// SplitterMarkdown splits along the markdown structure: headings, paragraphs, lists, code blocks...
+	SplitterMarkdown = "markdown"
+	// SplitterRecursive splits on paragraphs, then lines, then words until the chunks fit.
+	SplitterRecursive = "recursive"
+	// SplitterToken is the recursive splitter with the chunk size and overlap counted in tokens.
+	SplitterToken = "token"
+	// SplitterSentenceWindow groups whole sentences, the overlap repeating the last sentences of the previous chunk.
+	SplitterSentenceWindow = "sentence_window"
+
+	defaultChunkSize    = 1000
+	defaultChunkOverlap = 100
+
+	// splitterMetadataKey is the book metadata key recording how its chunks were split.
+	splitterMetadataKey = domain.MetadataSplitter
+)
+
+// SplitterConfig tells how the books are split into chunks before being embedded.
+// Changing it requires the books to be indexed again, see SplitterConfig.Outdated and Agent.OutdatedBooks.
+type SplitterConfig struct {
+	// Strategy is one of SplitterMarkdown (default), SplitterRecursive, SplitterToken or SplitterSentenceWindow.
+	Strategy string
+	// ChunkSize is the maximum size of a chunk, in characters or in tokens for SplitterToken.
+	ChunkSize int
+	// ChunkOverlap is the size of the end of a chunk repeated at the beginning of the next one.
+	ChunkOverlap int
+	// HeadingContext prepends the hierarchy of the headings a chunk is under to its content.
+	HeadingContext bool
+}
+
+// DefaultSplitterConfig returns the markdown splitter with 1000 characters chunks overlapping by 100,
+// along with their heading context.
+func DefaultSplitterConfig() SplitterConfig {
+	return SplitterConfig{
+		Strategy:       SplitterMarkdown,
+		ChunkSize:      defaultChunkSize,
+		ChunkOverlap:   defaultChunkOverlap,
+		HeadingContext: true,
+	}
+}
+
+func (c SplitterConfig) withDefaults() SplitterConfig {
+	if c.Strategy == "" {
+		return DefaultSplitterConfig()
+	}
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = defaultChunkSize
+		if c.Strategy == SplitterToken {
+			c.ChunkSize = int(defaultChunkSize / defaultCharsPerToken)
+		}
+	}
+	if c.ChunkOverlap < 0 || c.ChunkOverlap >= c.ChunkSize {
+		c.ChunkOverlap = 0
+	}
+	return c
+}
+
+// Metadata returns the configuration as recorded in the metadata of the indexed books.
+func (c SplitterConfig) Metadata() map[string]any {
+	c = c.withDefaults()
+	return map[string]any{
+		"strategy":       c.Strategy,
+		"chunkSize":      c.ChunkSize,
+		"chunkOverlap":   c.ChunkOverlap,
+		"headingContext": c.HeadingContext,
+	}
+}
+
+// Outdated tells whether the book was indexed with another splitter configuration, or before it was recorded.
+func (c SplitterConfig) Outdated(book domain.Book) bool {
+	recorded, ok := book.Metadata[splitterMetadataKey].(map[string]any)
+	if !ok {
+		return true
+	}
+	for k, v := range c.Metadata() {
+		if fmt.Sprint(recorded[k]) != fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitterFactory creates the text splitter of a strategy. The token counter measures the chunks of SplitterToken.
+type SplitterFactory func(cfg SplitterConfig, counter TokenCounter) textsplitter.TextSplitter
+
+var splitterFactories = map[string]SplitterFactory{
+	SplitterMarkdown:       newMarkdownSplitter,
+	SplitterRecursive:      newRecursiveSplitter,
+	SplitterToken:          newTokenSplitter,
+	SplitterSentenceWindow: newSentenceWindowSplitter,
+}
+
+// RegisterSplitter makes a splitting strategy available to the configuration.
+func RegisterSplitter(strategy string, factory SplitterFactory) {
+	splitterFactories[strategy] = factory
+}
+
+// SplitterStrategies returns the registered splitting strategies.
+func SplitterStrategies() []string {
+	strategies := make([]string, 0, len(splitterFactories))
+	for s := range splitterFactories {
+		strategies = append(strategies, s)
+	}
+	sort.Strings(strategies)
+	return strategies
+}
+
+// NewTextSplitter returns the splitter of the configured strategy.
+// Apart from the markdown one, which tracks the headings itself, the heading context is prepended by a wrapper.
+func NewTextSplitter(cfg SplitterConfig, counter TokenCounter) (textsplitter.TextSplitter, error) {
+	cfg = cfg.withDefaults()
+	factory, ok := splitterFactories[cfg.Strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown splitter strategy %s, expected one of %v", cfg.Strategy, SplitterStrategies())
+	}
+
+	splitter := factory(cfg, counter)
+	if cfg.HeadingContext && cfg.Strategy != SplitterMarkdown {
+		splitter = headingContextSplitter{splitter: splitter}
+	}
+	return splitter, nil
+}
+
+func newMarkdownSplitter(cfg SplitterConfig, _ TokenCounter) textsplitter.TextSplitter {
+	return textsplitter.NewMarkdownTextSplitter(
+		textsplitter.WithCodeBlocks(true),
+		textsplitter.WithKeepSeparator(true),
+		textsplitter.WithChunkSize(cfg.ChunkSize),
+		textsplitter.WithChunkOverlap(cfg.ChunkOverlap),
+		textsplitter.WithHeadingHierarchy(cfg.HeadingContext),
+	)
+}
+
+func newRecursiveSplitter(cfg SplitterConfig, _ TokenCounter) textsplitter.TextSplitter {
+	return textsplitter.NewRecursiveCharacter(
+		textsplitter.WithChunkSize(cfg.ChunkSize),
+		textsplitter.WithChunkOverlap(cfg.ChunkOverlap),
+	)
+}
+
+// newTokenSplitter counts the tokens with the same estimate as the token budget,
+// which works offline and with any provider.
+func newTokenSplitter(cfg SplitterConfig, counter TokenCounter) textsplitter.TextSplitter {
+	return textsplitter.NewRecursiveCharacter(
+		textsplitter.WithChunkSize(cfg.ChunkSize),
+		textsplitter.WithChunkOverlap(cfg.ChunkOverlap),
+		textsplitter.WithLenFunc(counter.CountTokens),
+	)
+}
+
+// sentenceEndRe matches the end of a sentence: its punctuation followed by spaces, or a blank line.
+var sentenceEndRe = regexp.MustCompile(`[.!?…]["'»”)\]]*\s+|\n\s*\n`)
+
+type sentenceWindowSplitter struct {
+	chunkSize    int
+	chunkOverlap int
+}
+
+func newSentenceWindowSplitter(cfg SplitterConfig, _ TokenCounter) textsplitter.TextSplitter {
+	return sentenceWindowSplitter{chunkSize: cfg.ChunkSize, chunkOverlap: cfg.ChunkOverlap}
+}
+
+// SplitText groups whole sentences up to the chunk size. A sentence longer than the chunk size
+// makes a chunk on its own. Each chunk starts with the last sentences of the previous one
+// fitting in the overlap.
+func (s sentenceWindowSplitter) SplitText(text string) ([]string, error) {
+	sentences := splitSentences(text)
+
+	chunks := make([]string, 0)
+	var window []string
+	size := 0
+	for _, sentence := range sentences {
+		length := len([]rune(sentence))
+		if size > 0 && size+length > s.chunkSize {
+			chunks = append(chunks, strings.TrimSpace(strings.Join(window, "")))
+
+			// Keep the last sentences fitting in the overlap
+			kept := 0
+			overlap := 0
+			for i := len(window) - 1; i >= 0; i-- {
+				l := len([]rune(window[i]))
+				if overlap+l > s.chunkOverlap || overlap+l+length > s.chunkSize {
+					break
+				}
+				overlap += l
+				kept++
+			}
+			window = append([]string{}, window[len(window)-kept:]...)
+			size = overlap
+		}
+		window = append(window, sentence)
+		size += length
+	}
+	if size > 0 {
+		chunks = append(chunks, strings.TrimSpace(strings.Join(window, "")))
+	}
+	return chunks, nil
+}
+
+// splitSentences cuts the text after each sentence end, keeping the separators so that joining
+// consecutive sentences gives back the original text.
+func splitSentences(text string) []string {
+	sentences := make([]string, 0)
+	start := 0
+	for _, loc := range sentenceEndRe.FindAllStringIndex(text, -1) {
+		if strings.TrimSpace(text[start:loc[1]]) != "" {
+			sentences = append(sentences, text[start:loc[1]])
+		}
+		start = loc[1]
+	}
+	if strings.TrimSpace(text[start:]) != "" {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// headingContextSplitter prepends to each chunk the hierarchy of the markdown headings it is under,
+// in the format of the markdown splitter, so that headingPath reads it back.
+type headingContextSplitter struct {
+	splitter textsplitter.TextSplitter
+}
+
+func (s headingContextSplitter) SplitText(text string) ([]string, error) {
+	chunks, err := s.splitter.SplitText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	headings := headingsByOffset(text)
+	offset := 0
+	for i, chunk := range chunks {
+		idx := strings.Index(text[offset:], chunk)
+		if idx < 0 {
+			continue
+		}
+		start := offset + idx
+		offset = start + 1
+
+		context := headingsAt(headings, start, chunk)
+		if context != "" {
+			chunks[i] = context + "\n" + chunk
+		}
+	}
+	return chunks, nil
+}
+
+type markdownHeading struct {
+	offset int
+	level  int
+	line   string
+}
+
+// headingsByOffset lists the ATX headings of the text along with where they start, ignoring the code blocks.
+func headingsByOffset(text string) []markdownHeading {
+	headings := make([]markdownHeading, 0)
+	lines := strings.SplitAfter(text, "\n")
+	fenced := fencedLines(lines)
+	offset := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !fenced[i] && isATXHeading(trimmed) {
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			headings = append(headings, markdownHeading{offset: offset, level: level, line: trimmed})
+		}
+		offset += len(line)
+	}
+	return headings
+}
+
+// headingsAt returns the hierarchy of the headings above the offset, one per line,
+// without the ones the chunk already starts with.
+func headingsAt(headings []markdownHeading, offset int, chunk string) string {
+	stack := make([]markdownHeading, 0)
+	for _, h := range headings {
+		if h.offset >= offset {
+			break
+		}
+		for len(stack) > 0 && stack[len(stack)-1].level >= h.level {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, h)
+	}
+
+	lines := make([]string, 0, len(stack))
+	for _, h := range stack {
+		lines = append(lines, h.line)
+	}
+	context := strings.Join(lines, "\n")
+	if context == "" || strings.HasPrefix(strings.TrimSpace(chunk), "#") {
+		return ""
+	}
+	return context
+}
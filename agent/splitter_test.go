@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+func TestNewTextSplitter_ShouldRejectUnknownStrategy(t *testing.T) {
+	// Given
+	cfg := SplitterConfig{Strategy: "semantic"}
+
+	// When
+	_, err := NewTextSplitter(cfg, CharsTokenCounter{})
+
+	// Then
+	assert.ErrorContains(t, err, "unknown splitter strategy semantic")
+}
+
+func TestSentenceWindowSplitter_ShouldKeepWholeSentencesWithOverlap(t *testing.T) {
+	// Given
+	splitter, err := NewTextSplitter(SplitterConfig{
+		Strategy:     SplitterSentenceWindow,
+		ChunkSize:    40,
+		ChunkOverlap: 20,
+	}, CharsTokenCounter{})
+	require.NoError(t, err)
+
+	// When
+	chunks, err := splitter.SplitText("First sentence here. Second one! Third sentence? Fourth and last.")
+
+	// Then
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"First sentence here. Second one!",
+		"Second one! Third sentence?",
+		"Third sentence? Fourth and last.",
+	}, chunks)
+}
+
+func TestTokenSplitter_ShouldCountChunkSizeInTokens(t *testing.T) {
+	// Given
+	splitter, err := NewTextSplitter(SplitterConfig{
+		Strategy:  SplitterToken,
+		ChunkSize: 10,
+	}, CharsTokenCounter{CharsPerToken: 4})
+	require.NoError(t, err)
+	text := strings.Repeat("word ", 40)
+
+	// When
+	chunks, err := splitter.SplitText(text)
+
+	// Then
+	require.NoError(t, err)
+	require.Greater(t, len(chunks), 1)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 40)
+	}
+}
+
+func TestSplitDocuments_ShouldPrependHeadingContextWithAnyStrategy(t *testing.T) {
+	// Given
+	splitter, err := NewTextSplitter(SplitterConfig{
+		Strategy:       SplitterSentenceWindow,
+		ChunkSize:      30,
+		HeadingContext: true,
+	}, CharsTokenCounter{})
+	require.NoError(t, err)
+	docs := []*ai.Document{
+		ai.DocumentFromText("# Channels\n\n## Buffered\n\nA buffered channel blocks. Only when it is full.",
+			map[string]any{"chapter_title": "Channels"}),
+	}
+
+	// When
+	out, err := SplitDocuments(splitter, docs)
+
+	// Then
+	require.NoError(t, err)
+	last := out[len(out)-1]
+	assert.Equal(t, []string{"Channels", "Buffered"}, last.Metadata["heading_path"])
+	assert.True(t, strings.HasPrefix(last.Content[0].Text, "# Channels\n## Buffered\n"))
+}
+
+func TestSplitterConfig_Outdated(t *testing.T) {
+	// Given
+	cfg := SplitterConfig{Strategy: SplitterRecursive, ChunkSize: 800, ChunkOverlap: 100}
+	indexed := domain.Book{Metadata: map[string]any{
+		// as read back from the JSON column
+		"splitter": map[string]any{
+			"strategy":       "recursive",
+			"chunkSize":      float64(800),
+			"chunkOverlap":   float64(100),
+			"headingContext": false,
+		},
+	}}
+
+	// When & Then
+	assert.False(t, cfg.Outdated(indexed))
+	assert.True(t, DefaultSplitterConfig().Outdated(indexed))
+	assert.True(t, cfg.Outdated(domain.Book{Metadata: map[string]any{}}))
+}
+
+type listBookRepository struct {
+	domain.BookRepository
+	books []domain.Book
+}
+
+func (r *listBookRepository) List(ctx context.Context) ([]domain.Book, error) {
+	return r.books, nil
+}
+
+func TestAgent_OutdatedBooks_ShouldListIndexedBooksSplitOtherwise(t *testing.T) {
+	// Given
+	cfg := DefaultSplitterConfig()
+	upToDate := map[string]any{splitterMetadataKey: cfg.Metadata()}
+	a := &Agent{
+		cfg: Config{Splitter: cfg},
+		bookRepository: &listBookRepository{books: []domain.Book{
+			{ID: "1", Status: domain.StatusIndexed, Metadata: upToDate},
+			{ID: "2", Status: domain.StatusIndexed, Metadata: map[string]any{}},
+			{ID: "3", Status: domain.StatusNew, Metadata: map[string]any{}},
+		}},
+	}
+
+	// When
+	res, err := a.OutdatedBooks(context.Background())
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "2", res[0].ID)
+}
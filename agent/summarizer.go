@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/thomas-marquis/goLLMan/agent/session"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+// SummarizationInput is the running summary of a conversation and the messages to fold into it.
+type SummarizationInput struct {
+	Summary  string        `json:"summary,omitempty"`
+	Messages []*ai.Message `json:"messages"`
+}
+
+func (a *Agent) summarizationFlowHandler(ctx context.Context, input SummarizationInput) (string, error) {
+	conversation := formatConversation(input.Messages)
+	if conversation == "" {
+		return input.Summary, nil
+	}
+
+	prompt, err := a.renderPrompt(ctx,
+		promptCall{name: summarizeSystemPromptName},
+		promptCall{name: summarizeUserPromptName, input: map[string]any{
+			"summary":      input.Summary,
+			"conversation": conversation,
+		}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	model := a.cfg.SummaryModel
+	if model == "" {
+		model = a.cfg.CompletionModel
+	}
+	summary, err := genkit.GenerateText(ctx, a.g,
+		ai.WithSystem(prompt.System),
+		ai.WithPrompt(prompt.Prompt),
+		ai.WithModelName(model),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize the conversation: %w", err)
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+// summarizeHistory folds the messages evicted from the session into its summary.
+// On failure, the messages are kept to be folded on the next turn.
+func (a *Agent) summarizeHistory(ctx context.Context, sess *session.Session) {
+	evicted := sess.Evicted()
+	if a.summarizationFlow == nil || len(evicted) == 0 {
+		return
+	}
+
+	summary, err := a.summarizationFlow.Run(ctx, SummarizationInput{
+		Summary:  sess.Summary(),
+		Messages: evicted,
+	})
+	if err != nil {
+		pkg.Logger.Printf("Failed to summarize the session %s history: %s\n", sess.ID(), err)
+		return
+	}
+	sess.SetSummary(summary, len(evicted))
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/agent/provider/fake"
+	"github.com/thomas-marquis/goLLMan/agent/session"
+)
+
+func Test_summarizeHistory_ShouldFoldEvictedMessagesIntoSummary(t *testing.T) {
+	// Given
+	a := newFakeAgent(t, Config{MemoryStrategy: MemoryStrategySummary},
+		fake.Fixture{Match: "user: who is fantine?", Answer: "- The user asked about Fantine.\n"})
+	a.summarizationFlow = genkit.DefineFlow(a.g, "summarizationFlow", a.summarizationFlowHandler)
+
+	sess := session.New(session.WithLimit(2), session.WithSummarization())
+	for _, msg := range []*ai.Message{
+		ai.NewUserTextMessage("Who is Fantine?"),
+		ai.NewModelTextMessage("A young woman in Les Misérables."),
+		ai.NewUserTextMessage("And Cosette?"),
+	} {
+		require.NoError(t, sess.AddMessage(msg))
+	}
+
+	// When
+	a.summarizeHistory(context.Background(), sess)
+
+	// Then
+	assert.Equal(t, "- The user asked about Fantine.", sess.Summary())
+	assert.Empty(t, sess.Evicted())
+	assert.Len(t, sess.GetMessages(), 2)
+}
+
+func Test_summarizeHistory_ShouldDoNothingWithTrimStrategy(t *testing.T) {
+	// Given
+	a := newFakeAgent(t, Config{})
+	sess := session.New(session.WithLimit(2))
+	for _, text := range []string{"Who is Fantine?", "A young woman.", "And Cosette?"} {
+		require.NoError(t, sess.AddMessage(ai.NewUserTextMessage(text)))
+	}
+
+	// When
+	a.summarizeHistory(context.Background(), sess)
+
+	// Then
+	assert.Empty(t, sess.Summary())
+}
@@ -12,16 +12,40 @@ import (
 var (
 	atxHeadingRe      = regexp.MustCompile(`^\s{0,3}#{1,6}(\s+|$).*`)
 	setextUnderlineRe = regexp.MustCompile(`^\s{0,3}(=+|-+)\s*$`)
+	fenceRe           = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
 )
 
-func makeTextSplitter() textsplitter.TextSplitter {
-	splitter := textsplitter.NewMarkdownTextSplitter(
-		textsplitter.WithCodeBlocks(true),
-		textsplitter.WithKeepSeparator(true),
-		textsplitter.WithChunkSize(1000),
-		textsplitter.WithHeadingHierarchy(true),
-	)
-	return splitter
+// fencedLines tells for each line whether it is a code fence or inside a fenced code block.
+func fencedLines(lines []string) []bool {
+	fenced := make([]bool, len(lines))
+	fence := ""
+	for i, line := range lines {
+		if m := fenceRe.FindStringSubmatch(line); m != nil {
+			switch {
+			case fence == "":
+				fence = m[1]
+			case strings.HasPrefix(m[1], fence):
+				fence = ""
+			}
+			fenced[i] = true
+			continue
+		}
+		fenced[i] = fence != ""
+	}
+	return fenced
+}
+
+// markdownHeadingLines returns the ATX headings of the text, trimmed, ignoring the code blocks.
+func markdownHeadingLines(text string) map[string]bool {
+	lines := strings.Split(text, "\n")
+	fenced := fencedLines(lines)
+	headings := make(map[string]bool)
+	for i, line := range lines {
+		if trimmed := strings.TrimSpace(line); !fenced[i] && isATXHeading(trimmed) {
+			headings[trimmed] = true
+		}
+	}
+	return headings
 }
 
 // isATXHeading returns true if the given line is an ATX-style heading (#, ##, ..., ######).
@@ -74,26 +98,63 @@ func OnlyContainsHeaders(text string) bool {
 }
 
 // SplitDocuments splits the given documents into chunks based on the given splitter.
+// Each chunk gets a copy of its document metadata along with where it comes from:
+// the chapter index (the document index unless the loader set it), its position in the chapter
+// and the path of the headings it is under.
 func SplitDocuments(splitter textsplitter.TextSplitter, docs []*ai.Document) ([]*ai.Document, error) {
 	preparedDocs := make([]*ai.Document, 0)
-	for _, doc := range docs {
+	for i, doc := range docs {
 		text := pkg.ContentToText(doc.Content)
 		chunks, err := splitter.SplitText(text)
 		if err != nil {
 			return nil, err
 		}
 
+		chapterIndex := i
+		if idx, ok := doc.Metadata["chapter_index"].(int); ok {
+			chapterIndex = idx
+		}
+
+		headings := markdownHeadingLines(text)
+		position := 0
 		for _, chunk := range chunks {
 			if len(chunk) == 0 || OnlyContainsHeaders(chunk) {
 				continue
 			}
 			chunk = strings.TrimSpace(chunk)
-			preparedDocs = append(preparedDocs, ai.DocumentFromText(chunk, doc.Metadata))
+
+			metadata := make(map[string]any, len(doc.Metadata)+3)
+			for k, v := range doc.Metadata {
+				metadata[k] = v
+			}
+			metadata["chapter_index"] = chapterIndex
+			metadata["position"] = position
+			metadata["heading_path"] = headingPath(chunk, headings)
+			position++
+
+			preparedDocs = append(preparedDocs, ai.DocumentFromText(chunk, metadata))
 		}
 	}
 	return preparedDocs, nil
 }
 
+// headingPath returns the titles of the ATX headings the chunk starts with,
+// which the markdown splitter prepends to each chunk as the hierarchy of its section.
+// Only the headings of the document count: a chunk cut in a code block may start with a comment like "# Then".
+func headingPath(chunk string, headings map[string]bool) []string {
+	path := make([]string, 0)
+	for _, line := range strings.Split(chunk, "\n") {
+		line = strings.TrimSpace(line)
+		if !isATXHeading(line) || !headings[line] {
+			break
+		}
+		if title := strings.TrimSpace(strings.TrimLeft(line, "#")); title != "" {
+			path = append(path, title)
+		}
+	}
+	return path
+}
+
 func batchDocuments(docs []*ai.Document, batchSize int) [][]*ai.Document {
 	if batchSize <= 0 {
 		batchSize = 1
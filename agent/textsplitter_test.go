@@ -7,6 +7,8 @@ import (
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thomas-marquis/goLLMan/pkg"
 )
 
@@ -75,7 +77,8 @@ func TestOnlyContainsHeaders_TestdataFiles_Snapshot(t *testing.T) {
 
 func TestSplitDocuments_Snapshot(t *testing.T) {
 	// Prepare splitter
-	splitter := makeTextSplitter()
+	splitter, err := NewTextSplitter(DefaultSplitterConfig(), CharsTokenCounter{})
+	require.NoError(t, err)
 
 	// Define input files for splitting
 	files := []string{
@@ -117,3 +120,43 @@ func TestSplitDocuments_Snapshot(t *testing.T) {
 
 	snaps.MatchSnapshot(t, simplified)
 }
+
+func TestSplitDocuments_ShouldLocateChunks(t *testing.T) {
+	// Given
+	splitter, err := NewTextSplitter(DefaultSplitterConfig(), CharsTokenCounter{})
+	require.NoError(t, err)
+	docs := []*ai.Document{
+		ai.DocumentFromText("# Preface\nA short preface.", map[string]any{"chapter_title": "Preface"}),
+		ai.DocumentFromText("# Channels\nIntro.\n## Buffered\nA buffered channel.\n## Unbuffered\nAn unbuffered one.",
+			map[string]any{"chapter_title": "Channels", "chapter_index": 4}),
+	}
+
+	// When
+	out, err := SplitDocuments(splitter, docs)
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, out, 4)
+	assert.Equal(t, map[string]any{
+		"chapter_title": "Preface",
+		"chapter_index": 0,
+		"position":      0,
+		"heading_path":  []string{"Preface"},
+	}, out[0].Metadata)
+	assert.Equal(t, 4, out[3].Metadata["chapter_index"])
+	assert.Equal(t, 2, out[3].Metadata["position"])
+	assert.Equal(t, []string{"Channels", "Unbuffered"}, out[3].Metadata["heading_path"])
+	assert.NotContains(t, docs[1].Metadata, "position", "the documents metadata should not be modified")
+}
+
+func Test_headingPath_ShouldIgnoreCommentsOfCodeBlocks(t *testing.T) {
+	// Given
+	text := "# Testing\n## Mocks\n```python\n# Given\nmock = MagicMock()\n```"
+	chunk := "# Testing\n## Mocks\n# Given\nmock = MagicMock()"
+
+	// When
+	res := headingPath(chunk, markdownHeadingLines(text))
+
+	// Then
+	assert.Equal(t, []string{"Testing", "Mocks"}, res)
+}
@@ -0,0 +1,303 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
+
+const (
+	// neighborChunksRadius is the number of chunks returned before and after the requested one.
+	neighborChunksRadius = 2
+)
+
+type searchBooksInput struct {
+	Query   string            `json:"query" jsonschema_description:"The search query, written as a standalone question or keywords"`
+	BookIDs []string          `json:"book_ids,omitempty" jsonschema_description:"IDs of the books to search in, among the ones selected for the conversation. Leave empty to search in all of them"`
+	Filters map[string]string `json:"filters,omitempty" jsonschema_description:"Metadata the books must match, such as language, publisher, published, isbn, subjects or series. Leave empty to keep all the books"`
+}
+
+type getChapterInput struct {
+	BookID       string `json:"book_id" jsonschema_description:"ID of the book"`
+	Title        string `json:"title" jsonschema_description:"Title of the chapter, as given with the passages"`
+	ChapterIndex *int   `json:"chapter_index,omitempty" jsonschema_description:"Index of the chapter, as given with the passages. Only needed when several chapters share the same title"`
+}
+
+type getNeighborChunksInput struct {
+	ChunkID string `json:"chunk_id" jsonschema_description:"ID of the chunk to expand"`
+}
+
+type toolPassage struct {
+	ChunkID      string   `json:"chunk_id"`
+	BookID       string   `json:"book_id"`
+	BookTitle    string   `json:"book_title"`
+	ChapterTitle string   `json:"chapter_title,omitempty"`
+	ChapterIndex int      `json:"chapter_index"`
+	HeadingPath  []string `json:"heading_path,omitempty"`
+	Content      string   `json:"content"`
+}
+
+type toolBook struct {
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	Author    string   `json:"author"`
+	Status    string   `json:"status"`
+	Language  string   `json:"language,omitempty"`
+	Publisher string   `json:"publisher,omitempty"`
+	Published string   `json:"published,omitempty"`
+	Subjects  []string `json:"subjects,omitempty"`
+	Series    string   `json:"series,omitempty"`
+}
+
+// defineTools registers the library tools available to the model in the agent chat mode.
+func (a *Agent) defineTools() []ai.ToolRef {
+	return []ai.ToolRef{
+		genkit.DefineTool(a.g, "search_books",
+			"Search the passages of the books that are the most relevant to a query.",
+			a.searchBooksTool),
+		genkit.DefineTool(a.g, "list_books",
+			"List the books selected for the conversation.",
+			a.listBooksTool),
+		genkit.DefineTool(a.g, "get_chapter",
+			"Get the content of a book chapter, given by its title.",
+			a.getChapterTool),
+		genkit.DefineTool(a.g, "get_neighbor_chunks",
+			"Get the passages just before and after a given passage, to read it in its context.",
+			a.getNeighborChunksTool),
+	}
+}
+
+func (a *Agent) searchBooksTool(ctx *ai.ToolContext, input searchBooksInput) ([]toolPassage, error) {
+	bookIDs := scopeBookIDs(ctx, input.BookIDs)
+	if len(bookIDs) == 0 {
+		return []toolPassage{}, nil
+	}
+
+	books, err := a.bookRepository.ListByIDs(ctx, bookIDs)
+	if err != nil {
+		if errors.Is(err, domain.ErrBookNotFound) {
+			return []toolPassage{}, nil
+		}
+		return nil, fmt.Errorf("failed to get books: %w", err)
+	}
+	books = filterBooks(books, mergeBookFilters(ctx, input.Filters))
+	if len(books) == 0 {
+		return []toolPassage{}, nil
+	}
+
+	docs, err := retrieveDocument(a.embedder, a.bookVectorStore, ctx, books, input.Query,
+		a.cfg.RetrievalLimit, a.retrieveOptions(input.Query)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search books: %w", err)
+	}
+	return a.collectPassages(ctx, docs), nil
+}
+
+func (a *Agent) listBooksTool(ctx *ai.ToolContext, _ struct{}) ([]toolBook, error) {
+	bookIDs := bookScopeFromContext(ctx)
+	if len(bookIDs) == 0 {
+		return []toolBook{}, nil
+	}
+
+	books, err := a.bookRepository.ListByIDs(ctx, bookIDs)
+	if err != nil {
+		if errors.Is(err, domain.ErrBookNotFound) {
+			return []toolBook{}, nil
+		}
+		return nil, fmt.Errorf("failed to list books: %w", err)
+	}
+
+	res := make([]toolBook, len(books))
+	for i, book := range books {
+		res[i] = toolBook{
+			ID:        book.ID,
+			Title:     book.Title,
+			Author:    book.Author,
+			Status:    book.Status.String(),
+			Language:  book.MetadataString(domain.MetadataLanguage),
+			Publisher: book.MetadataString(domain.MetadataPublisher),
+			Published: book.MetadataString(domain.MetadataPublished),
+			Subjects:  book.MetadataStrings(domain.MetadataSubjects),
+			Series:    book.MetadataString(domain.MetadataSeries),
+		}
+	}
+	return res, nil
+}
+
+func (a *Agent) getChapterTool(ctx *ai.ToolContext, input getChapterInput) ([]toolPassage, error) {
+	if !isInBookScope(ctx, input.BookID) {
+		return []toolPassage{}, nil
+	}
+
+	book, err := a.bookRepository.GetByID(ctx, input.BookID)
+	if err != nil {
+		if errors.Is(err, domain.ErrBookNotFound) {
+			return []toolPassage{}, nil
+		}
+		return nil, fmt.Errorf("failed to get book %s: %w", input.BookID, err)
+	}
+
+	var chapterIndex int
+	if input.ChapterIndex != nil {
+		chapterIndex = *input.ChapterIndex
+	} else {
+		chapterIndex, err = a.bookVectorStore.FindChapterIndex(ctx, book, input.Title)
+		if err != nil {
+			if errors.Is(err, domain.ErrChapterNotFound) {
+				return []toolPassage{}, nil
+			}
+			return nil, fmt.Errorf("failed to find chapter %q: %w", input.Title, err)
+		}
+	}
+
+	docs, err := a.bookVectorStore.ListChapterParts(ctx, book, chapterIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chapter %d: %w", chapterIndex, err)
+	}
+	return a.collectPassages(ctx, docs), nil
+}
+
+func (a *Agent) getNeighborChunksTool(ctx *ai.ToolContext, input getNeighborChunksInput) ([]toolPassage, error) {
+	docs, err := a.bookVectorStore.GetNeighborParts(ctx, input.ChunkID, neighborChunksRadius)
+	if err != nil {
+		if errors.Is(err, domain.ErrBookPartNotFound) {
+			return []toolPassage{}, nil
+		}
+		return nil, fmt.Errorf("failed to get neighbor chunks of %s: %w", input.ChunkID, err)
+	}
+	docs = slices.DeleteFunc(docs, func(doc *ai.Document) bool {
+		return !isInBookScope(ctx, metadataToString(doc.Metadata["book_id"]))
+	})
+	return a.collectPassages(ctx, docs), nil
+}
+
+// collectPassages converts the documents fitting in the tool output budget to tool outputs
+// and records them as sources of the answer.
+func (a *Agent) collectPassages(ctx context.Context, docs []*ai.Document) []toolPassage {
+	budget := a.tokenBudget()
+	docs, _, _ = budget.fitDocuments(docs, budget.toolOutputTokens())
+
+	if sources := sourcesFromContext(ctx); sources != nil {
+		sources.add(docs...)
+	}
+
+	passages := make([]toolPassage, len(docs))
+	for i, doc := range docs {
+		bookTitle, _ := doc.Metadata["book_title"].(string)
+		chapterTitle, _ := doc.Metadata["chapter_title"].(string)
+		passages[i] = toolPassage{
+			ChunkID:      metadataToString(doc.Metadata["id"]),
+			BookID:       metadataToString(doc.Metadata["book_id"]),
+			BookTitle:    bookTitle,
+			ChapterTitle: chapterTitle,
+			ChapterIndex: metadataToInt(doc.Metadata["chapter_index"]),
+			HeadingPath:  metadataToStrings(doc.Metadata["heading_path"]),
+			Content:      pkg.ContentToText(doc.Content),
+		}
+	}
+	return passages
+}
+
+type sourcesContextKey struct{}
+
+type bookScopeContextKey struct{}
+
+type bookFiltersContextKey struct{}
+
+// withBookScope sets the books selected for the conversation, the only ones the tools can read.
+func withBookScope(ctx context.Context, bookIDs []string) context.Context {
+	return context.WithValue(ctx, bookScopeContextKey{}, bookIDs)
+}
+
+func bookScopeFromContext(ctx context.Context) []string {
+	bookIDs, _ := ctx.Value(bookScopeContextKey{}).([]string)
+	return bookIDs
+}
+
+// scopeBookIDs keeps the requested books selected for the conversation, or all of them when none is requested.
+func scopeBookIDs(ctx context.Context, requested []string) []string {
+	scope := bookScopeFromContext(ctx)
+	if len(requested) == 0 {
+		return scope
+	}
+	return slices.DeleteFunc(slices.Clone(requested), func(id string) bool {
+		return !slices.Contains(scope, id)
+	})
+}
+
+func isInBookScope(ctx context.Context, bookID string) bool {
+	return slices.Contains(bookScopeFromContext(ctx), bookID)
+}
+
+// withBookFilters sets the metadata filters the searched books always match, completed by the ones of the model.
+func withBookFilters(ctx context.Context, filters map[string]string) context.Context {
+	return context.WithValue(ctx, bookFiltersContextKey{}, filters)
+}
+
+// bookFiltersFromContext returns a copy of the filters, never nil.
+func bookFiltersFromContext(ctx context.Context) map[string]string {
+	filters := make(map[string]string)
+	if scoped, ok := ctx.Value(bookFiltersContextKey{}).(map[string]string); ok {
+		maps.Copy(filters, scoped)
+	}
+	return filters
+}
+
+// mergeBookFilters completes the filters of the conversation with the requested ones.
+// The requested filters narrow the conversation ones, they can't override them.
+func mergeBookFilters(ctx context.Context, requested map[string]string) map[string]string {
+	filters := bookFiltersFromContext(ctx)
+	for key, value := range requested {
+		if _, scoped := filters[key]; !scoped {
+			filters[key] = value
+		}
+	}
+	return filters
+}
+
+// sourcesCollector gathers the documents read by the tools during a generation.
+type sourcesCollector struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	docs []*ai.Document
+}
+
+func newSourcesCollector() *sourcesCollector {
+	return &sourcesCollector{seen: make(map[string]struct{})}
+}
+
+func withSourcesCollector(ctx context.Context, sources *sourcesCollector) context.Context {
+	return context.WithValue(ctx, sourcesContextKey{}, sources)
+}
+
+func sourcesFromContext(ctx context.Context) *sourcesCollector {
+	sources, _ := ctx.Value(sourcesContextKey{}).(*sourcesCollector)
+	return sources
+}
+
+func (s *sourcesCollector) add(docs ...*ai.Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, doc := range docs {
+		id := metadataToString(doc.Metadata["id"])
+		if _, exists := s.seen[id]; exists {
+			continue
+		}
+		s.seen[id] = struct{}{}
+		s.docs = append(s.docs, doc)
+	}
+}
+
+func (s *sourcesCollector) documents() []*ai.Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.docs
+}
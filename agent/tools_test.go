@@ -0,0 +1,174 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+// titledChaptersStore holds the parts of a book by chapter index, along with the chapter titles.
+type titledChaptersStore struct {
+	domain.BookVectorStore
+	titles   []string
+	chapters map[int][]*ai.Document
+}
+
+func (s *titledChaptersStore) FindChapterIndex(ctx context.Context, book domain.Book, title string) (int, error) {
+	for i, t := range s.titles {
+		if strings.EqualFold(t, title) {
+			return i, nil
+		}
+	}
+	return 0, domain.ErrChapterNotFound
+}
+
+func (s *titledChaptersStore) ListChapterParts(ctx context.Context, book domain.Book, chapterIndex int) ([]*ai.Document, error) {
+	return s.chapters[chapterIndex], nil
+}
+
+type singleBookRepository struct {
+	domain.BookRepository
+	book domain.Book
+}
+
+func (r *singleBookRepository) GetByID(ctx context.Context, id string) (domain.Book, error) {
+	if id != r.book.ID {
+		return domain.Book{}, domain.ErrBookNotFound
+	}
+	return r.book, nil
+}
+
+func newTitledChaptersAgent(cfg Config, partsByChapter ...[]string) *Agent {
+	store := &titledChaptersStore{chapters: make(map[int][]*ai.Document)}
+	for i, parts := range partsByChapter {
+		title := fmt.Sprintf("Chapter %d", i+1)
+		store.titles = append(store.titles, title)
+		for j, part := range parts {
+			store.chapters[i] = append(store.chapters[i], ai.DocumentFromText(part, map[string]any{
+				"id":            uint(10*i + j),
+				"book_id":       uint(1),
+				"chapter_index": i,
+				"chapter_title": title,
+			}))
+		}
+	}
+	return &Agent{
+		cfg:             cfg,
+		bookRepository:  &singleBookRepository{book: domain.Book{ID: "1", Title: "My book"}},
+		bookVectorStore: store,
+	}
+}
+
+func Test_scopeBookIDs_ShouldKeepOnlyRequestedBooksOfTheConversation(t *testing.T) {
+	// Given
+	ctx := withBookScope(context.Background(), []string{"1", "2"})
+
+	// When
+	res := scopeBookIDs(ctx, []string{"2", "3"})
+
+	// Then
+	assert.Equal(t, []string{"2"}, res)
+}
+
+func Test_scopeBookIDs_ShouldReturnConversationBooksWhenNoneRequested(t *testing.T) {
+	// Given
+	ctx := withBookScope(context.Background(), []string{"1", "2"})
+
+	// When
+	res := scopeBookIDs(ctx, nil)
+
+	// Then
+	assert.Equal(t, []string{"1", "2"}, res)
+}
+
+func Test_scopeBookIDs_ShouldReturnNothingWithoutConversationBooks(t *testing.T) {
+	// Given
+	ctx := context.Background()
+
+	// When
+	res := scopeBookIDs(ctx, []string{"1"})
+
+	// Then
+	assert.Empty(t, res)
+}
+
+func Test_mergeBookFilters_ShouldNotOverrideConversationFilters(t *testing.T) {
+	// Given
+	ctx := withBookFilters(context.Background(), map[string]string{"language": "fr"})
+
+	// When
+	res := mergeBookFilters(ctx, map[string]string{"language": "en", "publisher": "O'Reilly"})
+
+	// Then
+	assert.Equal(t, map[string]string{"language": "fr", "publisher": "O'Reilly"}, res)
+}
+
+func Test_getChapterTool_ShouldFindChapterByTitle(t *testing.T) {
+	// Given
+	a := newTitledChaptersAgent(Config{}, []string{"first"}, []string{"second", "third"})
+	ctx := &ai.ToolContext{Context: withBookScope(context.Background(), []string{"1"})}
+
+	// When
+	res, err := a.getChapterTool(ctx, getChapterInput{BookID: "1", Title: "chapter 2"})
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, "second", res[0].Content)
+	assert.Equal(t, "third", res[1].Content)
+	assert.Equal(t, 1, res[0].ChapterIndex)
+}
+
+func Test_getChapterTool_ShouldPreferChapterIndexOverTitle(t *testing.T) {
+	// Given
+	a := newTitledChaptersAgent(Config{}, []string{"first"}, []string{"second"})
+	ctx := &ai.ToolContext{Context: withBookScope(context.Background(), []string{"1"})}
+	index := 0
+
+	// When
+	res, err := a.getChapterTool(ctx, getChapterInput{BookID: "1", Title: "Chapter 2", ChapterIndex: &index})
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, "first", res[0].Content)
+}
+
+func Test_getChapterTool_ShouldReturnNothingForUnknownTitle(t *testing.T) {
+	// Given
+	a := newTitledChaptersAgent(Config{}, []string{"first"})
+	ctx := &ai.ToolContext{Context: withBookScope(context.Background(), []string{"1"})}
+
+	// When
+	res, err := a.getChapterTool(ctx, getChapterInput{BookID: "1", Title: "Epilogue"})
+
+	// Then
+	require.NoError(t, err)
+	assert.Empty(t, res)
+}
+
+func Test_getChapterTool_ShouldTruncateChapterToToolOutputBudget(t *testing.T) {
+	// Given
+	cfg := Config{ContextWindow: 2000, ReservedOutputTokens: 400, CharsPerToken: 1}
+	long := strings.Repeat("a", 300)
+	a := newTitledChaptersAgent(cfg, []string{long, long, long})
+	sources := newSourcesCollector()
+	ctx := &ai.ToolContext{Context: withSourcesCollector(withBookScope(context.Background(), []string{"1"}), sources)}
+
+	// When
+	res, err := a.getChapterTool(ctx, getChapterInput{BookID: "1", Title: "Chapter 1"})
+
+	// Then
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, long, res[0].Content)
+	assert.True(t, strings.HasSuffix(res[1].Content, "…"))
+	assert.Less(t, len([]rune(res[1].Content)), 300)
+	assert.Len(t, sources.documents(), 2)
+}
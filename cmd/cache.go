@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cachePruneOlderThan time.Duration
+
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the embedding and chunk context caches",
+		Long: `The embedding cache holds the vectors of the chunks already embedded, keyed by embedding model and chunk content hash.
+It saves the embedding calls when a book is uploaded again or when an indexing run is retried.
+The chunk context cache holds the sentences generated to situate the chunks within their chapter, keyed by
+completion model and chunk and chapter content hash. It saves the completion calls of the situating chunk context.`,
+	}
+
+	cachePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Delete the cache entries not used for a while",
+		Run: func(cmd *cobra.Command, args []string) {
+			if cachePruneOlderThan <= 0 {
+				cmd.Println("The --older-than duration must be positive")
+				os.Exit(1)
+			}
+
+			unusedSince := time.Now().Add(-cachePruneOlderThan)
+			deleted, err := embeddingCache.Prune(cmd.Context(), unusedSince)
+			if err != nil {
+				cmd.Println("Error pruning the embedding cache:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%d embedding cache entries not used for %s deleted\n", deleted, cachePruneOlderThan)
+
+			deleted, err = chunkContextCache.Prune(cmd.Context(), unusedSince)
+			if err != nil {
+				cmd.Println("Error pruning the chunk context cache:", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%d chunk context cache entries not used for %s deleted\n", deleted, cachePruneOlderThan)
+		},
+	}
+)
+
+func init() {
+	cachePruneCmd.Flags().DurationVar(&cachePruneOlderThan, "older-than", 30*24*time.Hour,
+		"Delete the entries not used for this duration, e.g. 720h.")
+
+	cacheCmd.AddCommand(cachePruneCmd)
+}
@@ -15,6 +15,8 @@ import (
 var (
 	controllerType string
 	sessionID      string
+	bookIDs        []string
+	bookFilters    map[string]string
 
 	chatCmd = &cobra.Command{
 		Use:   "chat",
@@ -29,12 +31,11 @@ var (
 			}
 
 			agentConfig.SessionID = viper.GetString("session")
-			agentConfig.SessionMessageLimit = 6 // TODO: is this still necessary?
 
 			var ctrl controller.Controller
 			switch ctrlType {
 			case controller.CtrlTypeCmdLine:
-				ctrl = cmdline.New(agentConfig, mainAgent.Flow())
+				ctrl = cmdline.New(agentConfig, mainAgent.Flow(), bookRepository, bookIDs, bookFilters)
 			case controller.CtrlTypeHTTP:
 				ctrl = server.New(
 					agentConfig,
@@ -44,6 +45,7 @@ var (
 					mainAgent.G(),
 					bookRepository,
 					fileRepository,
+					bookLoaders,
 				)
 			default:
 				cmd.Println("unsupported controller type: %s", controllerType)
@@ -64,4 +66,11 @@ func init() {
 
 	chatCmd.Flags().StringVarP(&sessionID, "session", "S", "",
 		"Session ID to use for the chat session. If not provided, a new session will be created.")
+
+	chatCmd.Flags().StringSliceVarP(&bookIDs, "books", "b", nil,
+		"IDs of the books to chat about (cmd interface only). They can be changed during the session with the /use command.")
+
+	chatCmd.Flags().StringToStringVarP(&bookFilters, "filter", "f", nil,
+		"Metadata the searched books must match, e.g. language=en,publisher=O'Reilly (cmd interface only). "+
+			"They can be changed during the session with the /filter command.")
 }
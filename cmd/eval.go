@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/thomas-marquis/goLLMan/agent"
+)
+
+var (
+	evalDatasetPath   string
+	evalOutputDir     string
+	evalK             int
+	evalJudgeModel    string
+	evalBookIDs       []string
+	evalRetrievalOnly bool
+
+	evalCmd = &cobra.Command{
+		Use:   "eval",
+		Short: "Evaluate the retrieval and the answers on a dataset",
+		Long: `Eval command runs the questions of a dataset through the retriever and the chatbot flow.
+
+The dataset is a YAML file with a "cases" list, or a JSONL file with one case per line.
+Each case has a question, the expected book (ID or title) and optionally the expected passage and a reference answer.
+The retrieval is measured with hit@k and MRR, the answers are graded by a judge model for faithfulness and relevance.
+The results are written as report.json and report.md in the output directory, ready to be diffed between runs.
+`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cases, err := agent.LoadEvalDataset(evalDatasetPath)
+			if err != nil {
+				cmd.Println("Error loading the dataset:", err)
+				os.Exit(1)
+			}
+
+			report, err := mainAgent.Evaluate(cmd.Context(), cases, agent.EvalOptions{
+				K:             evalK,
+				BookIDs:       evalBookIDs,
+				JudgeModel:    evalJudgeModel,
+				RetrievalOnly: evalRetrievalOnly,
+			})
+			if err != nil {
+				cmd.Println("Error running the evaluation:", err)
+				os.Exit(1)
+			}
+
+			if err := agent.WriteEvalReport(evalOutputDir, report); err != nil {
+				cmd.Println("Error writing the report:", err)
+				os.Exit(1)
+			}
+
+			s := report.Summary
+			fmt.Printf("%d cases, %d errors: hit@%d=%.3f MRR=%.3f", s.Cases, s.Errors, report.Settings.K, s.HitAtK, s.MRR)
+			if s.Graded > 0 {
+				fmt.Printf(" faithfulness=%.2f relevance=%.2f", s.Faithfulness, s.Relevance)
+			}
+			fmt.Printf("\nReport written to %s\n", evalOutputDir)
+		},
+	}
+)
+
+func init() {
+	evalCmd.Flags().StringVarP(&evalDatasetPath, "dataset", "d", "",
+		"Path of the dataset, a .yaml, .yml or .jsonl file.")
+	evalCmd.MarkFlagRequired("dataset")
+
+	evalCmd.Flags().StringVarP(&evalOutputDir, "out", "o", "eval-results",
+		"Directory the report.json and report.md files are written to.")
+
+	evalCmd.Flags().IntVarP(&evalK, "k", "k", 0,
+		"Number of retrieved chunks hit@k and MRR are computed on. Defaults to the retrieval limit.")
+
+	evalCmd.Flags().StringVar(&evalJudgeModel, "judge-model", "",
+		"Model grading the answers, as <provider>/<model>. Defaults to the completion model.")
+
+	evalCmd.Flags().StringSliceVarP(&evalBookIDs, "books", "b", nil,
+		"IDs of the books to retrieve from. Defaults to all the indexed books.")
+
+	evalCmd.Flags().BoolVar(&evalRetrievalOnly, "retrieval-only", false,
+		"Only measure the retrieval, without generating nor grading the answers.")
+}
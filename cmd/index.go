@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 )
 
 // indexCmd represents the index command
 var (
+	indexOutdatedReindex bool
+
 	indexCmd = &cobra.Command{
 		Use:   "index",
 		Short: "Index documents",
@@ -24,6 +29,46 @@ The indexing doesn't reindex existing documents.
 			}
 		},
 	}
+
+	indexOutdatedCmd = &cobra.Command{
+		Use:   "outdated",
+		Short: "List the books indexed with another splitter configuration",
+		Long: `The chunks of a book follow the splitter configuration (agent.splitter) it was indexed with.
+This command lists the indexed books whose chunks were split with another configuration than the current one,
+or before the configuration was recorded. They need to be indexed again to follow the current configuration.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			books, err := mainAgent.OutdatedBooks(cmd.Context())
+			if err != nil {
+				cmd.Println("Error listing the outdated books:", err)
+				os.Exit(1)
+			}
+			if len(books) == 0 {
+				fmt.Println("All the indexed books follow the current splitter configuration")
+				return
+			}
+
+			for _, book := range books {
+				fmt.Printf("%s\t%s\t%s\n", book.ID, book.Title, book.Author)
+			}
+			if !indexOutdatedReindex {
+				fmt.Printf("%d books to index again, run with --reindex to do it\n", len(books))
+				return
+			}
+
+			for _, book := range books {
+				fmt.Printf("Indexing %s again...\n", book.Title)
+				if _, err := mainAgent.IndexFlow().Run(cmd.Context(), book); err != nil {
+					cmd.Printf("Error indexing %s: %s\n", book.Title, err)
+					os.Exit(1)
+				}
+			}
+		},
+	}
 )
 
-func init() {}
+func init() {
+	indexOutdatedCmd.Flags().BoolVar(&indexOutdatedReindex, "reindex", false,
+		"Index the outdated books again with the current splitter configuration.")
+
+	indexCmd.AddCommand(indexOutdatedCmd)
+}
@@ -3,15 +3,18 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"sort"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/thomas-marquis/goLLMan/agent"
 	"github.com/thomas-marquis/goLLMan/agent/loader"
+	"github.com/thomas-marquis/goLLMan/agent/provider"
 	"github.com/thomas-marquis/goLLMan/agent/session"
 	"github.com/thomas-marquis/goLLMan/agent/session/in_memory"
 	"github.com/thomas-marquis/goLLMan/internal/domain"
 	"github.com/thomas-marquis/goLLMan/internal/infrastructure"
+	"github.com/thomas-marquis/goLLMan/internal/infrastructure/orm"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -20,6 +23,9 @@ const (
 	defaultCompletionModel = "mistral/mistral-small"
 	defaultEmbeddingModel  = "mistral/mistral-embed"
 
+	// defaultSessionMessageLimit caps the messages kept in a session, the token budget then picks the ones sent.
+	defaultSessionMessageLimit = 50
+
 	defaultLocalFileStorePath = "tmp"
 )
 
@@ -29,11 +35,14 @@ var (
 
 	db *gorm.DB
 
-	mainAgent       *agent.Agent
-	sessionStore    session.Store
-	bookRepository  domain.BookRepository
-	bookVectorStore domain.BookVectorStore
-	fileRepository  domain.FileRepository
+	mainAgent         *agent.Agent
+	sessionStore      session.Store
+	bookRepository    domain.BookRepository
+	bookVectorStore   domain.BookVectorStore
+	fileRepository    domain.FileRepository
+	embeddingCache    domain.EmbeddingCache
+	chunkContextCache domain.ChunkContextCache
+	bookLoaders       *loader.Registry
 
 	rootCmd = &cobra.Command{
 		Use:   "goLLMan",
@@ -69,14 +78,30 @@ func init() {
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "enable verbose output")
 	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
 
+	viper.SetDefault("agent.chatMode", agent.ChatModeRAG)
+	viper.SetDefault("agent.sessionMessageLimit", defaultSessionMessageLimit)
+	viper.SetDefault("agent.memory.strategy", agent.MemoryStrategyTrim)
+	viper.SetDefault("agent.maxSteps", 5)
+	viper.SetDefault("agent.indexing.workers", 4)
+	viper.SetDefault("agent.splitter.strategy", agent.SplitterMarkdown)
+	viper.SetDefault("agent.splitter.chunkSize", 1000)
+	viper.SetDefault("agent.splitter.chunkOverlap", 100)
+	viper.SetDefault("agent.splitter.headingContext", true)
 	viper.SetDefault("agent.retrievalLimit", 6)
+	viper.SetDefault("agent.queryRewriteHistory", 4)
+	viper.SetDefault("agent.retrievalMode", string(domain.RetrievalModeVector))
+	viper.SetDefault("agent.hybrid.vectorWeight", 1.0)
+	viper.SetDefault("agent.hybrid.lexicalWeight", 1.0)
 	viper.SetDefault("agent.completionModel", defaultCompletionModel)
 	viper.SetDefault("agent.embeddingModel", defaultEmbeddingModel)
+	viper.SetDefault("agent.promptDir", agent.DefaultPromptDir)
 	viper.SetDefault("fileStore.local.path", defaultLocalFileStorePath)
 
 	rootCmd.AddCommand(chatCmd)
 	rootCmd.AddCommand(indexCmd)
 	rootCmd.AddCommand(genkitCmd)
+	rootCmd.AddCommand(evalCmd)
+	rootCmd.AddCommand(cacheCmd)
 }
 
 func initConfig() {
@@ -108,24 +133,93 @@ func initConfig() {
 	bookRepository = bookRepoImpl
 
 	agentConfig = agent.Config{
-		SessionID:                   viper.GetString("session"),
-		Verbose:                     viper.GetBool("verbose"),
-		SessionMessageLimit:         viper.GetInt("agent.sessionMessageLimit"),
-		RetrievalLimit:              viper.GetInt("agent.retrievalLimit"),
-		MistralApiKey:               viper.GetString("mistral.apiKey"),
-		MistralTimeout:              viper.GetDuration("mistral.timeout"),
-		MistralMaxRequestsPerSecond: viper.GetInt("mistral.maxReqPerSec"),
-		CompletionModel:             viper.GetString("agent.completionModel"),
-		EmbeddingModel:              viper.GetString("agent.embeddingModel"),
+		SessionID:            viper.GetString("session"),
+		Verbose:              viper.GetBool("verbose"),
+		SessionMessageLimit:  viper.GetInt("agent.sessionMessageLimit"),
+		MemoryStrategy:       viper.GetString("agent.memory.strategy"),
+		SummaryModel:         viper.GetString("agent.memory.model"),
+		ContextWindow:        viper.GetInt("agent.budget.contextWindow"),
+		ReservedOutputTokens: viper.GetInt("agent.budget.reservedOutputTokens"),
+		HistoryBudgetShare:   viper.GetFloat64("agent.budget.historyShare"),
+		CharsPerToken:        viper.GetFloat64("agent.budget.charsPerToken"),
+		ChatMode:             viper.GetString("agent.chatMode"),
+		AgentMaxSteps:        viper.GetInt("agent.maxSteps"),
+		EmbeddingVectorSize:  orm.EmbeddingVectorSize,
+		IndexingWorkers:      viper.GetInt("agent.indexing.workers"),
+		Splitter: agent.SplitterConfig{
+			Strategy:       viper.GetString("agent.splitter.strategy"),
+			ChunkSize:      viper.GetInt("agent.splitter.chunkSize"),
+			ChunkOverlap:   viper.GetInt("agent.splitter.chunkOverlap"),
+			HeadingContext: viper.GetBool("agent.splitter.headingContext"),
+		},
+		ChunkContext: agent.ChunkContextConfig{
+			Enabled: viper.GetBool("agent.chunkContext.enabled"),
+			Situate: viper.GetBool("agent.chunkContext.situate"),
+			Model:   viper.GetString("agent.chunkContext.model"),
+		},
+		RetrievalLimit:      viper.GetInt("agent.retrievalLimit"),
+		NeighborChunks:      viper.GetInt("agent.neighborChunks"),
+		QueryRewriteHistory: viper.GetInt("agent.queryRewriteHistory"),
+		RetrievalMode:       viper.GetString("agent.retrievalMode"),
+		HybridVectorWeight:  viper.GetFloat64("agent.hybrid.vectorWeight"),
+		HybridLexicalWeight: viper.GetFloat64("agent.hybrid.lexicalWeight"),
+		RerankerModel:       viper.GetString("agent.reranker.model"),
+		RerankCandidates:    viper.GetInt("agent.reranker.candidates"),
+		Providers:           providersConfig(viper.GetBool("verbose")),
+		CompletionModel:     viper.GetString("agent.completionModel"),
+		EmbeddingModel:      viper.GetString("agent.embeddingModel"),
+		PromptDir:           viper.GetString("agent.promptDir"),
 	}
 
-	docLoader := loader.NewLocalEpubLoader(bookRepository)
+	bookLoaders = loader.NewDefaultRegistry(bookRepository)
 
 	sessionStore = in_memory.NewSessionStore()
 
 	fileRepository = infrastructure.NewFileLocalStore(viper.GetString("fileStore.local.path"))
 
-	mainAgent = agent.New(agentConfig, sessionStore, docLoader, bookRepository, bookVectorStore, fileRepository)
+	embeddingCache = infrastructure.NewEmbeddingCachePostgres(db)
+	chunkContextCache = infrastructure.NewChunkContextCachePostgres(db)
+
+	mainAgent = agent.New(agentConfig, sessionStore, bookLoaders, bookRepository, bookVectorStore, fileRepository,
+		agent.WithEmbeddingCache(embeddingCache),
+		agent.WithChunkContextCache(chunkContextCache))
+}
+
+// providersConfig reads the model providers from the providers section, keyed by provider name.
+// The former top level mistral section is used when there is none.
+func providersConfig(verbose bool) []provider.Config {
+	names := make([]string, 0)
+	for name := range viper.GetStringMap("providers") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return []provider.Config{{
+			Name:                 provider.TypeMistral,
+			APIKey:               viper.GetString("mistral.apiKey"),
+			Timeout:              viper.GetDuration("mistral.timeout"),
+			MaxRequestsPerSecond: viper.GetInt("mistral.maxReqPerSec"),
+			Verbose:              verbose,
+		}}
+	}
+
+	cfgs := make([]provider.Config, 0, len(names))
+	for _, name := range names {
+		key := "providers." + name + "."
+		cfgs = append(cfgs, provider.Config{
+			Name:                 name,
+			Type:                 viper.GetString(key + "type"),
+			BaseURL:              viper.GetString(key + "baseUrl"),
+			APIKey:               viper.GetString(key + "apiKey"),
+			Timeout:              viper.GetDuration(key + "timeout"),
+			MaxRequestsPerSecond: viper.GetInt(key + "maxReqPerSec"),
+			Verbose:              verbose,
+			Dimension:            viper.GetInt(key + "dimension"),
+			FixturesPath:         viper.GetString(key + "fixtures"),
+		})
+	}
+	return cfgs
 }
 
 func initPgGormDB(cfg pgConfig) (*gorm.DB, error) {
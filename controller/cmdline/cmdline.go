@@ -6,19 +6,36 @@ import (
 	"fmt"
 	"github.com/thomas-marquis/goLLMan/agent"
 	"github.com/thomas-marquis/goLLMan/agent/session"
+	"github.com/thomas-marquis/goLLMan/internal/domain"
 	"os"
+	"slices"
 	"strings"
 
 	genkit_core "github.com/firebase/genkit/go/core"
 )
 
 type cmdLineController struct {
-	flow *genkit_core.Flow[agent.ChatbotInput, string, struct{}]
-	cfg  agent.Config
+	flow           *genkit_core.Flow[agent.ChatbotInput, agent.ChatbotOutput, string]
+	cfg            agent.Config
+	bookRepository domain.BookRepository
+	bookIDs        []string
+	filters        map[string]string
 }
 
-func New(cfg agent.Config, flow *genkit_core.Flow[agent.ChatbotInput, string, struct{}]) *cmdLineController {
-	return &cmdLineController{flow, cfg}
+func New(
+	cfg agent.Config,
+	flow *genkit_core.Flow[agent.ChatbotInput, agent.ChatbotOutput, string],
+	bookRepository domain.BookRepository,
+	bookIDs []string,
+	filters map[string]string,
+) *cmdLineController {
+	return &cmdLineController{
+		flow:           flow,
+		cfg:            cfg,
+		bookRepository: bookRepository,
+		bookIDs:        bookIDs,
+		filters:        filters,
+	}
 }
 
 func (c *cmdLineController) Run() error {
@@ -32,6 +49,8 @@ func (c *cmdLineController) Run() error {
 	}
 
 	fmt.Println("Enter a command (or 'exit' or 'quit' to quit):")
+	fmt.Println("Type '/books' to list the books and '/use <id> [<id>...]' to chat about some of them.")
+	fmt.Println("Type '/filter <key>=<value>[, <key>=<value>...]' to search only the books with those metadata, '/filter' to search them all.")
 	for {
 		ctx = context.Background()
 		fmt.Println("\n## User:")
@@ -46,12 +65,110 @@ func (c *cmdLineController) Run() error {
 			break
 		}
 
+		if strings.HasPrefix(input, "/") {
+			if err := c.runCommand(ctx, input); err != nil {
+				fmt.Println("Error:", err)
+			}
+			continue
+		}
+
 		fmt.Println("## AI:")
-		result, err := c.flow.Run(ctx, agent.ChatbotInput{Question: input, Session: sessionID})
+		in := agent.ChatbotInput{
+			Question: input,
+			Session:  sessionID,
+			BookIDs:  c.bookIDs,
+			Filters:  c.filters,
+		}
+		var streamed strings.Builder
+		for res, err := range c.flow.Stream(ctx, in) {
+			if err != nil {
+				return fmt.Errorf("Failed to generate response from flow: %v", err)
+			}
+			if res.Done {
+				// Models that do not support streaming only send the final output
+				if streamed.Len() == 0 {
+					fmt.Print(res.Output.Answer)
+				}
+				fmt.Println()
+				printCitations(res.Output.SearchQuery, res.Output.Citations)
+				break
+			}
+			fmt.Print(res.Stream)
+			streamed.WriteString(res.Stream)
+		}
+	}
+	return nil
+}
+
+func printCitations(searchQuery string, citations []domain.Citation) {
+	if len(citations) == 0 {
+		return
+	}
+
+	fmt.Println("\n### Sources:")
+	if searchQuery != "" {
+		fmt.Printf("Searched for: %s\n", searchQuery)
+	}
+	for i, cit := range citations {
+		ref := cit.BookTitle
+		if cit.ChapterTitle != "" {
+			ref += " - " + cit.ChapterTitle
+		}
+		if len(cit.HeadingPath) > 0 {
+			ref += " - " + strings.Join(cit.HeadingPath, " > ")
+		}
+		fmt.Printf("[%d] %s (chunk %s)\n    > %s\n", i+1, ref, cit.ChunkID, cit.Excerpt)
+	}
+}
+
+// runCommand handles the commands managing the books the conversation is scoped to.
+func (c *cmdLineController) runCommand(ctx context.Context, input string) error {
+	fields := strings.Fields(input)
+	switch fields[0] {
+	case "/books":
+		books, err := c.bookRepository.List(ctx)
 		if err != nil {
-			return fmt.Errorf("Failed to generate response from flow: %v", err)
+			return fmt.Errorf("failed to list books: %w", err)
+		}
+		for _, book := range books {
+			mark := " "
+			if slices.Contains(c.bookIDs, book.ID) {
+				mark = "x"
+			}
+			fmt.Printf("[%s] %s: %s (%s) - %s\n", mark, book.ID, book.Title, book.Author, book.Status)
 		}
-		fmt.Println(strings.TrimSuffix(result, "\n"))
+	case "/use":
+		c.bookIDs = fields[1:]
+		fmt.Printf("Conversation scoped to books: %s\n", strings.Join(c.bookIDs, ", "))
+	case "/filter":
+		filters, err := parseFilters(strings.TrimPrefix(strings.TrimSpace(input), "/filter"))
+		if err != nil {
+			return err
+		}
+		c.filters = filters
+		if len(filters) == 0 {
+			fmt.Println("Searching all the books")
+			break
+		}
+		fmt.Printf("Searching the books matching: %v\n", filters)
+	default:
+		return fmt.Errorf("unknown command %s", fields[0])
 	}
 	return nil
 }
+
+// parseFilters reads the metadata filters written as key=value and separated by commas.
+func parseFilters(text string) (map[string]string, error) {
+	filters := make(map[string]string)
+	for _, arg := range strings.Split(text, ",") {
+		if strings.TrimSpace(arg) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid filter %s, expected key=value", arg)
+		}
+		filters[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return filters, nil
+}
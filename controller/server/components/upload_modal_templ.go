@@ -8,7 +8,9 @@ package components
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
-func UploadEpubModal() templ.Component {
+import "strings"
+
+func UploadEpubModal(extensions []string) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -29,7 +31,33 @@ func UploadEpubModal() templ.Component {
 			templ_7745c5c3_Var1 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div id=\"upload-epub-modal\" hx-swap-oob=\"true\" class=\"fixed inset-0 bg-black bg-opacity-50 z-50 flex items-center justify-center p-4\" x-data=\"{\n\t\t\tdragover: false,\n\t\t\tfile: null,\n\t\t\thandleDrop(event) {\n\t\t\t\tevent.preventDefault();\n\t\t\t\tthis.dragover = false;\n\t\t\t\tif (!event.dataTransfer.files.length) return;\n\n\t\t\t\tconst droppedFile = event.dataTransfer.files[0];\n\t\t\t\tif (droppedFile && droppedFile.name.endsWith('.epub')) {\n\t\t\t\t\tthis.file = droppedFile;\n\n\t\t\t\t\t// Update the UI to display the dropped file\n\t\t\t\t\tconst fileInput = document.getElementById('epub-file');\n\t\t\t\t\tfileInput.files = event.dataTransfer.files;\n\n\t\t\t\t\t// Display the file name in the UI\n\t\t\t\t\tconst fileNameElement = document.getElementById('selected-file-name');\n\t\t\t\t\tfileNameElement.textContent = droppedFile.name;\n\t\t\t\t\tdocument.getElementById('file-name').classList.remove('hidden');\n\t\t\t\t}\n\t\t\t},\n\t\t\thandleFileSelect(event) {\n\t\t\t\tif (!event.target.files.length) return;\n\n\t\t\t\tconst selectedFile = event.target.files[0];\n\t\t\t\tif (selectedFile && selectedFile.name.endsWith('.epub')) {\n\t\t\t\t\tthis.file = selectedFile;\n\n\t\t\t\t\t// Display the file name in the UI\n\t\t\t\t\tconst fileNameElement = document.getElementById('selected-file-name');\n\t\t\t\t\tfileNameElement.textContent = selectedFile.name;\n\t\t\t\t\tdocument.getElementById('file-name').classList.remove('hidden');\n\t\t\t\t}\n\t\t\t}\n\t\t}\" :class=\"{ '*:cursor-alias': dragover }\" @dragover.prevent=\"dragover = true\" @dragleave.prevent=\"dragover = false\" @drop.prevent=\"handleDrop\"><div class=\"bg-white dark:bg-gray-800 rounded-lg shadow-xl max-w-md w-full p-6\"><div class=\"flex justify-between items-center mb-4\"><h3 class=\"text-lg font-semibold text-gray-900 dark:text-white\">Upload EPUB Book</h3><button type=\"button\" class=\"text-gray-400 hover:text-gray-500 dark:hover:text-gray-300\" hx-get=\"/books/upload/cancel\" hx-swap=\"none\"><svg xmlns=\"http://www.w3.org/2000/svg\" class=\"h-6 w-6\" fill=\"none\" viewBox=\"0 0 24 24\" stroke=\"currentColor\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" stroke-width=\"2\" d=\"M6 18L18 6M6 6l12 12\"></path></svg></button></div><form id=\"form-upload\" class=\"space-y-4\" hx-encoding=\"multipart/form-data\" hx-post=\"/books/upload\" hx-swap=\"none\"><div class=\"border-2 border-dashed border-gray-300 dark:border-gray-600 rounded-lg p-6 text-center\" :class=\"{ 'bg-blue-50 dark:bg-gray-700': dragover }\"><label for=\"epub-file\" class=\"cursor-pointer\"><div x-show=\"!file\"><svg xmlns=\"http://www.w3.org/2000/svg\" class=\"mx-auto h-12 w-12 text-gray-400\" fill=\"none\" viewBox=\"0 0 24 24\" stroke=\"currentColor\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" stroke-width=\"2\" d=\"M7 16a4 4 0 01-.88-7.903A5 5 0 1115.9 6L16 6a5 5 0 011 9.9M15 13l-3-3m0 0l-3 3m3-3v12\"></path></svg></div><div x-show=\"file\"><svg xmlns=\"http://www.w3.org/2000/svg\" class=\"mx-auto h-12 w-12 text-gray-400\" fill=\"none\" viewBox=\"0 0 24 24\" stroke=\"currentColor\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" stroke-width=\"2\" d=\"M9 12h6m-6 4h6m2 5H7a2 2 0 01-2-2V5a2 2 0 012-2h5.586a1 1 0 01.707.293l5.414 5.414a1 1 0 01.293.707V19a2 2 0 01-2 2z\"></path></svg></div><p class=\"mt-2 text-sm text-gray-600 dark:text-gray-400\">Click to select or drag and drop</p><p class=\"text-xs text-gray-500 dark:text-gray-500\">EPUB files only</p><input id=\"epub-file\" name=\"epub-file\" type=\"file\" accept=\".epub\" class=\"hidden\" required @change=\"handleFileSelect\"></label></div><div id=\"file-name\" class=\"text-sm text-gray-600 dark:text-gray-400 hidden\"><span>Selected file: </span> <span id=\"selected-file-name\"></span></div><div class=\"flex justify-end space-x-3\"><button type=\"button\" class=\"px-4 py-2 bg-gray-200 text-gray-800 rounded-lg hover:bg-gray-300 dark:bg-gray-700 dark:text-white dark:hover:bg-gray-600 transition-colors\" hx-get=\"/books/upload/cancel\">Cancel</button> <button type=\"submit\" class=\"px-4 py-2 bg-primary-500 text-white rounded-lg hover:bg-primary-400 transition-colors\">Upload</button></div></form></div></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div id=\"upload-epub-modal\" hx-swap-oob=\"true\" class=\"fixed inset-0 bg-black bg-opacity-50 z-50 flex items-center justify-center p-4\" x-data=\"{\n\t\t\tdragover: false,\n\t\t\tfile: null,\n\t\t\tisBook(name) {\n\t\t\t\tconst extensions = document.getElementById('epub-file').accept.split(',');\n\t\t\t\treturn extensions.some(ext => name.toLowerCase().endsWith(ext));\n\t\t\t},\n\t\t\thandleDrop(event) {\n\t\t\t\tevent.preventDefault();\n\t\t\t\tthis.dragover = false;\n\t\t\t\tif (!event.dataTransfer.files.length) return;\n\n\t\t\t\tconst droppedFile = event.dataTransfer.files[0];\n\t\t\t\tif (droppedFile && this.isBook(droppedFile.name)) {\n\t\t\t\t\tthis.file = droppedFile;\n\n\t\t\t\t\t// Update the UI to display the dropped file\n\t\t\t\t\tconst fileInput = document.getElementById('epub-file');\n\t\t\t\t\tfileInput.files = event.dataTransfer.files;\n\n\t\t\t\t\t// Display the file name in the UI\n\t\t\t\t\tconst fileNameElement = document.getElementById('selected-file-name');\n\t\t\t\t\tfileNameElement.textContent = droppedFile.name;\n\t\t\t\t\tdocument.getElementById('file-name').classList.remove('hidden');\n\t\t\t\t}\n\t\t\t},\n\t\t\thandleFileSelect(event) {\n\t\t\t\tif (!event.target.files.length) return;\n\n\t\t\t\tconst selectedFile = event.target.files[0];\n\t\t\t\tif (selectedFile && this.isBook(selectedFile.name)) {\n\t\t\t\t\tthis.file = selectedFile;\n\n\t\t\t\t\t// Display the file name in the UI\n\t\t\t\t\tconst fileNameElement = document.getElementById('selected-file-name');\n\t\t\t\t\tfileNameElement.textContent = selectedFile.name;\n\t\t\t\t\tdocument.getElementById('file-name').classList.remove('hidden');\n\t\t\t\t}\n\t\t\t}\n\t\t}\" :class=\"{ '*:cursor-alias': dragover }\" @dragover.prevent=\"dragover = true\" @dragleave.prevent=\"dragover = false\" @drop.prevent=\"handleDrop\"><div class=\"bg-white dark:bg-gray-800 rounded-lg shadow-xl max-w-md w-full p-6\"><div class=\"flex justify-between items-center mb-4\"><h3 class=\"text-lg font-semibold text-gray-900 dark:text-white\">Upload a Book</h3><button type=\"button\" class=\"text-gray-400 hover:text-gray-500 dark:hover:text-gray-300\" hx-get=\"/books/upload/cancel\" hx-swap=\"none\"><svg xmlns=\"http://www.w3.org/2000/svg\" class=\"h-6 w-6\" fill=\"none\" viewBox=\"0 0 24 24\" stroke=\"currentColor\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" stroke-width=\"2\" d=\"M6 18L18 6M6 6l12 12\"></path></svg></button></div><form id=\"form-upload\" class=\"space-y-4\" hx-encoding=\"multipart/form-data\" hx-post=\"/books/upload\" hx-swap=\"none\"><div class=\"border-2 border-dashed border-gray-300 dark:border-gray-600 rounded-lg p-6 text-center\" :class=\"{ 'bg-blue-50 dark:bg-gray-700': dragover }\"><label for=\"epub-file\" class=\"cursor-pointer\"><div x-show=\"!file\"><svg xmlns=\"http://www.w3.org/2000/svg\" class=\"mx-auto h-12 w-12 text-gray-400\" fill=\"none\" viewBox=\"0 0 24 24\" stroke=\"currentColor\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" stroke-width=\"2\" d=\"M7 16a4 4 0 01-.88-7.903A5 5 0 1115.9 6L16 6a5 5 0 011 9.9M15 13l-3-3m0 0l-3 3m3-3v12\"></path></svg></div><div x-show=\"file\"><svg xmlns=\"http://www.w3.org/2000/svg\" class=\"mx-auto h-12 w-12 text-gray-400\" fill=\"none\" viewBox=\"0 0 24 24\" stroke=\"currentColor\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" stroke-width=\"2\" d=\"M9 12h6m-6 4h6m2 5H7a2 2 0 01-2-2V5a2 2 0 012-2h5.586a1 1 0 01.707.293l5.414 5.414a1 1 0 01.293.707V19a2 2 0 01-2 2z\"></path></svg></div><p class=\"mt-2 text-sm text-gray-600 dark:text-gray-400\">Click to select or drag and drop</p><p class=\"text-xs text-gray-500 dark:text-gray-500\">")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var2 string
+		templ_7745c5c3_Var2, templ_7745c5c3_Err = templ.JoinStringErrs(strings.Join(extensions, ", "))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `controller/server/components/upload_modal.templ`, Line: 92, Col: 90}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var2))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " files</p><input id=\"epub-file\" name=\"epub-file\" type=\"file\" accept=\"")
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		var templ_7745c5c3_Var3 string
+		templ_7745c5c3_Var3, templ_7745c5c3_Err = templ.JoinStringErrs(strings.Join(extensions, ","))
+		if templ_7745c5c3_Err != nil {
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `controller/server/components/upload_modal.templ`, Line: 97, Col: 45}
+		}
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var3))
+		if templ_7745c5c3_Err != nil {
+			return templ_7745c5c3_Err
+		}
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "\" class=\"hidden\" required @change=\"handleFileSelect\"></label></div><div id=\"file-name\" class=\"text-sm text-gray-600 dark:text-gray-400 hidden\"><span>Selected file: </span> <span id=\"selected-file-name\"></span></div><div class=\"flex justify-end space-x-3\"><button type=\"button\" class=\"px-4 py-2 bg-gray-200 text-gray-800 rounded-lg hover:bg-gray-300 dark:bg-gray-700 dark:text-white dark:hover:bg-gray-600 transition-colors\" hx-get=\"/books/upload/cancel\">Cancel</button> <button type=\"submit\" class=\"px-4 py-2 bg-primary-500 text-white rounded-lg hover:bg-primary-400 transition-colors\">Upload</button></div></form></div></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
@@ -53,12 +81,12 @@ func UploadEpubModalOff() templ.Component {
 			}()
 		}
 		ctx = templ.InitializeContext(ctx)
-		templ_7745c5c3_Var2 := templ.GetChildren(ctx)
-		if templ_7745c5c3_Var2 == nil {
-			templ_7745c5c3_Var2 = templ.NopComponent
+		templ_7745c5c3_Var4 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var4 == nil {
+			templ_7745c5c3_Var4 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<div id=\"upload-epub-modal\" hx-swap-oob=\"true\"></div>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<div id=\"upload-epub-modal\" hx-swap-oob=\"true\"></div>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
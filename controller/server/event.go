@@ -1,60 +1,125 @@
 package server
 
 import (
+	"sync"
+
 	"github.com/firebase/genkit/go/ai"
 	"github.com/thomas-marquis/goLLMan/agent/session"
 	"github.com/thomas-marquis/goLLMan/pkg"
 )
 
+const (
+	// partialMessageKey flags in its metadata a message holding an answer still being streamed
+	partialMessageKey = "partial"
+	// errorMessageKey flags in its metadata a message ending an answer whose generation failed
+	errorMessageKey = "error"
+)
+
 // TODO: this type cloud be owned by the agentic layer
 type messagesChan chan *ai.Message
 
+func newPartialMessage(text string) *ai.Message {
+	return ai.NewMessage(ai.RoleModel, map[string]any{partialMessageKey: true}, pkg.ContentFromText(text)...)
+}
+
+func isPartialMessage(msg *ai.Message) bool {
+	partial, ok := msg.Metadata[partialMessageKey].(bool)
+	return ok && partial
+}
+
+func newErrorMessage(text string) *ai.Message {
+	return ai.NewMessage(ai.RoleModel, map[string]any{errorMessageKey: true}, pkg.ContentFromText(text)...)
+}
+
+func isErrorMessage(msg *ai.Message) bool {
+	failed, ok := msg.Metadata[errorMessageKey].(bool)
+	return ok && failed
+}
+
+// streamClient is a client connection, listening to the messages of a single session
+type streamClient struct {
+	sessionID string
+	messages  messagesChan
+}
+
+// sessionMessage is a message to send to the clients of a session
+type sessionMessage struct {
+	sessionID string
+	message   *ai.Message
+}
+
 type eventStream struct {
 	// Events are pushed to this channel by the main events-gathering routine
 	MessageBySessionID map[string]messagesChan
+	// attachMu guards MessageBySessionID, sessions being attached by concurrent requests
+	attachMu sync.Mutex
+
+	// Messages to send to the clients of a session. They are dispatched by the listen routine,
+	// the only one accessing TotalClients.
+	Messages chan sessionMessage
 
 	// New client connections
-	NewClients chan messagesChan
+	NewClients chan streamClient
 
 	// Closed client connections
 	ClosedClients chan messagesChan
 
-	// Total client connections
-	TotalClients map[messagesChan]struct{}
+	// Total client connections, with the ID of the session they listen to
+	TotalClients map[messagesChan]string
 }
 
 func (s *eventStream) AttachSession(sess *session.Session) {
+	s.attachMu.Lock()
+	defer s.attachMu.Unlock()
 	if _, exists := s.MessageBySessionID[sess.ID()]; exists {
 		pkg.Logger.Printf("Session %s already attached, skipping", sess.ID())
 		return
 	}
-	s.MessageBySessionID[sess.ID()] = sess.ListenMessages()
+	sessionMessages := sess.ListenMessages()
+	s.MessageBySessionID[sess.ID()] = sessionMessages
 
 	go func() {
-		for {
-			select {
-			case msg := <-s.MessageBySessionID[sess.ID()]:
-				// Broadcast the message to all clients
-				for clientMessageChan := range s.TotalClients {
-					select {
-					case clientMessageChan <- msg:
-					default:
-						pkg.Logger.Printf("Client message channel full, dropping message")
-					}
-				}
-			}
+		for msg := range sessionMessages {
+			s.Publish(sess.ID(), msg)
 		}
 	}()
 }
 
+// Publish sends the message to all the clients of the session.
+func (s *eventStream) Publish(sessionID string, msg *ai.Message) {
+	s.Messages <- sessionMessage{sessionID: sessionID, message: msg}
+}
+
+// dispatch sends the message to the clients of its session. Only the partial answers are dropped
+// when a client lags behind, each of them being replaced by the next one.
+func (s *eventStream) dispatch(m sessionMessage) {
+	for clientMessageChan, clientSessionID := range s.TotalClients {
+		if clientSessionID != m.sessionID {
+			continue
+		}
+		if !isPartialMessage(m.message) {
+			clientMessageChan <- m.message
+			continue
+		}
+		select {
+		case clientMessageChan <- m.message:
+		default:
+			pkg.Logger.Printf("Client message channel full, dropping partial message")
+		}
+	}
+}
+
 // It Listens all incoming requests from clients.
-// Handles addition and removal of clients and broadcast messages to clients.
+// Handles addition and removal of clients and dispatches the messages to clients.
 func (s *eventStream) listen() {
 	for {
 		select {
+		case m := <-s.Messages:
+			s.dispatch(m)
+
 		// Add new available client
 		case client := <-s.NewClients:
-			s.TotalClients[client] = struct{}{}
+			s.TotalClients[client.messages] = client.sessionID
 			pkg.Logger.Printf("Client added. %d registered clients", len(s.TotalClients))
 
 		// Remove closed client
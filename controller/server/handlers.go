@@ -2,23 +2,29 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/gin-gonic/gin"
 	"github.com/thomas-marquis/goLLMan/agent"
+	"github.com/thomas-marquis/goLLMan/agent/loader"
 	"github.com/thomas-marquis/goLLMan/agent/session"
 	"github.com/thomas-marquis/goLLMan/controller/server/components"
 	"github.com/thomas-marquis/goLLMan/internal/domain"
 	"github.com/thomas-marquis/goLLMan/pkg"
 )
 
+// coverCacheMaxAge is how long the browsers cache the book covers.
+const coverCacheMaxAge = 7 * 24 * time.Hour
+
 func (s *Server) FlowsHandlers(r *gin.Engine, g *genkit.Genkit) {
 	for _, flow := range genkit.ListFlows(g) {
 		r.POST("/"+flow.Name(), func(c *gin.Context) {
@@ -27,10 +33,17 @@ func (s *Server) FlowsHandlers(r *gin.Engine, g *genkit.Genkit) {
 	}
 }
 
-func (s *Server) ToggleBookSelectionHandler(r *gin.Engine) {
+func (s *Server) ToggleBookSelectionHandler(r *gin.Engine, store session.Store) {
 	r.POST("/books/:id/toggle", func(c *gin.Context) {
 		bookId := c.Param("id")
 
+		sess, err := getSession(store, c.Request.Context())
+		if err != nil {
+			pkg.Logger.Println(err)
+			showError(c, err, "Session loading failed", "")
+			return
+		}
+
 		book, err := s.bookRepository.GetByID(c.Request.Context(), bookId)
 		if err != nil {
 			pkg.Logger.Printf("Error getting book: %s\n", err)
@@ -43,25 +56,25 @@ func (s *Server) ToggleBookSelectionHandler(r *gin.Engine) {
 			return
 		}
 
-		book.Selected = !book.Selected
 		action := "selected"
-		if !book.Selected {
+		if !sess.ToggleBook(book.ID) {
 			action = "unselected"
 		}
 
-		if err := s.bookRepository.Update(c.Request.Context(), book); err != nil {
-			pkg.Logger.Printf("Error updating book: %s\n", err)
-			showError(c, err, "Internal error", "Unable to select/unselect this book")
-			return
-		}
-
 		pkg.Logger.Printf("Toggle book selection: %s\n", c.Param("id"))
 		showSuccess(c, "Saved", "'%s' %s", book.Title, action)
 	})
 }
 
-func (s *Server) GetBookHandler(r *gin.Engine) {
+func (s *Server) GetBookHandler(r *gin.Engine, store session.Store) {
 	r.GET("/books/:id", func(c *gin.Context) {
+		sess, err := getSession(store, c.Request.Context())
+		if err != nil {
+			pkg.Logger.Println(err)
+			showError(c, err, "Session loading failed", "")
+			return
+		}
+
 		bookId := c.Param("id")
 		book, err := s.bookRepository.GetByID(c.Request.Context(), bookId)
 		if err != nil {
@@ -70,23 +83,113 @@ func (s *Server) GetBookHandler(r *gin.Engine) {
 			return
 		}
 
-		c.HTML(http.StatusOK, "", components.BookCard(book))
+		c.HTML(http.StatusOK, "", components.BookCard(book, sess.HasBook(book.ID)))
 	})
 }
 
-func (s *Server) GetPageHandler(r *gin.Engine) {
+// GetBookCoverHandler serves the cover thumbnail of a book. The covers don't change once uploaded,
+// so the browsers keep them for coverCacheMaxAge and revalidate them with their ETag.
+func (s *Server) GetBookCoverHandler(r *gin.Engine) {
+	r.GET("/books/:id/cover", func(c *gin.Context) {
+		book, err := s.bookRepository.GetByID(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			if errors.Is(err, domain.ErrBookNotFound) {
+				c.Status(http.StatusNotFound)
+				return
+			}
+			pkg.Logger.Printf("Error getting book: %s\n", err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		// Only the thumbnail stored along with the book file is served
+		coverName, _ := book.Metadata[domain.MetadataCover].(string)
+		if coverName == "" || coverName != book.File.CoverFile().Name || filepath.Base(coverName) != coverName {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		cover, err := s.fileRepository.Load(c.Request.Context(), domain.File{Name: coverName})
+		if err != nil {
+			if errors.Is(err, domain.ErrFileNotFound) {
+				c.Status(http.StatusNotFound)
+				return
+			}
+			pkg.Logger.Printf("Error loading book cover: %s\n", err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		sum := sha256.Sum256(cover.Content)
+		etag := fmt.Sprintf(`"%x"`, sum[:8])
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(coverCacheMaxAge.Seconds())))
+		c.Header("ETag", etag)
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Data(http.StatusOK, "image/jpeg", cover.Content)
+	})
+}
+
+// ReindexBookHandler restarts the indexing of a book that failed.
+// The indexing resumes from the last batch stored.
+func (s *Server) ReindexBookHandler(r *gin.Engine) {
+	r.POST("/books/:id/index", func(c *gin.Context) {
+		s.reindexMu.Lock()
+		defer s.reindexMu.Unlock()
+
+		book, err := s.bookRepository.GetByID(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			pkg.Logger.Printf("Error getting book: %s\n", err)
+			showError(c, err, "Internal error", "Unable to find this book")
+			return
+		}
+
+		if book.Status != domain.StatusError {
+			showInfo(c, "Nothing to retry", "Only the books whose indexing failed can be indexed again")
+			return
+		}
+
+		// The status is saved before queueing, so that the book can't be queued twice
+		book.Status = domain.StatusIndexing
+		if err := s.bookRepository.Update(c.Request.Context(), book); err != nil {
+			pkg.Logger.Printf("Error updating book status to indexing: %s\n", err)
+			showError(c, err, "Internal error", "Unable to index this book again")
+			return
+		}
+
+		go func() {
+			s.backgroundWork <- IndexWork{
+				Book: book,
+				Flow: s.indexFlow,
+				Ctx:  context.Background(),
+			}
+		}()
+
+		c.HTML(http.StatusOK, "", components.IndexingBookCard(book, false))
+	})
+}
+
+func (s *Server) GetPageHandler(r *gin.Engine, store session.Store) {
 	r.GET("/", func(c *gin.Context) {
+		sess, err := getSession(store, c.Request.Context())
+		if err != nil {
+			pkg.Logger.Println(err)
+			showError(c, err, "Session loading failed", "")
+			return
+		}
+
 		books, err := s.bookRepository.List(context.Background())
 		if err != nil {
 			pkg.Logger.Printf("Failed to list books: %s\n", err)
 			showError(c, err, "Books loading failed", "")
 			return
 		}
-		c.HTML(http.StatusOK, "", components.Page(books))
+		c.HTML(http.StatusOK, "", components.Page(books, sess.BookIDs()))
 	})
 }
 
-func (s *Server) PostMessageHandler(r *gin.Engine, store session.Store) {
+func (s *Server) PostMessageHandler(r *gin.Engine, store session.Store, stream *eventStream) {
 	r.POST("/messages", func(c *gin.Context) {
 		pkg.Logger.Println("Message received")
 
@@ -105,25 +208,38 @@ func (s *Server) PostMessageHandler(r *gin.Engine, store session.Store) {
 
 		// TODO: inject the agent instead the ragFlow
 		// TODO: pass the session ID to the agent class
-		// TODO: dynamically set the book ID based on the current book context
 		in := agent.ChatbotInput{
 			Question: formData.Question,
 			Session:  sess.ID(),
+			BookIDs:  sess.BookIDs(),
 		}
-		if _, err = s.ragFlow.Run(c.Request.Context(), in); err != nil {
-			pkg.Logger.Printf("Failed to generate response from ragFlow: %s\n", err)
-			showError(c, err, "Response generation failed", "")
-			return
+		var answer strings.Builder
+		for res, err := range s.ragFlow.Stream(c.Request.Context(), in) {
+			if err != nil {
+				pkg.Logger.Printf("Failed to generate response from ragFlow: %s\n", err)
+				// Close the answer being streamed, if any
+				stream.Publish(sess.ID(), newErrorMessage("Sorry, the answer generation failed. Please try again."))
+				showError(c, err, "Response generation failed", "")
+				return
+			}
+			if res.Done {
+				break
+			}
+			if res.Stream == "" {
+				continue
+			}
+			answer.WriteString(res.Stream)
+			stream.Publish(sess.ID(), newPartialMessage(answer.String()))
 		}
 
 		c.HTML(http.StatusOK, "",
-			components.Message("user", formData.Question),
+			components.Message("user", formData.Question, nil, ""),
 		)
 	})
 }
 
 func (s *Server) SSEMessagesHandler(r *gin.Engine, store session.Store, stream *eventStream) {
-	r.GET("/stream", headersSSEMiddleware(), stream.sseConnectMiddleware(), func(c *gin.Context) {
+	r.GET("/stream", headersSSEMiddleware(), stream.sseConnectMiddleware(store), func(c *gin.Context) {
 		sess, err := getSession(store, c.Request.Context())
 		if err != nil {
 			pkg.Logger.Println(err)
@@ -151,25 +267,37 @@ func (s *Server) SSEMessagesHandler(r *gin.Engine, store session.Store, stream *
 			}
 		}()
 
+		streaming := false
 		c.Stream(func(w io.Writer) bool {
 			if msg, ok := <-clientMessageChan; ok {
 				if msg.Role == ai.RoleUser {
 					sendToStream(c, components.Thinking())
-				} else {
+				} else if !streaming {
 					sendToStream(c, components.NotThinking())
 				}
 
-				if _, err := convertToHTML(pkg.ContentToText(msg.Content)); err != nil {
+				content := pkg.ContentToText(msg.Content)
+				if _, err := convertToHTML(content); err != nil {
 					pkg.Logger.Printf("Error converting content to HTML: %s\n", err)
 					showError(c, err, "Response processing failed", "")
 					return false
 				}
 
-				sendToStream(c,
-					components.Message(
-						string(msg.Role),
-						pkg.ContentToText(msg.Content),
-					))
+				switch {
+				case isErrorMessage(msg):
+					sendToStream(c, components.StreamingError(content, streaming))
+					streaming = false
+				case isPartialMessage(msg):
+					sendToStream(c, components.StreamingMessage(content, streaming))
+					streaming = true
+				case streaming && msg.Role == ai.RoleModel:
+					sendToStream(c, components.StreamedMessageEnd(string(msg.Role), content,
+						agent.CitationsFromMessage(msg), agent.SearchQueryFromMessage(msg)))
+					streaming = false
+				default:
+					sendToStream(c, components.Message(string(msg.Role), content,
+						agent.CitationsFromMessage(msg), agent.SearchQueryFromMessage(msg)))
+				}
 				return true
 			}
 			return false
@@ -185,7 +313,7 @@ func (s *Server) NotificationHandlers(r *gin.Engine) {
 
 func (s *Server) UploadBookHandler(r *gin.Engine) {
 	r.GET("books/upload/open", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "", components.UploadEpubModal())
+		c.HTML(http.StatusOK, "", components.UploadEpubModal(s.bookLoaders.Extensions()))
 	})
 
 	r.GET("books/upload/cancel", func(c *gin.Context) {
@@ -205,13 +333,6 @@ func (s *Server) UploadBookHandler(r *gin.Engine) {
 			return
 		}
 
-		// Verify the file is an EPUB
-		if filepath.Ext(file.Filename) != ".epub" {
-			pkg.Logger.Printf("Invalid file type: %s\n", file.Filename)
-			showError(c, nil, "Bad format", "only EPUB files are allowed")
-			return
-		}
-
 		ff, err := file.Open()
 		defer ff.Close()
 		if err != nil {
@@ -234,11 +355,20 @@ func (s *Server) UploadBookHandler(r *gin.Engine) {
 			Content: content,
 		}
 
-		// Parse the EPUB file
-		book, err := s.bookRepository.ReadFromFile(c.Request.Context(), fc)
+		// Read the book metadata with the loader of its format, under the uploaded name
+		// so that the titles falling back on it don't get the timestamp
+		book, err := s.bookLoaders.ReadMetadata(&domain.FileWithContent{
+			File:    domain.File{Name: file.Filename},
+			Content: content,
+		})
+		if errors.Is(err, loader.ErrUnsupportedFormat) {
+			pkg.Logger.Printf("Invalid file type: %v\n", err)
+			showError(c, nil, "Bad format", "only %s files are allowed", strings.Join(s.bookLoaders.Extensions(), ", "))
+			return
+		}
 		if err != nil {
-			pkg.Logger.Printf("Error processing EPUB: %v", err)
-			showError(c, nil, "Upload failed", "Failed to process EPUB file. Is your file corrupted?")
+			pkg.Logger.Printf("Error processing book file: %v", err)
+			showError(c, nil, "Upload failed", "Failed to process the book file. Is your file corrupted?")
 			return
 		}
 
@@ -260,6 +390,16 @@ func (s *Server) UploadBookHandler(r *gin.Engine) {
 			return
 		}
 
+		// The cover is optional, the library shows a placeholder without it.
+		// Only the stored thumbnail can be the cover, whatever the book file metadata say.
+		delete(book.Metadata, domain.MetadataCover)
+		cover, err := s.storeCover(c.Request.Context(), fc)
+		if err == nil {
+			book.Metadata[domain.MetadataCover] = cover.Name
+		} else if !errors.Is(err, loader.ErrNoCover) {
+			pkg.Logger.Printf("Error extracting book cover: %v\n", err)
+		}
+
 		// Add the book to the repository
 		addedBook, err := s.bookRepository.Add(
 			c.Request.Context(),
@@ -285,6 +425,24 @@ func (s *Server) UploadBookHandler(r *gin.Engine) {
 
 		showSuccess(c, "Book uploaded",
 			fmt.Sprintf("Book %s uploaded successfully. Indexing is starting...", addedBook.Title))
-		c.HTML(http.StatusOK, "", components.BookCard(addedBook))
+		c.HTML(http.StatusOK, "", components.BookCard(addedBook, false))
 	})
 }
+
+// storeCover stores the cover thumbnail of the book file, next to it.
+func (s *Server) storeCover(ctx context.Context, file *domain.FileWithContent) (domain.File, error) {
+	cover, err := s.bookLoaders.ReadCover(file)
+	if err != nil {
+		return domain.File{}, err
+	}
+	thumbnail, err := loader.CoverThumbnail(cover)
+	if err != nil {
+		return domain.File{}, err
+	}
+
+	coverFile := &domain.FileWithContent{File: file.CoverFile(), Content: thumbnail}
+	if err := s.fileRepository.Store(ctx, coverFile); err != nil {
+		return domain.File{}, fmt.Errorf("failed to store cover: %w", err)
+	}
+	return coverFile.File, nil
+}
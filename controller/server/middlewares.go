@@ -1,9 +1,16 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/thomas-marquis/goLLMan/agent/session"
+	"github.com/thomas-marquis/goLLMan/pkg"
+)
 
 const (
 	clientChanKey = "messagesChan"
+
+	// clientChanSize leaves room for the answer chunks streamed between two complete messages
+	clientChanSize = 32
 )
 
 func headersSSEMiddleware() gin.HandlerFunc {
@@ -16,20 +23,31 @@ func headersSSEMiddleware() gin.HandlerFunc {
 	}
 }
 
-func (s *eventStream) sseConnectMiddleware() gin.HandlerFunc {
+func (s *eventStream) sseConnectMiddleware(store session.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		sess, err := getSession(store, c.Request.Context())
+		if err != nil {
+			pkg.Logger.Println(err)
+			showError(c, err, "Session loading failed", "")
+			c.Abort()
+			return
+		}
+
 		// Initialize client channel
-		clientChan := make(messagesChan, 1)
+		clientChan := make(messagesChan, clientChanSize)
 
 		// Send new connection to event server
-		s.NewClients <- clientChan
+		s.NewClients <- streamClient{sessionID: sess.ID(), messages: clientChan}
 
 		go func() {
 			<-c.Writer.CloseNotify()
 
-			// Drain client channel so that it does not block. Server may keep sending messages to this channel
-			for range clientChan {
-			}
+			// Drain client channel so that it does not block, until the event server closes it.
+			// Server may keep sending messages to this channel
+			go func() {
+				for range clientChan {
+				}
+			}()
 			// Send closed connection to event server
 			s.ClosedClients <- clientChan
 		}()
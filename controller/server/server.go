@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"sync"
 
 	genkit_core "github.com/firebase/genkit/go/core"
 	"github.com/firebase/genkit/go/genkit"
@@ -13,6 +14,7 @@ import (
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"github.com/thomas-marquis/goLLMan/agent"
+	"github.com/thomas-marquis/goLLMan/agent/loader"
 	"github.com/thomas-marquis/goLLMan/agent/session"
 	"github.com/thomas-marquis/goLLMan/controller/server/gintemplrenderer"
 	"github.com/thomas-marquis/goLLMan/pkg"
@@ -25,24 +27,28 @@ const (
 type Server struct {
 	port           string
 	host           string
-	ragFlow        *genkit_core.Flow[agent.ChatbotInput, string, struct{}]
+	ragFlow        *genkit_core.Flow[agent.ChatbotInput, agent.ChatbotOutput, string]
 	indexFlow      *genkit_core.Flow[domain.Book, any, struct{}]
 	cfg            agent.Config
 	sessionStore   session.Store
 	router         *gin.Engine
 	bookRepository domain.BookRepository
 	fileRepository domain.FileRepository
+	bookLoaders    *loader.Registry
 	backgroundWork chan Work
+	// reindexMu makes the status check and update of a book to index again atomic
+	reindexMu sync.Mutex
 }
 
 func New(
 	cfg agent.Config,
-	ragFlow *genkit_core.Flow[agent.ChatbotInput, string, struct{}],
+	ragFlow *genkit_core.Flow[agent.ChatbotInput, agent.ChatbotOutput, string],
 	indexFlow *genkit_core.Flow[domain.Book, any, struct{}],
 	sessionStore session.Store,
 	g *genkit.Genkit,
 	bookRepository domain.BookRepository,
 	fileRepository domain.FileRepository,
+	bookLoaders *loader.Registry,
 ) *Server {
 	router := gin.Default()
 	router.Static("/static", "./static")
@@ -50,9 +56,10 @@ func New(
 
 	stream := &eventStream{
 		MessageBySessionID: make(map[string]messagesChan),
-		NewClients:         make(chan messagesChan),
+		Messages:           make(chan sessionMessage),
+		NewClients:         make(chan streamClient),
 		ClosedClients:      make(chan messagesChan),
-		TotalClients:       make(map[messagesChan]struct{}),
+		TotalClients:       make(map[messagesChan]string),
 	}
 
 	go stream.listen()
@@ -71,6 +78,7 @@ func New(
 		sessionStore:   sessionStore,
 		bookRepository: bookRepository,
 		fileRepository: fileRepository,
+		bookLoaders:    bookLoaders,
 		backgroundWork: bkgWorkChan,
 	}
 
@@ -82,14 +90,16 @@ func New(
 	store := cookie.NewStore([]byte("secret")) // TODO: use a real secret here!
 	router.Use(sessions.Sessions("chatsession", store))
 
-	s.GetPageHandler(router)
+	s.GetPageHandler(router, sessionStore)
 	s.SSEMessagesHandler(router, sessionStore, stream)
-	s.PostMessageHandler(router, sessionStore)
-	s.ToggleBookSelectionHandler(router)
+	s.PostMessageHandler(router, sessionStore, stream)
+	s.ToggleBookSelectionHandler(router, sessionStore)
 	s.UploadBookHandler(router)
 	s.FlowsHandlers(router, g)
 	s.NotificationHandlers(router)
-	s.GetBookHandler(router)
+	s.GetBookHandler(router, sessionStore)
+	s.GetBookCoverHandler(router)
+	s.ReindexBookHandler(router)
 
 	return s
 }
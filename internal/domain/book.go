@@ -1,5 +1,11 @@
 package domain
 
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 type Status string
 
 const (
@@ -37,7 +43,6 @@ type Book struct {
 	Title    string
 	Author   string
 	Metadata map[string]any
-	Selected bool
 	Status   Status
 	File     File
 }
@@ -49,3 +54,98 @@ func WithStatus(status Status) BookOption {
 		b.Status = status
 	}
 }
+
+// Keys of the descriptive book metadata, read from the book files.
+const (
+	MetadataLanguage    = "language"
+	MetadataPublisher   = "publisher"
+	MetadataPublished   = "published"
+	MetadataISBN        = "isbn"
+	MetadataIdentifiers = "identifiers"
+	MetadataSubjects    = "subjects"
+	MetadataDescription = "description"
+	MetadataSeries      = "series"
+	MetadataSeriesIndex = "series_index"
+	// MetadataCover holds the name of the cover thumbnail file, when the book has a cover.
+	MetadataCover = "cover"
+)
+
+// Keys of the book metadata written by the application, along with MetadataCover.
+const (
+	// MetadataFormat is the name of the format the book file was loaded with.
+	MetadataFormat = "format"
+	// MetadataError holds why the last indexing of the book failed.
+	MetadataError = "error"
+	// MetadataSplitter records how the chunks of the book were split.
+	MetadataSplitter = "splitter"
+	// MetadataChunkContext records how the chunks of the book were contextualized.
+	MetadataChunkContext = "chunk_context"
+)
+
+// IsReservedMetadata tells whether the metadata key is written by the application, not read from the book files.
+func IsReservedMetadata(key string) bool {
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case MetadataCover, MetadataFormat, MetadataError, MetadataSplitter, MetadataChunkContext:
+		return true
+	}
+	return false
+}
+
+// MetadataStrings returns the values of a metadata key as texts, whether it holds a single value or a list.
+func (b Book) MetadataStrings(key string) []string {
+	switch v := b.Metadata[key].(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, metadataText(item))
+		}
+		return values
+	case map[string]any:
+		return nil
+	default:
+		return []string{metadataText(v)}
+	}
+}
+
+// MetadataString returns the first value of a metadata key, or an empty string.
+func (b Book) MetadataString(key string) string {
+	if values := b.MetadataStrings(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// MatchesMetadata tells whether the book has all the filtered metadata values, compared regardless of the case.
+// A list, like the subjects, matches when one of its items does.
+func (b Book) MatchesMetadata(filters map[string]string) bool {
+	for key, expected := range filters {
+		matched := false
+		for _, value := range b.MetadataStrings(key) {
+			if strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(expected)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// metadataText formats a metadata value, the numbers read back from JSON without their trailing zeros.
+func metadataText(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
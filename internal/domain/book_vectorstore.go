@@ -6,7 +6,80 @@ import (
 	"github.com/firebase/genkit/go/ai"
 )
 
+type RetrievalMode string
+
+const (
+	// RetrievalModeVector ranks book parts by embedding similarity only.
+	RetrievalModeVector RetrievalMode = "vector"
+	// RetrievalModeHybrid fuses the embedding similarity ranking with a full-text search ranking.
+	RetrievalModeHybrid RetrievalMode = "hybrid"
+)
+
+func RetrievalModeFromString(s string) RetrievalMode {
+	switch s {
+	case string(RetrievalModeHybrid):
+		return RetrievalModeHybrid
+	default:
+		return RetrievalModeVector
+	}
+}
+
+type RetrieveOptions struct {
+	Mode          RetrievalMode
+	Query         string
+	VectorWeight  float64
+	LexicalWeight float64
+}
+
+type RetrieveOption func(o *RetrieveOptions)
+
+// WithHybridSearch enables the hybrid retrieval mode.
+// The query text is used for the full-text search and each ranking is weighted before being fused.
+func WithHybridSearch(query string, vectorWeight, lexicalWeight float64) RetrieveOption {
+	return func(o *RetrieveOptions) {
+		o.Mode = RetrievalModeHybrid
+		o.Query = query
+		o.VectorWeight = vectorWeight
+		o.LexicalWeight = lexicalWeight
+	}
+}
+
+// IndexingCheckpoint is the progress of the indexing of a book, saved after each batch.
+type IndexingCheckpoint struct {
+	// NextBatch is the index of the first batch not indexed yet.
+	NextBatch    int
+	TotalBatches int
+	// Fingerprint identifies the chunks and their batching.
+	// A checkpoint with another fingerprint can't be resumed from.
+	Fingerprint string
+}
+
+// Done tells whether all the batches were indexed.
+func (c IndexingCheckpoint) Done() bool {
+	return c.TotalBatches > 0 && c.NextBatch >= c.TotalBatches
+}
+
 type BookVectorStore interface {
-	Index(ctx context.Context, book Book, contents []string, vectors [][]float32) error
-	Retrieve(ctx context.Context, books []Book, embedding []float32, limit int) ([]*ai.Document, error)
+	// Index stores a batch of parts along with the checkpoint reached once the batch is indexed.
+	// Both are written atomically so that a retried batch is never duplicated.
+	// The stored checkpoint must be the one of the previous batch, otherwise another indexing of the book
+	// went further and it returns ErrIndexingCheckpointConflict without writing anything.
+	Index(ctx context.Context, book Book, parts []*ai.Document, vectors [][]float32, checkpoint IndexingCheckpoint) error
+	// GetIndexingCheckpoint returns the last checkpoint saved for the book.
+	// If there is none, it returns ErrIndexingCheckpointNotFound.
+	GetIndexingCheckpoint(ctx context.Context, book Book) (IndexingCheckpoint, error)
+	// ClearIndex deletes the parts and the checkpoint of the book.
+	ClearIndex(ctx context.Context, book Book) error
+	Retrieve(ctx context.Context, books []Book, embedding []float32, limit int, options ...RetrieveOption) ([]*ai.Document, error)
+
+	// ListChapterParts returns all the parts of a book chapter, given by its index, in reading order.
+	ListChapterParts(ctx context.Context, book Book, chapterIndex int) ([]*ai.Document, error)
+	// FindChapterIndex returns the index of the first chapter of the book with the given title, case-insensitively.
+	// If there is none, it returns ErrChapterNotFound.
+	FindChapterIndex(ctx context.Context, book Book, title string) (int, error)
+
+	// GetNeighborParts returns the part with the given id surrounded by up to radius parts
+	// before and after it in the same chapter, in reading order.
+	// If the part does not exist, it returns ErrBookPartNotFound.
+	GetNeighborParts(ctx context.Context, partID string, radius int) ([]*ai.Document, error)
 }
@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ChunkContextCache stores the sentences generated to situate the chunks within their chapter, keyed by
+// the completion model and the SHA-256 hash of the chunk along with its chapter. Being generated, the sentences
+// differ from one run to another: reusing them keeps the embedded texts, and so the embedding cache keys, stable.
+type ChunkContextCache interface {
+	// Get returns the cached sentences of the given hashes, keyed by hash. The missing hashes are absent.
+	// The returned entries are marked as used.
+	Get(ctx context.Context, model string, hashes []string) (map[string]string, error)
+	// Put stores the sentences keyed by hash. The entries already cached are kept.
+	Put(ctx context.Context, model string, sentences map[string]string) error
+	// Prune deletes the entries not used since the given time and returns how many were deleted.
+	Prune(ctx context.Context, unusedSince time.Time) (int64, error)
+}
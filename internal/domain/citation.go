@@ -0,0 +1,12 @@
+package domain
+
+// Citation references a book passage an answer relies on.
+type Citation struct {
+	BookID       string `json:"bookId"`
+	BookTitle    string `json:"bookTitle"`
+	ChapterTitle string `json:"chapterTitle,omitempty"`
+	// HeadingPath is the titles of the sections the passage is under, from the outermost.
+	HeadingPath []string `json:"headingPath,omitempty"`
+	ChunkID     string   `json:"chunkId"`
+	Excerpt     string   `json:"excerpt"`
+}
@@ -0,0 +1,18 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// EmbeddingCache stores the embedding vectors of chunks, keyed by the embedding model
+// and the SHA-256 hash of the embedded text, so that the same text is never embedded twice.
+type EmbeddingCache interface {
+	// Get returns the cached vectors of the given hashes, keyed by hash. The missing hashes are absent.
+	// The returned entries are marked as used.
+	Get(ctx context.Context, model string, hashes []string) (map[string][]float32, error)
+	// Put stores the vectors keyed by hash. The entries already cached are kept.
+	Put(ctx context.Context, model string, vectors map[string][]float32) error
+	// Prune deletes the entries not used since the given time and returns how many were deleted.
+	Prune(ctx context.Context, unusedSince time.Time) (int64, error)
+}
@@ -8,4 +8,9 @@ var (
 	ErrBookAlreadyExists = errors.New("book already exists")
 	ErrFileAlreadyExists = errors.New("file already exists")
 	ErrFileNotFound      = errors.New("file not found")
+	ErrBookPartNotFound  = errors.New("book part not found")
+	ErrChapterNotFound   = errors.New("chapter not found")
+
+	ErrIndexingCheckpointNotFound = errors.New("indexing checkpoint not found")
+	ErrIndexingCheckpointConflict = errors.New("indexing checkpoint updated concurrently")
 )
@@ -4,6 +4,11 @@ type File struct {
 	Name string
 }
 
+// CoverFile returns the file of the cover thumbnail of a book file.
+func (f File) CoverFile() File {
+	return File{Name: f.Name + ".cover.jpg"}
+}
+
 type FileWithContent struct {
 	File
 	Content []byte
@@ -4,18 +4,42 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/pgvector/pgvector-go"
 	"github.com/thomas-marquis/goLLMan/internal/domain"
 	"github.com/thomas-marquis/goLLMan/internal/infrastructure/orm"
 	"github.com/thomas-marquis/goLLMan/pkg"
-	"github.com/timsims/pamphlet"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+const (
+	// rrfK dampens the weight of the top ranks in the reciprocal rank fusion.
+	rrfK = 60
+
+	// hybridCandidatesFactor is the number of candidates fetched by each ranking per requested result.
+	hybridCandidatesFactor = 4
+
+	// vectorRankingQuery and lexicalRankingQuery return the IDs of the best parts for each ranking, best first.
+	vectorRankingQuery = `
+SELECT id
+FROM book_parts
+WHERE book_id IN @book_ids
+ORDER BY embedding <=> @embedding
+LIMIT @candidates`
+
+	lexicalRankingQuery = `
+SELECT id
+FROM book_parts, websearch_to_tsquery('simple', @query) AS query
+WHERE book_id IN @book_ids AND content_tsv @@ query
+ORDER BY ts_rank_cd(content_tsv, query) DESC
+LIMIT @candidates`
+)
+
 type BookRepositoryPostgres struct {
 	db *gorm.DB
 }
@@ -48,10 +72,18 @@ func (r *BookRepositoryPostgres) List(ctx context.Context) ([]domain.Book, error
 	return books, nil
 }
 
-func (r *BookRepositoryPostgres) ListSelected(ctx context.Context) ([]domain.Book, error) {
-	var ormBooks []orm.Book
+func (r *BookRepositoryPostgres) ListByIDs(ctx context.Context, ids []string) ([]domain.Book, error) {
+	bookIDs := make([]int, len(ids), len(ids))
+	for i, id := range ids {
+		bookID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, errors.Join(domain.ErrRepositoryError, err)
+		}
+		bookIDs[i] = bookID
+	}
 
-	result := r.db.WithContext(ctx).Find(&ormBooks)
+	var ormBooks []orm.Book
+	result := r.db.WithContext(ctx).Where("id IN ?", bookIDs).Find(&ormBooks)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, domain.ErrBookNotFound
@@ -149,24 +181,6 @@ func (r *BookRepositoryPostgres) GetByTitleAndAuthor(ctx context.Context, title,
 	return ormBook.ToDomain(), nil
 }
 
-func (r *BookRepositoryPostgres) ReadFromFile(ctx context.Context, file *domain.FileWithContent) (domain.Book, error) {
-	parser, err := pamphlet.OpenBytes(file.Content)
-	if err != nil {
-		return domain.Book{}, fmt.Errorf("error opening epub file: %w", err)
-	}
-
-	book := parser.GetBook()
-	if book == nil {
-		return domain.Book{}, errors.New("invalid epub file")
-	}
-
-	return domain.Book{
-		Title:  book.Title,
-		Author: book.Author,
-		File:   file.File,
-	}, nil
-}
-
 func (r *BookRepositoryPostgres) Update(ctx context.Context, book domain.Book) error {
 	if book.ID == "" {
 		return errors.Join(domain.ErrRepositoryError, fmt.Errorf("book id is empty"))
@@ -184,29 +198,271 @@ func (r *BookRepositoryPostgres) Update(ctx context.Context, book domain.Book) e
 	return nil
 }
 
-func (r *BookRepositoryPostgres) Index(ctx context.Context, book domain.Book, contents []string, vectors [][]float32) error {
-	if len(contents) != len(vectors) {
-		return errors.New("contents and vectors must have the same length")
+func (r *BookRepositoryPostgres) Index(
+	ctx context.Context,
+	book domain.Book,
+	docs []*ai.Document,
+	vectors [][]float32,
+	checkpoint domain.IndexingCheckpoint,
+) error {
+	if len(docs) != len(vectors) {
+		return errors.New("documents and vectors must have the same length")
+	}
+
+	parts := make([]*orm.BookPart, len(docs), len(docs))
+	for i, doc := range docs {
+		chapterTitle, _ := doc.Metadata["chapter_title"].(string)
+		chapterIndex, _ := doc.Metadata["chapter_index"].(int)
+		position, _ := doc.Metadata["position"].(int)
+		parts[i] = orm.NewBookPart(book, chapterTitle, chapterIndex, position,
+			pkg.ContentToText(doc.Content), vectors[i], partMetadata(doc.Metadata))
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The checkpoint is moved first: its row stays locked until the parts are created.
+		if err := advanceIndexingCheckpoint(tx, book, checkpoint); err != nil {
+			return err
+		}
+		if len(parts) > 0 {
+			if err := tx.Create(&parts).Error; err != nil {
+				return fmt.Errorf("failed to create book index: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// advanceIndexingCheckpoint saves the checkpoint if the stored one is the checkpoint of the previous batch.
+// There is no stored checkpoint before the first batch.
+func advanceIndexingCheckpoint(tx *gorm.DB, book domain.Book, checkpoint domain.IndexingCheckpoint) error {
+	next := orm.NewIndexingCheckpoint(book, checkpoint)
+
+	var res *gorm.DB
+	if checkpoint.NextBatch <= 1 {
+		res = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(next)
+	} else {
+		res = tx.Model(&orm.IndexingCheckpoint{}).
+			Where("book_id = ? AND next_batch = ?", next.BookID, checkpoint.NextBatch-1).
+			Updates(map[string]any{
+				"next_batch":    next.NextBatch,
+				"total_batches": next.TotalBatches,
+				"fingerprint":   next.Fingerprint,
+			})
+	}
+	if res.Error != nil {
+		return fmt.Errorf("failed to save indexing checkpoint: %w", res.Error)
+	}
+	if res.RowsAffected != 1 {
+		return domain.ErrIndexingCheckpointConflict
+	}
+	return nil
+}
+
+func (r *BookRepositoryPostgres) GetIndexingCheckpoint(ctx context.Context, book domain.Book) (domain.IndexingCheckpoint, error) {
+	bookID, err := strconv.Atoi(book.ID)
+	if err != nil {
+		return domain.IndexingCheckpoint{}, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	var checkpoint orm.IndexingCheckpoint
+	if err := r.db.WithContext(ctx).First(&checkpoint, "book_id = ?", bookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.IndexingCheckpoint{}, domain.ErrIndexingCheckpointNotFound
+		}
+		return domain.IndexingCheckpoint{}, errors.Join(domain.ErrRepositoryError, err)
 	}
 
-	parts := make([]*orm.BookPart, len(contents), len(contents))
-	for i, content := range contents {
-		parts[i] = orm.NewBookPart(book, content, vectors[i])
+	return checkpoint.ToDomain(), nil
+}
+
+func (r *BookRepositoryPostgres) ClearIndex(ctx context.Context, book domain.Book) error {
+	bookID, err := strconv.Atoi(book.ID)
+	if err != nil {
+		return errors.Join(domain.ErrRepositoryError, err)
 	}
 
-	if err := r.db.WithContext(ctx).Create(&parts).Error; err != nil {
-		return fmt.Errorf("failed to create book index: %w", err)
+	if err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("book_id = ?", bookID).Delete(&orm.BookPart{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("book_id = ?", bookID).Delete(&orm.IndexingCheckpoint{}).Error
+	}); err != nil {
+		return errors.Join(domain.ErrRepositoryError, err)
 	}
 	return nil
 }
 
-func (r *BookRepositoryPostgres) Retrieve(ctx context.Context, books []domain.Book, embedding []float32, limit int) ([]*ai.Document, error) {
+func (r *BookRepositoryPostgres) Retrieve(
+	ctx context.Context,
+	books []domain.Book,
+	embedding []float32,
+	limit int,
+	options ...domain.RetrieveOption,
+) ([]*ai.Document, error) {
+	opts := domain.RetrieveOptions{Mode: domain.RetrievalModeVector}
+	for _, option := range options {
+		option(&opts)
+	}
+
 	bookIDs := make([]int, len(books), len(books))
+	bookTitles := make(map[uint]string, len(books))
 	for i, book := range books {
 		id, _ := strconv.Atoi(book.ID)
 		bookIDs[i] = id
+		bookTitles[uint(id)] = book.Title
+	}
+
+	var bis []orm.BookPart
+	var err error
+	if opts.Mode == domain.RetrievalModeHybrid && opts.Query != "" {
+		bis, err = r.hybridSearch(ctx, bookIDs, embedding, limit, opts)
+	} else {
+		bis, err = r.vectorSearch(ctx, bookIDs, embedding, limit)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			pkg.Logger.Println("No book index found, returning empty retriever response")
+			return make([]*ai.Document, 0), nil
+		}
+		return nil, fmt.Errorf("failed to retrieve books indices: %w", err)
+	}
+
+	documents := make([]*ai.Document, len(bis), len(bis))
+	for i, bi := range bis {
+		documents[i] = partToDocument(bi, bookTitles[bi.BookID])
+	}
+
+	return documents, nil
+}
+
+func (r *BookRepositoryPostgres) ListChapterParts(ctx context.Context, book domain.Book, chapterIndex int) ([]*ai.Document, error) {
+	bookID, err := strconv.Atoi(book.ID)
+	if err != nil {
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	var bis []orm.BookPart
+	if err := r.db.
+		WithContext(ctx).
+		Where("book_id = ? AND chapter_index = ?", bookID, chapterIndex).
+		Order("position, id").
+		Find(&bis).Error; err != nil {
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	documents := make([]*ai.Document, len(bis), len(bis))
+	for i, bi := range bis {
+		documents[i] = partToDocument(bi, book.Title)
+	}
+
+	return documents, nil
+}
+
+func (r *BookRepositoryPostgres) FindChapterIndex(ctx context.Context, book domain.Book, title string) (int, error) {
+	bookID, err := strconv.Atoi(book.ID)
+	if err != nil {
+		return 0, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	var part orm.BookPart
+	if err := r.db.
+		WithContext(ctx).
+		Where("book_id = ? AND LOWER(chapter_title) = LOWER(?)", bookID, strings.TrimSpace(title)).
+		Order("chapter_index").
+		First(&part).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, domain.ErrChapterNotFound
+		}
+		return 0, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	return part.ChapterIndex, nil
+}
+
+func (r *BookRepositoryPostgres) GetNeighborParts(ctx context.Context, partID string, radius int) ([]*ai.Document, error) {
+	id, err := strconv.Atoi(partID)
+	if err != nil {
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	var part orm.BookPart
+	if err := r.db.WithContext(ctx).Preload("Book").First(&part, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrBookPartNotFound
+		}
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	sameChapter := r.db.
+		WithContext(ctx).
+		Where("book_id = ? AND chapter_index = ?", part.BookID, part.ChapterIndex)
+
+	// The parts indexed before the position column existed all have position 0, the id breaks the tie
+	var before, after []orm.BookPart
+	if err := sameChapter.Session(&gorm.Session{}).
+		Where("(position, id) < (?, ?)", part.Position, part.ID).
+		Order("position DESC, id DESC").
+		Limit(radius).
+		Find(&before).Error; err != nil {
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+	if err := sameChapter.Session(&gorm.Session{}).
+		Where("(position, id) > (?, ?)", part.Position, part.ID).
+		Order("position, id").
+		Limit(radius).
+		Find(&after).Error; err != nil {
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	documents := make([]*ai.Document, 0, len(before)+1+len(after))
+	for i := len(before) - 1; i >= 0; i-- {
+		documents = append(documents, partToDocument(before[i], part.Book.Title))
+	}
+	documents = append(documents, partToDocument(part, part.Book.Title))
+	for _, bi := range after {
+		documents = append(documents, partToDocument(bi, part.Book.Title))
 	}
 
+	return documents, nil
+}
+
+func partToDocument(part orm.BookPart, bookTitle string) *ai.Document {
+	metadata := make(map[string]any, len(part.Metadata)+6)
+	for k, v := range part.Metadata {
+		metadata[k] = v
+	}
+	metadata["id"] = part.ID
+	metadata["book_id"] = part.BookID
+	metadata["book_title"] = bookTitle
+	metadata["chapter_title"] = part.ChapterTitle
+	metadata["chapter_index"] = part.ChapterIndex
+	metadata["position"] = part.Position
+
+	return ai.DocumentFromText(part.Content, metadata)
+}
+
+// partColumns are the document metadata stored in their own book_parts columns.
+var partColumns = map[string]bool{
+	"id":            true,
+	"book_id":       true,
+	"book_title":    true,
+	"chapter_title": true,
+	"chapter_index": true,
+	"position":      true,
+}
+
+// partMetadata returns the document metadata not stored in their own column, like the heading path.
+func partMetadata(metadata map[string]any) map[string]any {
+	extra := make(map[string]any, len(metadata))
+	for k, v := range metadata {
+		if !partColumns[k] {
+			extra[k] = v
+		}
+	}
+	return extra
+}
+
+func (r *BookRepositoryPostgres) vectorSearch(ctx context.Context, bookIDs []int, embedding []float32, limit int) ([]orm.BookPart, error) {
 	var bis []orm.BookPart
 	if err := r.db.
 		WithContext(ctx).
@@ -219,23 +475,51 @@ func (r *BookRepositoryPostgres) Retrieve(ctx context.Context, books []domain.Bo
 		Limit(limit).
 		Where("book_id IN ?", bookIDs).
 		Find(&bis).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			pkg.Logger.Println("No book index found, returning empty retriever response")
-			return make([]*ai.Document, 0), nil
-		}
-		return nil, fmt.Errorf("failed to retrieve books indices: %w", err)
+		return nil, err
 	}
+	return bis, nil
+}
 
-	documents := make([]*ai.Document, len(bis), len(bis))
-	for i, bi := range bis {
-		documents[i] = ai.DocumentFromText(
-			bi.Content,
-			map[string]any{
-				"id":      bi.ID,
-				"book_id": bi.BookID,
-			},
-		)
+// hybridSearch ranks book parts with both the embedding similarity and a full-text search,
+// then fuses the two rankings with the weighted reciprocal rank fusion.
+func (r *BookRepositoryPostgres) hybridSearch(
+	ctx context.Context,
+	bookIDs []int,
+	embedding []float32,
+	limit int,
+	opts domain.RetrieveOptions,
+) ([]orm.BookPart, error) {
+	params := map[string]any{
+		"book_ids":   bookIDs,
+		"embedding":  pgvector.NewVector(embedding),
+		"query":      opts.Query,
+		"candidates": limit * hybridCandidatesFactor,
 	}
 
-	return documents, nil
+	var vectorIDs, lexicalIDs []uint
+	if err := r.db.WithContext(ctx).Raw(vectorRankingQuery, params).Scan(&vectorIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.WithContext(ctx).Raw(lexicalRankingQuery, params).Scan(&lexicalIDs).Error; err != nil {
+		return nil, err
+	}
+
+	ids := fuseRankings(limit, rrfK,
+		weightedRanking{ids: vectorIDs, weight: opts.VectorWeight},
+		weightedRanking{ids: lexicalIDs, weight: opts.LexicalWeight},
+	)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var bis []orm.BookPart
+	if err := r.db.WithContext(ctx).Where("id IN ?", ids).Find(&bis).Error; err != nil {
+		return nil, err
+	}
+	positions := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		positions[id] = i
+	}
+	sort.Slice(bis, func(i, j int) bool { return positions[bis[i].ID] < positions[bis[j].ID] })
+	return bis, nil
 }
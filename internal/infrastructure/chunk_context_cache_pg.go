@@ -0,0 +1,97 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/internal/infrastructure/orm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ChunkContextCachePostgres struct {
+	db *gorm.DB
+}
+
+var _ domain.ChunkContextCache = (*ChunkContextCachePostgres)(nil)
+
+func NewChunkContextCachePostgres(db *gorm.DB) *ChunkContextCachePostgres {
+	return &ChunkContextCachePostgres{
+		db: db,
+	}
+}
+
+func (c *ChunkContextCachePostgres) Get(ctx context.Context, model string, hashes []string) (map[string]string, error) {
+	sentences := make(map[string]string, len(hashes))
+	if len(hashes) == 0 {
+		return sentences, nil
+	}
+
+	var entries []orm.ChunkContextCacheEntry
+	if err := c.db.
+		WithContext(ctx).
+		Where("model = ? AND chunk_hash IN ?", model, hashes).
+		Find(&entries).Error; err != nil {
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+	if len(entries) == 0 {
+		return sentences, nil
+	}
+
+	found := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		sentences[entry.ChunkHash] = entry.Sentence
+		found = append(found, entry.ChunkHash)
+	}
+
+	if err := c.db.
+		WithContext(ctx).
+		Model(&orm.ChunkContextCacheEntry{}).
+		Where("model = ? AND chunk_hash IN ?", model, found).
+		Update("used_at", time.Now()).Error; err != nil {
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	return sentences, nil
+}
+
+func (c *ChunkContextCachePostgres) Put(ctx context.Context, model string, sentences map[string]string) error {
+	if len(sentences) == 0 {
+		return nil
+	}
+
+	// Sorted to always lock the rows in the same order
+	hashes := make([]string, 0, len(sentences))
+	for hash := range sentences {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	now := time.Now()
+	entries := make([]*orm.ChunkContextCacheEntry, len(hashes))
+	for i, hash := range hashes {
+		entries[i] = orm.NewChunkContextCacheEntry(model, hash, sentences[hash], now)
+	}
+
+	if err := c.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entries).Error; err != nil {
+		return errors.Join(domain.ErrRepositoryError, err)
+	}
+	return nil
+}
+
+func (c *ChunkContextCachePostgres) Prune(ctx context.Context, unusedSince time.Time) (int64, error) {
+	result := c.db.
+		WithContext(ctx).
+		Where("used_at < ?", unusedSince).
+		Delete(&orm.ChunkContextCacheEntry{})
+	if result.Error != nil {
+		return 0, errors.Join(domain.ErrRepositoryError, result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,97 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"github.com/thomas-marquis/goLLMan/internal/infrastructure/orm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type EmbeddingCachePostgres struct {
+	db *gorm.DB
+}
+
+var _ domain.EmbeddingCache = (*EmbeddingCachePostgres)(nil)
+
+func NewEmbeddingCachePostgres(db *gorm.DB) *EmbeddingCachePostgres {
+	return &EmbeddingCachePostgres{
+		db: db,
+	}
+}
+
+func (c *EmbeddingCachePostgres) Get(ctx context.Context, model string, hashes []string) (map[string][]float32, error) {
+	vectors := make(map[string][]float32, len(hashes))
+	if len(hashes) == 0 {
+		return vectors, nil
+	}
+
+	var entries []orm.EmbeddingCacheEntry
+	if err := c.db.
+		WithContext(ctx).
+		Where("model = ? AND content_hash IN ?", model, hashes).
+		Find(&entries).Error; err != nil {
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+	if len(entries) == 0 {
+		return vectors, nil
+	}
+
+	found := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		vectors[entry.ContentHash] = entry.Embedding.Slice()
+		found = append(found, entry.ContentHash)
+	}
+
+	if err := c.db.
+		WithContext(ctx).
+		Model(&orm.EmbeddingCacheEntry{}).
+		Where("model = ? AND content_hash IN ?", model, found).
+		Update("used_at", time.Now()).Error; err != nil {
+		return nil, errors.Join(domain.ErrRepositoryError, err)
+	}
+
+	return vectors, nil
+}
+
+func (c *EmbeddingCachePostgres) Put(ctx context.Context, model string, vectors map[string][]float32) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	// Sorted to always lock the rows in the same order
+	hashes := make([]string, 0, len(vectors))
+	for hash := range vectors {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	now := time.Now()
+	entries := make([]*orm.EmbeddingCacheEntry, len(hashes))
+	for i, hash := range hashes {
+		entries[i] = orm.NewEmbeddingCacheEntry(model, hash, vectors[hash], now)
+	}
+
+	if err := c.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entries).Error; err != nil {
+		return errors.Join(domain.ErrRepositoryError, err)
+	}
+	return nil
+}
+
+func (c *EmbeddingCachePostgres) Prune(ctx context.Context, unusedSince time.Time) (int64, error) {
+	result := c.db.
+		WithContext(ctx).
+		Where("used_at < ?", unusedSince).
+		Delete(&orm.EmbeddingCacheEntry{})
+	if result.Error != nil {
+		return 0, errors.Join(domain.ErrRepositoryError, result.Error)
+	}
+	return result.RowsAffected, nil
+}
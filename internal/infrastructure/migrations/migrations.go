@@ -20,11 +20,65 @@ func MigrateUp(db *gorm.DB) error {
 		}
 	}
 
+	// The book selection is now held by each conversation
+	if migrator.HasColumn(&orm.Book{}, "selected") {
+		if err := migrator.DropColumn(&orm.Book{}, "selected"); err != nil {
+			return err
+		}
+	}
+
 	if !migrator.HasTable(&orm.BookPart{}) {
 		if err := migrator.CreateTable(&orm.BookPart{}); err != nil {
 			return err
 		}
 	}
 
+	if !migrator.HasColumn(&orm.BookPart{}, "ChapterTitle") {
+		if err := migrator.AddColumn(&orm.BookPart{}, "ChapterTitle"); err != nil {
+			return err
+		}
+	}
+
+	// Location of the parts in the book and the metadata of their chunk
+	for _, column := range []string{"ChapterIndex", "Position", "Metadata"} {
+		if !migrator.HasColumn(&orm.BookPart{}, column) {
+			if err := migrator.AddColumn(&orm.BookPart{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_book_parts_location
+		ON book_parts (book_id, chapter_index, position);`).Error; err != nil {
+		return err
+	}
+
+	// Full-text search support for the hybrid retrieval mode
+	if err := db.Exec(`ALTER TABLE book_parts ADD COLUMN IF NOT EXISTS content_tsv tsvector
+		GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;`).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_book_parts_content_tsv
+		ON book_parts USING GIN (content_tsv);`).Error; err != nil {
+		return err
+	}
+
+	if !migrator.HasTable(&orm.IndexingCheckpoint{}) {
+		if err := migrator.CreateTable(&orm.IndexingCheckpoint{}); err != nil {
+			return err
+		}
+	}
+
+	if !migrator.HasTable(&orm.EmbeddingCacheEntry{}) {
+		if err := migrator.CreateTable(&orm.EmbeddingCacheEntry{}); err != nil {
+			return err
+		}
+	}
+
+	if !migrator.HasTable(&orm.ChunkContextCacheEntry{}) {
+		if err := migrator.CreateTable(&orm.ChunkContextCacheEntry{}); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
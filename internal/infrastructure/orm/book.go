@@ -10,7 +10,6 @@ type Book struct {
 	ID       uint   `gorm:"primaryKey;autoIncrement"`
 	Title    string `gorm:"not null"`
 	Author   string `gorm:"not null"`
-	Selected bool   `gorm:"not null;default:false"`
 	FileName string
 	Metadata datatypes.JSONMap `gorm:"type:jsonb"`
 	Status   string
@@ -30,7 +29,6 @@ func (b Book) ToDomain() domain.Book {
 		Title:    b.Title,
 		Author:   b.Author,
 		Metadata: metadata,
-		Selected: b.Selected,
 		File: domain.File{
 			Name: b.FileName,
 		},
@@ -44,7 +42,6 @@ func BookFromDomain(book domain.Book) (*Book, error) {
 		Title:    book.Title,
 		Author:   book.Author,
 		Metadata: book.Metadata,
-		Selected: book.Selected,
 		FileName: book.File.Name,
 		Status:   book.Status.String(),
 	}
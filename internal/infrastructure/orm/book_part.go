@@ -3,21 +3,41 @@ package orm
 import (
 	"github.com/pgvector/pgvector-go"
 	"github.com/thomas-marquis/goLLMan/internal/domain"
+	"gorm.io/datatypes"
 )
 
+// EmbeddingVectorSize is the size of the vectors stored in the BookPart Embedding column.
+const EmbeddingVectorSize = 1024
+
 // BookPart represents the ORM entity for book_index table
 type BookPart struct {
-	ID        uint            `gorm:"primaryKey;autoIncrement"`
-	BookID    uint            `gorm:"not null"`
-	Content   string          `gorm:"not null"`
-	Embedding pgvector.Vector `gorm:"type:vector(1024);not null"`
-	Book      Book            `gorm:"foreignKey:BookID"`
+	ID           uint   `gorm:"primaryKey;autoIncrement"`
+	BookID       uint   `gorm:"not null"`
+	ChapterTitle string `gorm:"not null;default:''"`
+	// ChapterIndex and Position locate the part in the book: the chapter, then the part within the chapter.
+	ChapterIndex int               `gorm:"not null;default:0"`
+	Position     int               `gorm:"not null;default:0"`
+	Metadata     datatypes.JSONMap `gorm:"type:jsonb"`
+	Content      string            `gorm:"not null"`
+	Embedding    pgvector.Vector   `gorm:"type:vector(1024);not null"`
+	Book         Book              `gorm:"foreignKey:BookID"`
 }
 
-func NewBookPart(book domain.Book, content string, vector []float32) *BookPart {
+func NewBookPart(
+	book domain.Book,
+	chapterTitle string,
+	chapterIndex, position int,
+	content string,
+	vector []float32,
+	metadata map[string]any,
+) *BookPart {
 	return &BookPart{
-		BookID:    stringToID(book.ID),
-		Embedding: pgvector.NewVector(vector),
-		Content:   content,
+		BookID:       stringToID(book.ID),
+		ChapterTitle: chapterTitle,
+		ChapterIndex: chapterIndex,
+		Position:     position,
+		Metadata:     metadata,
+		Embedding:    pgvector.NewVector(vector),
+		Content:      content,
 	}
 }
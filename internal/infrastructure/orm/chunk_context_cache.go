@@ -0,0 +1,26 @@
+package orm
+
+import "time"
+
+// ChunkContextCacheEntry represents the ORM entity for chunk_context_cache table.
+type ChunkContextCacheEntry struct {
+	Model     string    `gorm:"primaryKey"`
+	ChunkHash string    `gorm:"primaryKey;size:64"`
+	Sentence  string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	UsedAt    time.Time `gorm:"not null;index"`
+}
+
+func (ChunkContextCacheEntry) TableName() string {
+	return "chunk_context_cache"
+}
+
+func NewChunkContextCacheEntry(model, chunkHash, sentence string, now time.Time) *ChunkContextCacheEntry {
+	return &ChunkContextCacheEntry{
+		Model:     model,
+		ChunkHash: chunkHash,
+		Sentence:  sentence,
+		CreatedAt: now,
+		UsedAt:    now,
+	}
+}
@@ -0,0 +1,31 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// EmbeddingCacheEntry represents the ORM entity for embedding_cache table.
+// The vector column has no fixed size since each model has its own dimension.
+type EmbeddingCacheEntry struct {
+	Model       string          `gorm:"primaryKey"`
+	ContentHash string          `gorm:"primaryKey;size:64"`
+	Embedding   pgvector.Vector `gorm:"type:vector;not null"`
+	CreatedAt   time.Time       `gorm:"not null"`
+	UsedAt      time.Time       `gorm:"not null;index"`
+}
+
+func (EmbeddingCacheEntry) TableName() string {
+	return "embedding_cache"
+}
+
+func NewEmbeddingCacheEntry(model, contentHash string, vector []float32, now time.Time) *EmbeddingCacheEntry {
+	return &EmbeddingCacheEntry{
+		Model:       model,
+		ContentHash: contentHash,
+		Embedding:   pgvector.NewVector(vector),
+		CreatedAt:   now,
+		UsedAt:      now,
+	}
+}
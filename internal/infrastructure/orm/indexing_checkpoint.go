@@ -0,0 +1,34 @@
+package orm
+
+import (
+	"time"
+
+	"github.com/thomas-marquis/goLLMan/internal/domain"
+)
+
+// IndexingCheckpoint represents the ORM entity for indexing_checkpoints table
+type IndexingCheckpoint struct {
+	BookID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	NextBatch    int    `gorm:"not null"`
+	TotalBatches int    `gorm:"not null"`
+	Fingerprint  string `gorm:"not null"`
+	UpdatedAt    time.Time
+	Book         Book `gorm:"foreignKey:BookID"`
+}
+
+func NewIndexingCheckpoint(book domain.Book, checkpoint domain.IndexingCheckpoint) *IndexingCheckpoint {
+	return &IndexingCheckpoint{
+		BookID:       stringToID(book.ID),
+		NextBatch:    checkpoint.NextBatch,
+		TotalBatches: checkpoint.TotalBatches,
+		Fingerprint:  checkpoint.Fingerprint,
+	}
+}
+
+func (c IndexingCheckpoint) ToDomain() domain.IndexingCheckpoint {
+	return domain.IndexingCheckpoint{
+		NextBatch:    c.NextBatch,
+		TotalBatches: c.TotalBatches,
+		Fingerprint:  c.Fingerprint,
+	}
+}
@@ -0,0 +1,64 @@
+package infrastructure
+
+import (
+	"slices"
+	"sort"
+)
+
+// weightedRanking is a list of book part IDs, best first, with the weight of its ranking in the fusion.
+type weightedRanking struct {
+	ids    []uint
+	weight float64
+}
+
+// fuseRankings merges the rankings with the weighted reciprocal rank fusion: each part scores
+// weight / (k + rank) in every ranking it appears in, ranks starting at 1. It returns the limit best IDs.
+// The ties are broken by the ranks in the first rankings, then by the ID, so that the result is stable.
+// The rankings without a positive weight are disabled: their parts are not candidates.
+func fuseRankings(limit, k int, rankings ...weightedRanking) []uint {
+	rankings = slices.DeleteFunc(slices.Clone(rankings), func(ranking weightedRanking) bool {
+		return ranking.weight <= 0
+	})
+	scores := make(map[uint]float64)
+	// ranks holds the rank of each part in every ranking, 0 when it is missing
+	ranks := make(map[uint][]int)
+	for r, ranking := range rankings {
+		for i, id := range ranking.ids {
+			if ranks[id] == nil {
+				ranks[id] = make([]int, len(rankings))
+			}
+			if ranks[id][r] != 0 {
+				continue
+			}
+			ranks[id][r] = i + 1
+			scores[id] += ranking.weight / float64(k+i+1)
+		}
+	}
+
+	ids := make([]uint, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := ids[i], ids[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		for r := range rankings {
+			rankA, rankB := ranks[a][r], ranks[b][r]
+			if rankA == rankB {
+				continue
+			}
+			if rankA == 0 || rankB == 0 {
+				return rankB == 0
+			}
+			return rankA < rankB
+		}
+		return a < b
+	})
+
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
@@ -0,0 +1,72 @@
+package infrastructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_fuseRankings(t *testing.T) {
+	testCases := []struct {
+		name     string
+		limit    int
+		rankings []weightedRanking
+		expected []uint
+	}{
+		{
+			name:  "should rank first the parts found by both rankings",
+			limit: 3,
+			rankings: []weightedRanking{
+				{ids: []uint{1, 2, 3}, weight: 1},
+				{ids: []uint{4, 3, 5}, weight: 1},
+			},
+			expected: []uint{3, 1, 4},
+		},
+		{
+			name:  "should favor the ranking with the highest weight",
+			limit: 2,
+			rankings: []weightedRanking{
+				{ids: []uint{1, 2}, weight: 0.3},
+				{ids: []uint{3, 4}, weight: 0.7},
+			},
+			expected: []uint{3, 4},
+		},
+		{
+			name:  "should break the ties with the first ranking",
+			limit: 4,
+			rankings: []weightedRanking{
+				{ids: []uint{7, 8}, weight: 1},
+				{ids: []uint{9, 6}, weight: 1},
+			},
+			expected: []uint{7, 9, 8, 6},
+		},
+		{
+			name:  "should ignore a ranking without weight",
+			limit: 3,
+			rankings: []weightedRanking{
+				{ids: []uint{1, 2}, weight: 1},
+				{ids: []uint{3, 2, 1}, weight: 0},
+			},
+			expected: []uint{1, 2},
+		},
+		{
+			name:  "should return nothing without candidates",
+			limit: 3,
+			rankings: []weightedRanking{
+				{weight: 1},
+				{weight: 1},
+			},
+			expected: []uint{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// When
+			res := fuseRankings(tc.limit, rrfK, tc.rankings...)
+
+			// Then
+			assert.Equal(t, tc.expected, res)
+		})
+	}
+}